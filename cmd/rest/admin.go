@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mock-server/cmd/rest/internal/journal"
+	"mock-server/cmd/rest/internal/stubs"
+
+	"github.com/gorilla/mux"
+)
+
+var stubsDir string
+
+// setupAdminRoutes mounts the admin API used to manage stubs and inspect the
+// request journal. Only users with the admin role may use it, since it can
+// switch off authentication and access control.
+func setupAdminRoutes(r *mux.Router) {
+	admin := r.PathPrefix(adminPrefix).Subrouter()
+	admin.Use(adminOnly)
+
+	admin.HandleFunc("/mappings", listMappings).Methods("GET")
+	admin.HandleFunc("/mappings", createMapping).Methods("POST")
+	admin.HandleFunc("/mappings", resetMappings).Methods("DELETE")
+	admin.HandleFunc("/mappings/reset", reloadMappings).Methods("POST")
+	admin.HandleFunc("/mappings/{id}", getMapping).Methods("GET")
+	admin.HandleFunc("/mappings/{id}", deleteMapping).Methods("DELETE")
+
+	admin.HandleFunc("/scenarios", listScenarios).Methods("GET")
+	admin.HandleFunc("/scenarios/reset", resetScenarios).Methods("POST")
+	admin.HandleFunc("/scenarios/{name}", getScenario).Methods("GET")
+	admin.HandleFunc("/scenarios/{name}/state", setScenarioState).Methods("PUT")
+	admin.HandleFunc("/scenarios/{name}/reset", resetScenario).Methods("POST")
+
+	admin.HandleFunc("/sequences", getSequences).Methods("GET")
+	admin.HandleFunc("/sequences/reset", resetSequences).Methods("POST")
+	admin.HandleFunc("/sequences/routes", setRouteSequence).Methods("PUT")
+	admin.HandleFunc("/sequences/routes", clearRouteSequence).Methods("DELETE")
+
+	admin.HandleFunc("/jobs", listJobs).Methods("GET")
+	admin.HandleFunc("/jobs", resetJobs).Methods("DELETE")
+	admin.HandleFunc("/jobs/routes", setRouteJob).Methods("PUT")
+	admin.HandleFunc("/jobs/routes", clearRouteJob).Methods("DELETE")
+	admin.HandleFunc("/jobs/{id}", getJobAdmin).Methods("GET")
+	admin.HandleFunc("/jobs/{id}/transition", transitionJob).Methods("POST")
+
+	admin.HandleFunc("/webhooks", listWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks", resetWebhooks).Methods("DELETE")
+	admin.HandleFunc("/webhooks/routes", setRouteWebhooks).Methods("PUT")
+	admin.HandleFunc("/webhooks/routes", clearRouteWebhooks).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id}", getWebhook).Methods("GET")
+
+	admin.HandleFunc("/idempotency", listIdempotencyKeys).Methods("GET")
+	admin.HandleFunc("/idempotency", resetIdempotencyKeys).Methods("DELETE")
+	admin.HandleFunc("/idempotency/{key}", getIdempotencyKey).Methods("GET")
+	admin.HandleFunc("/idempotency/{key}", deleteIdempotencyKey).Methods("DELETE")
+
+	admin.HandleFunc("/streams", listStreams).Methods("GET")
+	admin.HandleFunc("/streams", setStream).Methods("PUT")
+	admin.HandleFunc("/streams", clearStream).Methods("DELETE")
+	admin.HandleFunc("/streams/push", pushStream).Methods("POST")
+
+	admin.HandleFunc("/proxy", getProxySettings).Methods("GET")
+	admin.HandleFunc("/proxy", updateProxySettings).Methods("PUT")
+
+	admin.HandleFunc("/faults", getFaults).Methods("GET")
+	admin.HandleFunc("/faults", resetFaults).Methods("DELETE")
+	admin.HandleFunc("/faults/global", setGlobalFaults).Methods("PUT")
+	admin.HandleFunc("/faults/global", clearGlobalFaults).Methods("DELETE")
+	admin.HandleFunc("/faults/routes", setRouteFaults).Methods("PUT")
+	admin.HandleFunc("/faults/routes", clearRouteFaults).Methods("DELETE")
+	admin.HandleFunc("/faults/headers", setFaultHeaders).Methods("PUT")
+
+	admin.HandleFunc("/ratelimits", getRateLimits).Methods("GET")
+	admin.HandleFunc("/ratelimits", resetRateLimits).Methods("DELETE")
+	admin.HandleFunc("/ratelimits/global", setGlobalRateLimit).Methods("PUT")
+	admin.HandleFunc("/ratelimits/global", clearGlobalRateLimit).Methods("DELETE")
+	admin.HandleFunc("/ratelimits/routes", setRouteRateLimit).Methods("PUT")
+	admin.HandleFunc("/ratelimits/routes", clearRouteRateLimit).Methods("DELETE")
+	admin.HandleFunc("/auth", getAuthSettings).Methods("GET")
+	admin.HandleFunc("/auth/routes", setRouteAuth).Methods("PUT")
+	admin.HandleFunc("/auth/routes", clearRouteAuth).Methods("DELETE")
+	admin.HandleFunc("/auth/audit", getAuthAudit).Methods("GET")
+	admin.HandleFunc("/auth/audit", clearAuthAudit).Methods("DELETE")
+	admin.HandleFunc("/oauth", getOAuthSettings).Methods("GET")
+	admin.HandleFunc("/oauth/revocations", getRevocations).Methods("GET")
+	admin.HandleFunc("/oauth/revocations", clearRevocations).Methods("DELETE")
+	admin.HandleFunc("/rbac", getAccessPolicy).Methods("GET")
+	admin.HandleFunc("/rbac/users/{username}", getEffectiveAccess).Methods("GET")
+	admin.HandleFunc("/caching", getCaching).Methods("GET")
+	admin.HandleFunc("/caching", setCaching).Methods("PUT")
+	admin.HandleFunc("/caching/routes", setRouteCaching).Methods("PUT")
+	admin.HandleFunc("/caching/routes", clearRouteCaching).Methods("DELETE")
+
+	admin.HandleFunc("/tls", getTLSSettings).Methods("GET")
+	admin.HandleFunc("/tls/ca.crt", getCACertificate).Methods("GET")
+	admin.HandleFunc("/tls/client-certificates", issueClientCertificate).Methods("POST")
+
+	admin.HandleFunc("/requests", listRequests).Methods("GET")
+	admin.HandleFunc("/requests", resetRequests).Methods("DELETE")
+	admin.HandleFunc("/requests/count", countRequests).Methods("POST")
+	admin.HandleFunc("/requests/find", findRequests).Methods("POST")
+	admin.HandleFunc("/requests/unmatched", listUnmatchedRequests).Methods("GET")
+	admin.HandleFunc("/requests/unmatched/near-misses", unmatchedNearMisses).Methods("GET")
+	admin.HandleFunc("/near-misses/request-pattern", patternNearMisses).Methods("POST")
+}
+
+func listMappings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: stubStore.All()})
+}
+
+func createMapping(w http.ResponseWriter, r *http.Request) {
+	var stub stubs.Stub
+	if err := json.NewDecoder(r.Body).Decode(&stub); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	if err := stubStore.Add(&stub); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	logger.Info("Stub mapping created", "id", stub.ID, "name", stub.Name)
+	writeJSON(w, http.StatusCreated, APIResponse{Success: true, Data: stub})
+}
+
+func getMapping(w http.ResponseWriter, r *http.Request) {
+	stub, ok := stubStore.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Mapping not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: stub})
+}
+
+func deleteMapping(w http.ResponseWriter, r *http.Request) {
+	if !stubStore.Remove(mux.Vars(r)["id"]) {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Mapping not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func resetMappings(w http.ResponseWriter, r *http.Request) {
+	stubStore.Reset()
+	sequenceTracker.Reset("", "")
+	logger.Info("All stub mappings removed")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+// reloadMappings drops every stub and loads the stub directory again.
+func reloadMappings(w http.ResponseWriter, r *http.Request) {
+	stubStore.Reset()
+	sequenceTracker.Reset("", "")
+	if err := loadStubs(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: stubStore.All()})
+}
+
+// loadStubs loads the stub directory and any recordings kept outside it. In
+// playback mode only the recordings are served.
+func loadStubs() error {
+	recordings := upstreamProxy.Config().RecordingsDir
+
+	dirs := []string{stubsDir}
+	if upstreamProxy.Config().Mode == "playback" {
+		dirs = []string{recordings}
+	} else if recordings != "" && !isWithin(recordings, stubsDir) {
+		dirs = append(dirs, recordings)
+	}
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) && dir == recordings {
+			// nothing has been recorded yet
+			continue
+		}
+		n, err := stubStore.LoadDir(dir)
+		if err != nil {
+			return err
+		}
+		logger.Info("Loaded stub mappings", "dir", dir, "count", n)
+	}
+	return nil
+}
+
+func isWithin(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func listRequests(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: requestJournal.Entries()})
+}
+
+func resetRequests(w http.ResponseWriter, r *http.Request) {
+	requestJournal.Reset()
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func listUnmatchedRequests(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: requestJournal.Unmatched()})
+}
+
+func decodePattern(w http.ResponseWriter, r *http.Request) (stubs.RequestPattern, bool) {
+	var pattern stubs.RequestPattern
+	if err := json.NewDecoder(r.Body).Decode(&pattern); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return pattern, false
+	}
+	if err := pattern.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return pattern, false
+	}
+	return pattern, true
+}
+
+type verificationResult struct {
+	Count      int              `json:"count"`
+	NearMisses []stubs.NearMiss `json:"nearMisses,omitempty"`
+}
+
+// countRequests verifies how often a pattern was requested. When nothing
+// matched, the closest journaled requests are included to explain why.
+func countRequests(w http.ResponseWriter, r *http.Request) {
+	pattern, ok := decodePattern(w, r)
+	if !ok {
+		return
+	}
+
+	result := verificationResult{Count: len(requestJournal.Find(pattern))}
+	if result.Count == 0 {
+		all := journal.Requests(requestJournal.Entries())
+		result.NearMisses = stubs.FindRequestNearMisses(pattern, all, nearMissesLimit)
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: result})
+}
+
+func findRequests(w http.ResponseWriter, r *http.Request) {
+	pattern, ok := decodePattern(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: requestJournal.Find(pattern)})
+}
+
+func patternNearMisses(w http.ResponseWriter, r *http.Request) {
+	pattern, ok := decodePattern(w, r)
+	if !ok {
+		return
+	}
+	all := journal.Requests(requestJournal.Entries())
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: stubs.FindRequestNearMisses(pattern, all, nearMissesLimit)})
+}
+
+func unmatchedNearMisses(w http.ResponseWriter, r *http.Request) {
+	var report []unmatchedReport
+	candidates := append(stubStore.StubCandidates(), builtinRoutes...)
+	for _, e := range requestJournal.Unmatched() {
+		report = append(report, unmatchedReport{
+			Request:    e.Request,
+			NearMisses: stubs.FindNearMisses(e.Request, candidates, nearMissesLimit),
+		})
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: report})
+}
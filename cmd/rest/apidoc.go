@@ -0,0 +1,101 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/apidoc"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// docsPage renders the generated document without any external assets, so
+// it works offline.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// documentedRoutes is the route table captured once the router is built.
+var documentedRoutes []apidoc.Route
+
+// registerDocRoutes serves the generated OpenAPI document and the docs page.
+func registerDocRoutes(r *mux.Router) {
+	r.HandleFunc("/openapi.json", getAPIDocJSON).Methods("GET")
+	r.HandleFunc("/openapi.yaml", getAPIDocYAML).Methods("GET")
+	r.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	}).Methods("GET")
+}
+
+// isDocPath reports whether path serves the documentation itself.
+func isDocPath(path string) bool {
+	return path == "/openapi.json" || path == "/openapi.yaml" || path == "/docs"
+}
+
+// routeTable lists the router's routes for the generated document, leaving
+// out the admin API and the documentation endpoints.
+func routeTable(router *mux.Router) []apidoc.Route {
+	var out []apidoc.Route
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || strings.HasPrefix(tpl, adminPrefix) || isDocPath(tpl) {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			out = append(out, apidoc.Route{Method: method, Template: tpl})
+		}
+		return nil
+	})
+	return out
+}
+
+// buildAPIDoc describes the current routes and stub mappings. It is rebuilt
+// per request so stubs added through the admin API show up immediately.
+func buildAPIDoc(r *http.Request) *openapi3.T {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	builder := apidoc.Builder{
+		Title:       builtinAPI.Doc.Info.Title,
+		Version:     builtinAPI.Doc.Info.Version,
+		Description: builtinAPI.Doc.Info.Description,
+		Server:      scheme + "://" + r.Host,
+		Sources:     []apidoc.Source{{Doc: builtinAPI.Doc, BasePath: builtinAPI.BasePath}},
+	}
+	if apiMock != nil {
+		builder.Sources = append(builder.Sources, apidoc.Source{Doc: apiMock.Doc, BasePath: apiMock.BasePath})
+	}
+	return builder.Build(documentedRoutes, stubStore.All())
+}
+
+func getAPIDocJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(buildAPIDoc(r))
+}
+
+func getAPIDocYAML(w http.ResponseWriter, r *http.Request) {
+	doc, err := buildAPIDoc(r).MarshalYAML()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(out)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mock-server/cmd/rest/internal/auth"
+	"mock-server/internal/certs"
+	"mock-server/internal/common"
+	"mock-server/internal/rbac"
+)
+
+var authRoutes = auth.NewRegistry(nil)
+
+// defaultSchemes protect the built-in routes that have none configured.
+var defaultSchemes = []auth.Scheme{{Type: auth.Bearer, Realm: "servr"}}
+
+// authenticatedKey marks a request whose caller has already been
+// authenticated, by the route's schemes or by identify.
+type authenticatedKey struct{}
+
+func authenticated(r *http.Request) bool {
+	done, _ := r.Context().Value(authenticatedKey{}).(bool)
+	return done
+}
+
+// requireAuth authenticates r with any of schemes, answering 401 with a
+// challenge for each of them when it cannot. The returned request carries
+// the user.
+func requireAuth(w http.ResponseWriter, r *http.Request, schemes []auth.Scheme) (*http.Request, bool) {
+	res, err := auth.Authenticate(r, schemes)
+	if err != nil {
+		logger.Warn("Authentication failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		username, _, _ := r.BasicAuth()
+		common.Audit(common.AuthEvent{Scheme: res.Scheme, Username: username, Reason: err.Error()}, r.RemoteAddr)
+		res.WriteChallenges(w.Header())
+		writeJSON(w, http.StatusUnauthorized, APIResponse{Success: false, Error: "Authentication Required"})
+		return nil, false
+	}
+	ctx := context.WithValue(r.Context(), authenticatedKey{}, true)
+	if res.User != nil {
+		logger.Info("Authenticated", "scheme", res.Scheme, "username", res.User.Username)
+		common.Audit(common.AuthEvent{Scheme: res.Scheme, Username: res.User.Username, Success: true}, r.RemoteAddr)
+		ctx = common.WithUser(ctx, res.User)
+	}
+	return r.WithContext(ctx), true
+}
+
+// adminSchemes authenticate admin API callers without a client certificate.
+var adminSchemes = []auth.Scheme{{Type: auth.Basic, Realm: "servr-admin"}, {Type: auth.Bearer, Realm: "servr-admin"}}
+
+// adminRequirement is what admin API callers must meet.
+var adminRequirement = &rbac.Requirement{Roles: []string{"admin"}}
+
+// adminOnly lets through only users with the admin role, authenticated by
+// a client certificate or else Basic or bearer credentials.
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ok := identifyWith(w, r, adminSchemes)
+		if !ok {
+			return
+		}
+		user, _ := common.UserFromContext(r.Context())
+		if err := accessPolicy.Check(user, adminRequirement); err != nil {
+			logger.Warn("Admin access denied", "method", r.Method, "path", r.URL.Path, "username", username(user), "error", err)
+			writeJSON(w, http.StatusForbidden, APIResponse{Success: false, Error: "Forbidden"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identify authenticates r the way built-in routes do by default: with a
+// verified client certificate of a known user or else a bearer token.
+func identify(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	return identifyWith(w, r, defaultSchemes)
+}
+
+// identifyWith authenticates r with a verified client certificate of a known
+// user or else any of schemes.
+func identifyWith(w http.ResponseWriter, r *http.Request, schemes []auth.Scheme) (*http.Request, bool) {
+	if cert := certs.PeerCertificate(r.TLS); cert != nil {
+		user, err := common.UserFromCertificate(cert)
+		if err == nil {
+			common.Audit(common.AuthEvent{Scheme: "client-certificate", Username: user.Username, Success: true}, r.RemoteAddr)
+			ctx := context.WithValue(r.Context(), authenticatedKey{}, true)
+			return r.WithContext(common.WithUser(ctx, user)), true
+		}
+		logger.Warn("Client certificate rejected", "commonName", cert.Subject.CommonName, "error", err)
+		common.Audit(common.AuthEvent{Scheme: "client-certificate", Username: cert.Subject.CommonName, Reason: err.Error()}, r.RemoteAddr)
+	}
+	return requireAuth(w, r, schemes)
+}
+
+// authenticateRoutes applies the schemes configured for built-in routes.
+// They replace the bearer token that authMiddleware would otherwise require.
+func authenticateRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, schemes := authRoutes.Resolve(routeKeys(r)...)
+		if len(schemes) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r, ok := requireAuth(w, r, schemes); ok {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+type authOverview struct {
+	Default []auth.Scheme            `json:"default"`
+	Routes  map[string][]auth.Scheme `json:"routes"`
+}
+
+func getAuthSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: authOverview{
+		Default: defaultSchemes,
+		Routes:  authRoutes.Routes(),
+	}})
+}
+
+// setRouteAuth sets the schemes of one route, any of which may
+// authenticate it, e.g. {"route": "GET /customers", "schemes": [{"type": "basic"}]}.
+func setRouteAuth(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route   string        `json:"route"`
+		Schemes []auth.Scheme `json:"schemes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || len(body.Schemes) == 0 {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its schemes"})
+		return
+	}
+	if err := authRoutes.SetRoute(body.Route, body.Schemes); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteAuth(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	authRoutes.SetRoute(route, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+// getAuthAudit lists recorded authentication attempts, oldest first,
+// filtered by the service, scheme, username, outcome (success or failure),
+// since (RFC 3339) and limit query parameters.
+func getAuthAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := common.AuditFilter{Service: q.Get("service"), Scheme: q.Get("scheme"), Username: q.Get("username")}
+	switch q.Get("outcome") {
+	case "":
+	case "success", "failure":
+		success := q.Get("outcome") == "success"
+		filter.Success = &success
+	default:
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "outcome must be success or failure"})
+		return
+	}
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "since must be an RFC 3339 time"})
+			return
+		}
+		filter.Since = t
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "limit must be a non-negative number"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := common.AuditEvents(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: events})
+}
+
+func clearAuthAudit(w http.ResponseWriter, r *http.Request) {
+	if err := common.ClearAudit(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
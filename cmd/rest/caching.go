@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"mock-server/cmd/rest/internal/caching"
+)
+
+var cachePolicies = caching.NewRegistry(false, nil)
+
+// cacheControlWriter adds a route's Cache-Control header to successful
+// responses that do not set their own. It passes on Flush and Hijack so
+// streaming handlers and faults keep working behind it.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if caching.Cacheable(status) && cw.Header().Get("Cache-Control") == "" {
+			cw.Header().Set("Cache-Control", cw.value)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheControlWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+func (cw *cacheControlWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// applyCaching sends the Cache-Control policy configured for a built-in
+// route.
+func applyCaching(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, policy := cachePolicies.Resolve(routeKeys(r)...); policy != nil && policy.CacheControl != "" {
+			w = &cacheControlWriter{ResponseWriter: w, value: policy.CacheControl}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveStubConditionally gives a stub with a Cache-Control policy its
+// header and an ETag, and reports whether a conditional GET was answered
+// with 304.
+func serveStubConditionally(w http.ResponseWriter, r *http.Request, cacheControl string, status int, body []byte) bool {
+	if cacheControl == "" || !caching.Cacheable(status) {
+		return false
+	}
+	h := w.Header()
+	h.Set("Cache-Control", cacheControl)
+	if h.Get("ETag") == "" {
+		h.Set("ETag", caching.ETag(body))
+	}
+	v := caching.Validators{ETag: h.Get("ETag")}
+	if lm, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		v.LastModified = lm
+	}
+	if !caching.NotModified(r, v) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+type cachingOverview struct {
+	RequireIfMatch bool                       `json:"requireIfMatch"`
+	Routes         map[string]*caching.Policy `json:"routes"`
+}
+
+func getCaching(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: cachingOverview{
+		RequireIfMatch: cachePolicies.RequireIfMatch(),
+		Routes:         cachePolicies.Routes(),
+	}})
+}
+
+// setCaching switches whether every customer update must be conditional,
+// e.g. {"requireIfMatch": true}. Routes can still require it on their own.
+func setCaching(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RequireIfMatch *bool `json:"requireIfMatch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RequireIfMatch == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected requireIfMatch"})
+		return
+	}
+	cachePolicies.SetRequireIfMatch(*body.RequireIfMatch)
+	logger.Info("Conditional updates configured", "requireIfMatch", *body.RequireIfMatch)
+	getCaching(w, r)
+}
+
+// setRouteCaching sets the policy of one route, e.g.
+// {"route": "GET /customers/{id}", "policy": {"cacheControl": "max-age=60"}}.
+func setRouteCaching(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route  string          `json:"route"`
+		Policy *caching.Policy `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || body.Policy == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its policy"})
+		return
+	}
+	if err := cachePolicies.SetRoute(body.Route, body.Policy); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteCaching(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	cachePolicies.SetRoute(route, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mock-server/cmd/rest/internal/caching"
+	"mock-server/cmd/rest/internal/customers"
+	"mock-server/cmd/rest/internal/negotiate"
+	M "mock-server/internal/common/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+	// maxPage keeps page*per_page within an int.
+	maxPage = math.MaxInt / maxPerPage
+)
+
+// customerStore backs every customer route, seeded with mockCustomers.
+var customerStore = customers.NewStore(mockCustomers)
+
+// CustomerPage is one page of a customer listing.
+type CustomerPage struct {
+	Items      []M.Customer `json:"items" yaml:"items" xml:"items>customer"`
+	Page       int          `json:"page" yaml:"page" xml:"page"`
+	PerPage    int          `json:"per_page" yaml:"per_page" xml:"per_page"`
+	Total      int          `json:"total" yaml:"total" xml:"total"`
+	TotalPages int          `json:"total_pages" yaml:"total_pages" xml:"total_pages"`
+}
+
+// CSVTable lists the page's customers; the paging details are in the
+// X-Total-Count header and the query.
+func (p CustomerPage) CSVTable() ([]string, [][]string) {
+	return negotiate.TableOf(p.Items)
+}
+
+func registerCustomerRoutes(r *mux.Router) {
+	r.HandleFunc("/customers", authMiddleware(negotiated(listCustomers))).Methods("GET")
+	r.HandleFunc("/customers", authMiddleware(negotiated(createCustomer))).Methods("POST")
+	r.HandleFunc("/customers/{id}", authMiddleware(negotiated(getCustomer))).Methods("GET")
+	r.HandleFunc("/customers/{id}", authMiddleware(negotiated(replaceCustomer))).Methods("PUT")
+	r.HandleFunc("/customers/{id}", authMiddleware(negotiated(patchCustomer))).Methods("PATCH")
+	r.HandleFunc("/customers/{id}", authMiddleware(negotiated(deleteCustomer))).Methods("DELETE")
+}
+
+func listCustomers(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := customers.Query{
+		Type:    params.Get("type"),
+		Name:    params.Get("name"),
+		Email:   params.Get("email"),
+		Page:    1,
+		PerPage: defaultPerPage,
+	}
+
+	var errs []customers.FieldError
+	if v := params.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 || page > maxPage {
+			errs = append(errs, customers.FieldError{Field: "page", Reason: fmt.Sprintf("must be between 1 and %d", maxPage)})
+		}
+		q.Page = page
+	}
+	if v := params.Get("per_page"); v != "" {
+		perPage, err := strconv.Atoi(v)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			errs = append(errs, customers.FieldError{Field: "per_page", Reason: fmt.Sprintf("must be between 1 and %d", maxPerPage)})
+		}
+		q.PerPage = perPage
+	}
+	if v := params.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if _, ok := customers.SortFields[strings.TrimPrefix(field, "-")]; !ok {
+				errs = append(errs, customers.FieldError{Field: "sort", Reason: fmt.Sprintf("cannot sort by %q", field)})
+				continue
+			}
+			q.Sort = append(q.Sort, field)
+		}
+	}
+	if errs != nil {
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid query parameters", Data: errs})
+		return
+	}
+
+	changed := customerStore.Changed()
+	items, total := customerStore.List(q)
+	page := CustomerPage{
+		Items:      items,
+		Page:       q.Page,
+		PerPage:    q.PerPage,
+		Total:      total,
+		TotalPages: (total + q.PerPage - 1) / q.PerPage,
+	}
+	v := caching.Validators{ETag: negotiatedETag(r, page), LastModified: changed}
+	if caching.NotModified(r, v) {
+		caching.WriteNotModified(w, v)
+		return
+	}
+	v.Write(w.Header())
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeNegotiated(w, r, http.StatusOK, APIResponse{Success: true, Data: page})
+}
+
+func createCustomer(w http.ResponseWriter, r *http.Request) {
+	var customer M.Customer
+	if !decodeCustomer(w, r, &customer) {
+		return
+	}
+
+	created, err := customerStore.Create(customer)
+	if err != nil {
+		writeCustomerError(w, r, err)
+		return
+	}
+	logger.Info("Customer created", "customerId", created.ID)
+	writeCustomerValidators(w, r, created)
+	w.Header().Set("Location", fmt.Sprintf("/customers/%d", created.ID))
+	writeNegotiated(w, r, http.StatusCreated, APIResponse{Success: true, Data: created})
+}
+
+func replaceCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := customerID(w, r)
+	if !ok {
+		return
+	}
+
+	var customer M.Customer
+	if !decodeCustomer(w, r, &customer) {
+		return
+	}
+
+	updated, err := customerStore.Replace(id, customer, preconditions(w, r))
+	if err != nil {
+		writeCustomerError(w, r, err)
+		return
+	}
+	logger.Info("Customer replaced", "customerId", id)
+	writeCustomerValidators(w, r, updated)
+	writeNegotiated(w, r, http.StatusOK, APIResponse{Success: true, Data: updated})
+}
+
+// patchCustomer applies a JSON Merge Patch. Plain application/json bodies are
+// accepted too, since many clients do not set the merge-patch media type.
+func patchCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := customerID(w, r)
+	if !ok {
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			writeNegotiated(w, r, http.StatusUnsupportedMediaType, APIResponse{Success: false, Error: "PATCH requires application/merge-patch+json"})
+			return
+		}
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Failed to read request body"})
+		return
+	}
+
+	updated, err := customerStore.Patch(id, patch, preconditions(w, r))
+	if err != nil {
+		writeCustomerError(w, r, err)
+		return
+	}
+	logger.Info("Customer patched", "customerId", id)
+	writeCustomerValidators(w, r, updated)
+	writeNegotiated(w, r, http.StatusOK, APIResponse{Success: true, Data: updated})
+}
+
+func deleteCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := customerID(w, r)
+	if !ok {
+		return
+	}
+	if err := customerStore.Delete(id, preconditions(w, r)); err != nil {
+		writeCustomerError(w, r, err)
+		return
+	}
+	logger.Info("Customer deleted", "customerId", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// customerID parses the {id} path variable, answering 400 when it is invalid.
+func customerID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		logger.Warn("Invalid customer ID", "id", vars["id"])
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid customer ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeCustomerError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *customers.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Validation failed", Data: invalid.Errors})
+	case errors.Is(err, customers.ErrNotFound):
+		writeNegotiated(w, r, http.StatusNotFound, APIResponse{Success: false, Error: "Customer not found"})
+	case errors.Is(err, caching.ErrPreconditionRequired):
+		writeNegotiated(w, r, http.StatusPreconditionRequired, APIResponse{Success: false, Error: "If-Match header required"})
+	case errors.Is(err, caching.ErrPreconditionFailed):
+		writeNegotiated(w, r, http.StatusPreconditionFailed, APIResponse{Success: false, Error: "Customer has been modified"})
+	default:
+		logger.Error("Customer update failed", "error", err)
+		writeNegotiated(w, r, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+	}
+}
+
+// customerValidators identify a customer's state in the format negotiated
+// for r.
+func customerValidators(r *http.Request, c M.Customer, modified time.Time) caching.Validators {
+	return caching.Validators{ETag: negotiatedETag(r, c), LastModified: modified}
+}
+
+// negotiatedETag is the strong ETag of v in the format negotiated for r. It
+// hashes the format along with v, since each format is a different
+// representation and strong tags must tell them apart.
+func negotiatedETag(r *http.Request, v interface{}) string {
+	f, err := negotiate.Response(r)
+	if err != nil {
+		f = negotiate.JSON
+	}
+	content, _ := json.Marshal(v)
+	return caching.ETag(append([]byte(f.Name+"\n"), content...))
+}
+
+// writeCustomerValidators sends the validators of c as just written.
+func writeCustomerValidators(w http.ResponseWriter, r *http.Request, c M.Customer) {
+	_, modified, _ := customerStore.Lookup(c.ID)
+	customerValidators(r, c, modified).Write(w.Header())
+}
+
+// preconditions checks If-Match and If-Unmodified-Since against the
+// customer being updated. When they fail, the current validators are sent
+// so the client can see what it is out of date with.
+func preconditions(w http.ResponseWriter, r *http.Request) customers.Precondition {
+	return func(current M.Customer, modified time.Time) error {
+		v := customerValidators(r, current, modified)
+		err := caching.CheckPreconditions(r, v, cachePolicies.RequiresIfMatch(routeKeys(r)...))
+		if errors.Is(err, caching.ErrPreconditionFailed) {
+			v.Write(w.Header())
+		}
+		return err
+	}
+}
+
+// negotiated answers 406 before a customer handler runs when the client
+// accepts none of the formats it can produce.
+func negotiated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := negotiate.Response(r); err != nil {
+			writeJSON(w, http.StatusNotAcceptable, APIResponse{Success: false, Error: "Not Acceptable", Data: negotiate.MediaTypes()})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeNegotiated writes v as JSON, XML, YAML or CSV, whichever the client
+// asked for with ?format= or Accept.
+func writeNegotiated(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	f, err := negotiate.Response(r)
+	if err != nil {
+		f = negotiate.JSON
+	}
+	if err := negotiate.Write(w, f, status, v); err != nil {
+		logger.Error("Could not encode response", "format", f.Name, "error", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: "Could not encode response as " + f.MediaType})
+	}
+}
+
+// decodeCustomer reads a customer in any supported format, answering 415 or
+// 400 when it cannot.
+func decodeCustomer(w http.ResponseWriter, r *http.Request, customer *M.Customer) bool {
+	f, err := negotiate.Decode(r, customer)
+	switch {
+	case errors.Is(err, negotiate.ErrUnsupportedMediaType):
+		writeNegotiated(w, r, http.StatusUnsupportedMediaType, APIResponse{Success: false, Error: "Unsupported Content-Type", Data: negotiate.MediaTypes()})
+		return false
+	case err != nil:
+		logger.Warn("Invalid customer body", "format", f.Name, "error", err)
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid " + strings.ToUpper(f.Name)})
+		return false
+	}
+	return true
+}
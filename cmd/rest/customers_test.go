@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mock-server/cmd/rest/internal/caching"
+	"mock-server/cmd/rest/internal/customers"
+
+	"github.com/gorilla/mux"
+)
+
+func customerRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	store, policies := customerStore, cachePolicies
+	t.Cleanup(func() { customerStore, cachePolicies = store, policies })
+	customerStore = customers.NewStore(mockCustomers)
+	cachePolicies = caching.NewRegistry(false, nil)
+
+	r := mux.NewRouter()
+	registerCustomerRoutes(r)
+	return r
+}
+
+func serveCustomers(r *mux.Router, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid-token")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestListCustomersPaging(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"?page=2&per_page=2", http.StatusOK, `"page":2,"per_page":2,"total":4,"total_pages":2`},
+		{"?page=3&per_page=2", http.StatusOK, `"items":[]`},
+		{"?page=92233720368547758&per_page=100", http.StatusOK, `"items":[]`},
+		{"?page=92233720368547759&per_page=100", http.StatusBadRequest, `"field":"page"`},
+		{"?page=9223372036854775807&per_page=100", http.StatusBadRequest, `"field":"page"`},
+		{"?page=0", http.StatusBadRequest, `"field":"page"`},
+		{"?per_page=101", http.StatusBadRequest, `"field":"per_page"`},
+		{"?sort=colour", http.StatusBadRequest, `"field":"sort"`},
+	}
+	r := customerRouter(t)
+	for _, tt := range tests {
+		w := serveCustomers(r, "GET", "/customers"+tt.query, "", nil)
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("GET /customers%s = %d %s; want %d with %s", tt.query, w.Code, w.Body, tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestCustomerUpdatesIfMatch(t *testing.T) {
+	patch := map[string]string{"Content-Type": "application/merge-patch+json"}
+
+	r := customerRouter(t)
+	if w := serveCustomers(r, "PATCH", "/customers/1", `{"name":"A"}`, patch); w.Code != http.StatusOK {
+		t.Fatalf("PATCH without If-Match by default = %d %s, want 200", w.Code, w.Body)
+	}
+
+	cachePolicies.SetRoute("PATCH /customers/{id}", &caching.Policy{RequireIfMatch: true})
+	if w := serveCustomers(r, "PATCH", "/customers/1", `{"name":"B"}`, patch); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH without If-Match on a route requiring it = %d, want 428", w.Code)
+	}
+	if w := serveCustomers(r, "DELETE", "/customers/4", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE without If-Match on another route = %d, want 204", w.Code)
+	}
+
+	etag := serveCustomers(r, "GET", "/customers/1", "", nil).Header().Get("ETag")
+	withTag := map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": etag}
+	if w := serveCustomers(r, "PATCH", "/customers/1", `{"name":"C"}`, withTag); w.Code != http.StatusOK {
+		t.Errorf("PATCH with the current ETag = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serveCustomers(r, "PATCH", "/customers/1", `{"name":"D"}`, withTag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale ETag = %d, want 412", w.Code)
+	}
+
+	cachePolicies.SetRoute("PATCH /customers/{id}", nil)
+	cachePolicies.SetRequireIfMatch(true)
+	if w := serveCustomers(r, "PUT", "/customers/2", `{"type":"Regular"}`, nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PUT without If-Match when required everywhere = %d, want 428", w.Code)
+	}
+}
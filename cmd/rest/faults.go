@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/faults"
+
+	"github.com/gorilla/mux"
+)
+
+var faultRegistry = faults.NewRegistry(nil, nil, false)
+
+// routeKeys names the matched route the way per-route settings are keyed,
+// most specific first: "GET /customer/{id}" then "/customer/{id}".
+func routeKeys(r *http.Request) []string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	return []string{r.Method + " " + tpl, tpl}
+}
+
+// injectFaults applies the configured latency and failures to built-in routes.
+func injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		settings, err := faultRegistry.Resolve(r, nil, routeKeys(r)...)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+			return
+		}
+		faults.Serve(w, r, settings, next)
+	})
+}
+
+// withFaults serves a stub or proxied response under its own fault settings,
+// falling back to the global ones.
+func withFaults(w http.ResponseWriter, r *http.Request, own *faults.Settings, serve http.HandlerFunc) {
+	settings, err := faultRegistry.Resolve(r, own)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	faults.Serve(w, r, settings, serve)
+}
+
+type faultOverview struct {
+	AllowRequestHeaders bool                        `json:"allowRequestHeaders"`
+	Global              *faults.Settings            `json:"global,omitempty"`
+	Routes              map[string]*faults.Settings `json:"routes"`
+}
+
+func getFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: faultOverview{
+		AllowRequestHeaders: faultRegistry.AllowHeaders(),
+		Global:              faultRegistry.Global(),
+		Routes:              faultRegistry.Routes(),
+	}})
+}
+
+func resetFaults(w http.ResponseWriter, r *http.Request) {
+	faultRegistry.Reset()
+	logger.Info("All fault settings cleared")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setGlobalFaults(w http.ResponseWriter, r *http.Request) {
+	var settings faults.Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	if err := faultRegistry.SetGlobal(&settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Global fault settings updated", "settings", settings)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: settings})
+}
+
+func clearGlobalFaults(w http.ResponseWriter, r *http.Request) {
+	faultRegistry.SetGlobal(nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+type routeFaults struct {
+	Route    string           `json:"route"`
+	Settings *faults.Settings `json:"settings"`
+}
+
+// setRouteFaults installs settings for one route, e.g.
+// {"route": "GET /customer/{id}", "settings": {"fixedDelayMilliseconds": 500}}.
+func setRouteFaults(w http.ResponseWriter, r *http.Request) {
+	var body routeFaults
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its settings"})
+		return
+	}
+	if err := faultRegistry.SetRoute(body.Route, body.Settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Route fault settings updated", "route", body.Route)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteFaults(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	faultRegistry.SetRoute(route, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setFaultHeaders(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Allow bool `json:"allow"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	faultRegistry.SetAllowHeaders(body.Allow)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits keep the diagnostic endpoints from tying up the mock.
+const (
+	maxDelaySeconds = 10
+	maxBytes        = 100 * 1024
+	maxStreamLines  = 100
+	maxRedirects    = 20
+)
+
+// registerHTTPBinRoutes mounts httpbin-compatible diagnostic endpoints so
+// HTTP client tests need no external httpbin. Like httpbin they need no
+// authentication and answer with bare JSON rather than an APIResponse.
+func registerHTTPBinRoutes(r *mux.Router) {
+	r.HandleFunc("/anything", anything)
+	r.HandleFunc("/anything/{path:.*}", anything)
+	r.HandleFunc("/get", httpbinGet).Methods("GET")
+	r.HandleFunc("/status/{codes}", httpbinStatus)
+	r.HandleFunc("/delay/{n}", httpbinDelay)
+	r.HandleFunc("/redirect/{n}", httpbinRedirect).Methods("GET")
+	r.HandleFunc("/bytes/{n}", httpbinBytes).Methods("GET")
+	r.HandleFunc("/stream/{n}", httpbinStream).Methods("GET")
+	r.HandleFunc("/gzip", httpbinGzip).Methods("GET")
+	r.HandleFunc("/cookies", listCookies).Methods("GET")
+	r.HandleFunc("/cookies/set", setCookies).Methods("GET")
+	r.HandleFunc("/cookies/set/{name}/{value}", setCookies).Methods("GET")
+	r.HandleFunc("/cookies/delete", deleteCookies).Methods("GET")
+}
+
+// describeRequest has the fields httpbin reports for every request: args,
+// headers, origin and url.
+func describeRequest(r *http.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"args":    multiValues(r.URL.Query()),
+		"headers": flatHeaders(r),
+		"origin":  origin(r),
+		"url":     absoluteURL(r, r.URL.RequestURI()),
+	}
+}
+
+// describeBody adds what httpbin reports about the body: data, files, form
+// and json. Form bodies are reported under form and files only.
+func describeBody(r *http.Request, out map[string]interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	data, form, files := bodyText(body), map[string]interface{}{}, map[string]interface{}{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return err
+		}
+		form = multiValues(r.PostForm)
+		if r.MultipartForm != nil {
+			for name, headers := range r.MultipartForm.File {
+				for _, fh := range headers {
+					f, err := fh.Open()
+					if err != nil {
+						return err
+					}
+					content, err := io.ReadAll(f)
+					f.Close()
+					if err != nil {
+						return err
+					}
+					files[name] = bodyText(content)
+				}
+			}
+		}
+		data = ""
+	}
+
+	var parsed interface{}
+	if json.Unmarshal(body, &parsed) != nil {
+		parsed = nil
+	}
+	out["data"], out["form"], out["files"], out["json"] = data, form, files, parsed
+	return nil
+}
+
+// bodyText returns text as is and anything else as a data URL.
+func bodyText(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(b)
+}
+
+// multiValues collapses single values to strings, as httpbin does.
+func multiValues(values map[string][]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			out[k] = v[0]
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func flatHeaders(r *http.Request) map[string]string {
+	out := map[string]string{"Host": r.Host}
+	for k, v := range r.Header {
+		out[k] = strings.Join(v, ",")
+	}
+	return out
+}
+
+// origin is the client address, taking X-Forwarded-For into account.
+func origin(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// pathInt parses a numeric path variable, answering 400 when it is not a
+// number between 0 and max.
+func pathInt(w http.ResponseWriter, r *http.Request, name string, max int) (int, bool) {
+	n, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || n < 0 || n > max {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: fmt.Sprintf("%s must be a number between 0 and %d", name, max)})
+		return 0, false
+	}
+	return n, true
+}
+
+// anything reflects the request: method, args, headers, form, files, json
+// and the raw data.
+func anything(w http.ResponseWriter, r *http.Request) {
+	out := describeRequest(r)
+	out["method"] = r.Method
+	if err := describeBody(r, out); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func httpbinGet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, describeRequest(r))
+}
+
+// httpbinStatus answers with the given status, or a random one of a
+// comma-separated list. Redirects point at /redirect/1 and 401 carries a
+// Basic challenge so clients can follow or retry them.
+func httpbinStatus(w http.ResponseWriter, r *http.Request) {
+	var codes []int
+	for _, part := range strings.Split(mux.Vars(r)["codes"], ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || code < 100 || code > 599 {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid status code"})
+			return
+		}
+		codes = append(codes, code)
+	}
+	code := codes[rand.Intn(len(codes))]
+
+	switch {
+	case code >= 300 && code < 400:
+		w.Header().Set("Location", "/redirect/1")
+	case code == http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Basic realm="Fake Realm"`)
+	}
+	w.WriteHeader(code)
+	if code == http.StatusTeapot {
+		io.WriteString(w, "I'm a teapot\n")
+	}
+}
+
+// httpbinDelay waits n seconds, at most 10, before describing the request.
+func httpbinDelay(w http.ResponseWriter, r *http.Request) {
+	n, ok := pathInt(w, r, "n", maxDelaySeconds)
+	if !ok {
+		return
+	}
+	select {
+	case <-time.After(time.Duration(n) * time.Second):
+	case <-r.Context().Done():
+		return
+	}
+	out := describeRequest(r)
+	if err := describeBody(r, out); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// httpbinRedirect redirects n times before landing on /get. With
+// ?absolute=true the Location headers are absolute URLs.
+func httpbinRedirect(w http.ResponseWriter, r *http.Request) {
+	n, ok := pathInt(w, r, "n", maxRedirects)
+	if !ok {
+		return
+	}
+	next := "/get"
+	if n > 1 {
+		next = fmt.Sprintf("/redirect/%d", n-1)
+		if r.URL.RawQuery != "" {
+			next += "?" + r.URL.RawQuery
+		}
+	}
+	if r.URL.Query().Get("absolute") == "true" {
+		next = absoluteURL(r, next)
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// httpbinBytes sends n random bytes, reproducible with ?seed=.
+func httpbinBytes(w http.ResponseWriter, r *http.Request) {
+	n, ok := pathInt(w, r, "n", maxBytes)
+	if !ok {
+		return
+	}
+	seed := time.Now().UnixNano()
+	if v := r.URL.Query().Get("seed"); v != "" {
+		var err error
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "seed must be an integer"})
+			return
+		}
+	}
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(n))
+	w.Write(b)
+}
+
+// httpbinStream sends n newline-delimited JSON descriptions of the request,
+// flushing each one.
+func httpbinStream(w http.ResponseWriter, r *http.Request) {
+	n, ok := pathInt(w, r, "n", maxStreamLines)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for i := 0; i < n; i++ {
+		line := describeRequest(r)
+		line["id"] = i
+		if err := enc.Encode(line); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
+
+// httpbinGzip describes the request in a gzip-encoded body.
+func httpbinGzip(w http.ResponseWriter, r *http.Request) {
+	out := describeRequest(r)
+	out["method"] = r.Method
+	out["gzipped"] = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	defer zw.Close()
+	json.NewEncoder(zw).Encode(out)
+}
+
+func listCookies(w http.ResponseWriter, r *http.Request) {
+	cookies := map[string]string{}
+	for _, c := range r.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cookies": cookies})
+}
+
+// setCookies sets the cookies named in the query, or the one in the path,
+// and redirects to /cookies.
+func setCookies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if name := vars["name"]; name != "" {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: vars["value"], Path: "/"})
+	}
+	for name, values := range r.URL.Query() {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: values[0], Path: "/"})
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
+
+// deleteCookies expires the cookies named in the query and redirects to
+// /cookies.
+func deleteCookies(w http.ResponseWriter, r *http.Request) {
+	for name := range r.URL.Query() {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, Expires: time.Unix(0, 0)})
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mock-server/cmd/rest/internal/idempotency"
+	"mock-server/internal/certs"
+	"mock-server/internal/common"
+
+	"github.com/gorilla/mux"
+)
+
+var idempotencyStore = idempotency.NewStore(24 * time.Hour)
+
+// idempotencyRecorder keeps the whole response so it can be replayed.
+type idempotencyRecorder struct {
+	*statusRecorder
+	body bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.statusRecorder.Write(b)
+}
+
+// withIdempotency serves a POST or PATCH carrying an Idempotency-Key once
+// and replays its response to retries. Reusing a key for a different
+// request, or by another caller, is refused with 422, and a retry that
+// arrives before the first request has finished gets 409. Server errors and
+// authentication failures are not stored, so retrying after one processes
+// the request again.
+func withIdempotency(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	key := r.Header.Get(idempotency.Header)
+	if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+		serve(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+		return
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	uri := r.URL.RequestURI()
+	stored, err := idempotencyStore.Begin(key, r.Method, uri, idempotency.Fingerprint(idempotencyCaller(r), r.Method, uri, body))
+	switch {
+	case errors.Is(err, idempotency.ErrConflict):
+		logger.Warn("Idempotency key reused for a different request", "key", key, "method", r.Method, "path", r.URL.Path)
+		writeJSON(w, http.StatusUnprocessableEntity, APIResponse{Success: false, Error: "Idempotency-Key was already used for a different request"})
+		return
+	case errors.Is(err, idempotency.ErrInProgress):
+		writeJSON(w, http.StatusConflict, APIResponse{Success: false, Error: "A request with this Idempotency-Key is still being processed"})
+		return
+	case stored != nil:
+		logger.Info("Replaying idempotent response", "key", key, "method", r.Method, "path", r.URL.Path)
+		replayResponse(w, stored)
+		return
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			idempotencyStore.Abandon(key)
+		}
+	}()
+
+	rec := &idempotencyRecorder{statusRecorder: &statusRecorder{ResponseWriter: w}}
+	serve(rec, r)
+	if rec.status == 0 || rec.status >= 500 || rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden {
+		return
+	}
+	idempotencyStore.Complete(key, idempotency.Response{
+		Status: rec.status,
+		Header: rec.Header().Clone(),
+		Body:   rec.body.String(),
+	})
+	completed = true
+}
+
+// idempotencyCaller identifies who sent r: the authenticated user, or else
+// a hash of its client certificate and the headers that may carry
+// credentials, since built-in routes authenticate after responses are
+// replayed.
+func idempotencyCaller(r *http.Request) string {
+	if user, ok := common.UserFromContext(r.Context()); ok {
+		return "user:" + user.Username
+	}
+	h := sha256.New()
+	if cert := certs.PeerCertificate(r.TLS); cert != nil {
+		h.Write(cert.Raw)
+	}
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		lower := strings.ToLower(name)
+		if name != idempotency.Header && (lower == "authorization" || lower == "cookie" ||
+			strings.Contains(lower, "key") || strings.Contains(lower, "token")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(r.Header[name], ", "))
+	}
+	return "credentials:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// replayResponse writes a stored response. Headers already set for this
+// request, such as rate limit counters, are left as they are.
+func replayResponse(w http.ResponseWriter, resp *idempotency.Response) {
+	h := w.Header()
+	for name, values := range resp.Header {
+		if _, ok := h[name]; !ok {
+			h[name] = values
+		}
+	}
+	h.Set("Idempotent-Replayed", "true")
+	h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.Status)
+	io.WriteString(w, resp.Body)
+}
+
+// replayIdempotent applies Idempotency-Key handling to built-in routes.
+func replayIdempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		withIdempotency(w, r, next.ServeHTTP)
+	})
+}
+
+type idempotencyOverview struct {
+	TTL  string               `json:"ttl"`
+	Keys []idempotency.Record `json:"keys"`
+}
+
+func listIdempotencyKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: idempotencyOverview{
+		TTL:  idempotencyStore.TTL().String(),
+		Keys: idempotencyStore.List(),
+	}})
+}
+
+func getIdempotencyKey(w http.ResponseWriter, r *http.Request) {
+	rec, ok := idempotencyStore.Get(mux.Vars(r)["key"])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Idempotency key not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: rec})
+}
+
+func deleteIdempotencyKey(w http.ResponseWriter, r *http.Request) {
+	if !idempotencyStore.Delete(mux.Vars(r)["key"]) {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Idempotency key not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func resetIdempotencyKeys(w http.ResponseWriter, r *http.Request) {
+	idempotencyStore.Reset()
+	logger.Info("Cleared idempotency keys")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
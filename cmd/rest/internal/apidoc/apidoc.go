@@ -0,0 +1,349 @@
+package apidoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mock-server/cmd/rest/internal/stubs"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Route is a method and mux path template taken from the live router.
+type Route struct {
+	Method   string
+	Template string
+}
+
+// Source is an OpenAPI document whose operations are served under BasePath.
+// Routes found in a source reuse its operation description verbatim.
+type Source struct {
+	Doc      *openapi3.T
+	BasePath string
+}
+
+// Builder assembles a document describing everything the service answers.
+type Builder struct {
+	Title       string
+	Version     string
+	Description string
+	Server      string
+	Sources     []Source
+}
+
+// Build describes routes first, then stubs for paths no route covers.
+func (b *Builder) Build(routes []Route, mappings []*stubs.Stub) *openapi3.T {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: b.Title, Version: b.Version, Description: b.Description},
+		Paths:   openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas:         openapi3.Schemas{},
+			Responses:       openapi3.ResponseBodies{},
+			Parameters:      openapi3.ParametersMap{},
+			RequestBodies:   openapi3.RequestBodies{},
+			SecuritySchemes: openapi3.SecuritySchemes{},
+			Examples:        openapi3.Examples{},
+			Headers:         openapi3.Headers{},
+		},
+	}
+	if b.Server != "" {
+		doc.Servers = openapi3.Servers{{URL: b.Server}}
+	}
+	for _, src := range b.Sources {
+		mergeComponents(doc.Components, src.Doc.Components)
+	}
+
+	for _, route := range routes {
+		path := openAPIPath(route.Template)
+		op := b.knownOperation(route.Method, path)
+		if op == nil {
+			op = synthesizeOperation(route.Method, path)
+		}
+		setOperation(doc, path, route.Method, op)
+	}
+
+	for _, stub := range mappings {
+		method, path, ok := stubRoute(stub)
+		if !ok || hasOperation(doc, path, method) {
+			continue
+		}
+		setOperation(doc, path, method, stubOperation(stub, method, path))
+	}
+
+	return doc
+}
+
+// knownOperation looks the route up in the source documents.
+func (b *Builder) knownOperation(method, path string) *openapi3.Operation {
+	for _, src := range b.Sources {
+		specPath := strings.TrimPrefix(path, src.BasePath)
+		if src.BasePath != "" && specPath == path {
+			continue
+		}
+		if item := src.Doc.Paths.Find(specPath); item != nil {
+			if op := item.GetOperation(method); op != nil {
+				copied := *op
+				// path-level parameters belong on the operation once merged
+				copied.Parameters = append(append(openapi3.Parameters{}, item.Parameters...), op.Parameters...)
+				if copied.Security == nil && len(src.Doc.Security) > 0 {
+					security := src.Doc.Security
+					copied.Security = &security
+				}
+				return &copied
+			}
+		}
+	}
+	return nil
+}
+
+func mergeComponents(dst *openapi3.Components, src *openapi3.Components) {
+	if src == nil {
+		return
+	}
+	for k, v := range src.Schemas {
+		if _, ok := dst.Schemas[k]; !ok {
+			dst.Schemas[k] = v
+		}
+	}
+	for k, v := range src.Responses {
+		if _, ok := dst.Responses[k]; !ok {
+			dst.Responses[k] = v
+		}
+	}
+	for k, v := range src.Parameters {
+		if _, ok := dst.Parameters[k]; !ok {
+			dst.Parameters[k] = v
+		}
+	}
+	for k, v := range src.RequestBodies {
+		if _, ok := dst.RequestBodies[k]; !ok {
+			dst.RequestBodies[k] = v
+		}
+	}
+	for k, v := range src.SecuritySchemes {
+		if _, ok := dst.SecuritySchemes[k]; !ok {
+			dst.SecuritySchemes[k] = v
+		}
+	}
+	for k, v := range src.Examples {
+		if _, ok := dst.Examples[k]; !ok {
+			dst.Examples[k] = v
+		}
+	}
+	for k, v := range src.Headers {
+		if _, ok := dst.Headers[k]; !ok {
+			dst.Headers[k] = v
+		}
+	}
+}
+
+func setOperation(doc *openapi3.T, path, method string, op *openapi3.Operation) {
+	item := doc.Paths.Value(path)
+	if item == nil {
+		item = &openapi3.PathItem{}
+		doc.Paths.Set(path, item)
+	}
+	if item.GetOperation(method) == nil {
+		item.SetOperation(method, op)
+	}
+}
+
+func hasOperation(doc *openapi3.T, path, method string) bool {
+	item := doc.Paths.Find(path)
+	return item != nil && item.GetOperation(method) != nil
+}
+
+// openAPIPath drops mux variable patterns: /items/{id:[0-9]+} -> /items/{id}.
+func openAPIPath(tpl string) string {
+	var b strings.Builder
+	for i := 0; i < len(tpl); i++ {
+		if tpl[i] != '{' {
+			b.WriteByte(tpl[i])
+			continue
+		}
+		depth, j := 0, i
+		for ; j < len(tpl); j++ {
+			if tpl[j] == '{' {
+				depth++
+			} else if tpl[j] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		name, _, _ := strings.Cut(tpl[i+1:min(j, len(tpl))], ":")
+		b.WriteString("{" + name + "}")
+		i = j
+	}
+	return b.String()
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func pathParameters(path string) openapi3.Parameters {
+	var params openapi3.Parameters
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		params = append(params, &openapi3.ParameterRef{Value: openapi3.NewPathParameter(m[1]).WithSchema(openapi3.NewStringSchema())})
+	}
+	return params
+}
+
+// synthesizeOperation describes a route no document knows about with the
+// service's standard response envelope.
+func synthesizeOperation(method, path string) *openapi3.Operation {
+	op := openapi3.NewOperation()
+	op.Summary = method + " " + path
+	op.Parameters = pathParameters(path)
+	op.Responses = openapi3.NewResponses(openapi3.WithStatus(http.StatusOK, &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().
+			WithDescription("Successful response").
+			WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/APIResponse", nil)),
+	}))
+	return op
+}
+
+var regexMeta = regexp.MustCompile(`[\\\[\]()*+?^$|]`)
+
+// stubRoute derives a documented path for a stub. Regular expression segments
+// of urlPathPattern become path parameters.
+func stubRoute(stub *stubs.Stub) (string, string, bool) {
+	method := strings.ToUpper(stub.Request.Method)
+	if method == "" || method == "ANY" {
+		method = http.MethodGet
+	}
+
+	p := stub.Request
+	switch {
+	case p.URLPath != "":
+		return method, p.URLPath, true
+	case p.URL != "":
+		path, _, _ := strings.Cut(p.URL, "?")
+		return method, path, true
+	case p.URLPathPattern != "":
+		pattern := strings.TrimSuffix(strings.TrimPrefix(p.URLPathPattern, "^"), "$")
+		segments := strings.Split(pattern, "/")
+		n := 0
+		for i, seg := range segments {
+			if regexMeta.MatchString(seg) {
+				n++
+				segments[i] = "{param" + strconv.Itoa(n) + "}"
+			}
+		}
+		path := strings.Join(segments, "/")
+		return method, path, strings.HasPrefix(path, "/")
+	}
+	return "", "", false
+}
+
+func stubOperation(stub *stubs.Stub, method, path string) *openapi3.Operation {
+	op := openapi3.NewOperation()
+	op.Summary = stub.Name
+	if op.Summary == "" {
+		op.Summary = method + " " + path
+	}
+	op.Description = fmt.Sprintf("Served by stub mapping %s.", stub.ID)
+	op.Parameters = pathParameters(path)
+
+	for _, name := range sortedMatcherKeys(stub.Request.QueryParameters) {
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{
+			Value: openapi3.NewQueryParameter(name).WithSchema(openapi3.NewStringSchema()),
+		})
+	}
+	for _, name := range sortedMatcherKeys(stub.Request.Headers) {
+		if strings.EqualFold(name, "Authorization") || strings.EqualFold(name, "Accept") || strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{
+			Value: openapi3.NewHeaderParameter(name).WithSchema(openapi3.NewStringSchema()),
+		})
+	}
+
+	// a stub with a response sequence documents each distinct status once
+	defs := stub.Definitions()
+	op.Responses = openapi3.NewResponsesWithCapacity(len(defs))
+	for _, def := range defs {
+		status := def.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if op.Responses.Status(status) == nil {
+			op.Responses.Set(strconv.Itoa(status), &openapi3.ResponseRef{Value: stubResponse(def, status)})
+		}
+	}
+	return op
+}
+
+func stubResponse(def stubs.ResponseDefinition, status int) *openapi3.Response {
+	resp := openapi3.NewResponse().WithDescription(http.StatusText(status))
+
+	contentType := def.Headers["Content-Type"]
+	if len(def.JSONBody) > 0 {
+		var example interface{}
+		json.Unmarshal(def.JSONBody, &example)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		resp.Content = openapi3.Content{contentType: &openapi3.MediaType{
+			Schema:  openapi3.NewSchemaRef("", inferSchema(example)),
+			Example: example,
+		}}
+	} else if def.Body != "" {
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+		resp.Content = openapi3.Content{contentType: &openapi3.MediaType{
+			Schema:  openapi3.NewSchemaRef("", openapi3.NewStringSchema()),
+			Example: def.Body,
+		}}
+	}
+	return resp
+}
+
+func sortedMatcherKeys(m map[string]stubs.StringMatcher) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// inferSchema describes an example value.
+func inferSchema(v interface{}) *openapi3.Schema {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		s := openapi3.NewObjectSchema()
+		for k, child := range val {
+			s.WithProperty(k, inferSchema(child))
+		}
+		return s
+	case []interface{}:
+		s := openapi3.NewArraySchema()
+		if len(val) > 0 {
+			s.WithItems(inferSchema(val[0]))
+		} else {
+			s.WithItems(openapi3.NewSchema())
+		}
+		return s
+	case string:
+		return openapi3.NewStringSchema()
+	case float64:
+		if val == float64(int64(val)) {
+			return openapi3.NewIntegerSchema()
+		}
+		return openapi3.NewFloat64Schema()
+	case bool:
+		return openapi3.NewBoolSchema()
+	default:
+		s := openapi3.NewSchema()
+		s.Nullable = true
+		return s
+	}
+}
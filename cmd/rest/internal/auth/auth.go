@@ -0,0 +1,260 @@
+// Package auth authenticates REST requests with one of several schemes:
+// bearer tokens, HTTP Basic, HTTP Digest, API keys and AWS SigV4-style
+// request signing. Each resolves the caller to a common.User and, on
+// failure, describes itself in a WWW-Authenticate challenge.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mock-server/internal/common"
+)
+
+const (
+	None   = "none"
+	Bearer = "bearer"
+	Basic  = "basic"
+	Digest = "digest"
+	APIKey = "api-key"
+	HMAC   = "hmac"
+)
+
+const defaultRealm = "servr"
+
+var (
+	// ErrMissingCredentials means the request carried nothing any of the
+	// schemes could check.
+	ErrMissingCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means credentials were sent but rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Scheme is one way of authenticating. Which fields apply depends on Type.
+type Scheme struct {
+	// Type is none, bearer, basic, digest, api-key or hmac.
+	Type  string `yaml:"type" json:"type"`
+	Realm string `yaml:"realm" json:"realm,omitempty"`
+	// Header carries an API key; it defaults to X-API-Key. Query names a
+	// query parameter that may carry it instead.
+	Header string `yaml:"header" json:"header,omitempty"`
+	Query  string `yaml:"query" json:"query,omitempty"`
+	// Region and Service, when set, must match a signature's credential
+	// scope. MaxSkewSeconds bounds how old a signature may be; it defaults
+	// to 900.
+	Region         string `yaml:"region" json:"region,omitempty"`
+	Service        string `yaml:"service" json:"service,omitempty"`
+	MaxSkewSeconds int    `yaml:"max_skew_seconds" json:"maxSkewSeconds,omitempty"`
+}
+
+// Validate checks the scheme and fills in defaults.
+func (s *Scheme) Validate() error {
+	switch s.Type {
+	case None, Bearer, Basic, Digest, HMAC:
+	case APIKey:
+		if s.Header == "" && s.Query == "" {
+			s.Header = "X-API-Key"
+		}
+	default:
+		return fmt.Errorf("unknown auth scheme %q (want %s, %s, %s, %s, %s or %s)", s.Type, None, Bearer, Basic, Digest, APIKey, HMAC)
+	}
+	if s.Realm == "" {
+		s.Realm = defaultRealm
+	}
+	if s.MaxSkewSeconds < 0 {
+		return fmt.Errorf("max_skew_seconds must not be negative")
+	}
+	if s.Type == HMAC && s.MaxSkewSeconds == 0 {
+		s.MaxSkewSeconds = 900
+	}
+	return nil
+}
+
+// ValidateSchemes checks a list of schemes, any of which may authenticate a
+// request.
+func ValidateSchemes(schemes []Scheme) error {
+	for i := range schemes {
+		if err := schemes[i].Validate(); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// present reports whether r carries credentials for the scheme.
+func (s *Scheme) present(r *http.Request) bool {
+	authz := r.Header.Get("Authorization")
+	switch s.Type {
+	case Bearer:
+		// a bare token without the Bearer prefix is accepted too
+		if authz != "" && !hasPrefixFold(authz, "Basic ") && !hasPrefixFold(authz, "Digest ") && !strings.HasPrefix(authz, sigV4Algorithm+" ") {
+			return true
+		}
+		return r.URL.Query().Get("token") != ""
+	case Basic:
+		return hasPrefixFold(authz, "Basic ")
+	case Digest:
+		return hasPrefixFold(authz, "Digest ")
+	case APIKey:
+		return s.apiKey(r) != ""
+	case HMAC:
+		return strings.HasPrefix(authz, sigV4Algorithm+" ")
+	}
+	return false
+}
+
+func (s *Scheme) authenticate(r *http.Request) (*common.User, error) {
+	switch s.Type {
+	case Bearer:
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		return common.ValidateAuth(strings.TrimPrefix(token, "Bearer "))
+	case Basic:
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return common.ValidatePassword(username, password)
+	case Digest:
+		return s.authenticateDigest(r)
+	case APIKey:
+		return common.ValidateAPIKey(s.apiKey(r))
+	case HMAC:
+		return s.authenticateSigV4(r)
+	}
+	return nil, ErrMissingCredentials
+}
+
+func (s *Scheme) apiKey(r *http.Request) string {
+	if s.Header != "" {
+		if key := r.Header.Get(s.Header); key != "" {
+			return key
+		}
+	}
+	if s.Query != "" {
+		return r.URL.Query().Get(s.Query)
+	}
+	return ""
+}
+
+// challenges describe the scheme for WWW-Authenticate; err is why it
+// rejected the request's credentials, if it tried.
+func (s *Scheme) challenges(err error) []string {
+	realm := quote(s.Realm)
+	switch s.Type {
+	case Bearer:
+		if err != nil {
+			return []string{`Bearer realm=` + realm + `, error="invalid_token"`}
+		}
+		return []string{`Bearer realm=` + realm}
+	case Basic:
+		return []string{`Basic realm=` + realm + `, charset="UTF-8"`}
+	case Digest:
+		return s.digestChallenges(errors.Is(err, errStaleNonce))
+	case APIKey:
+		if s.Header != "" {
+			return []string{`APIKey realm=` + realm + `, header=` + quote(s.Header)}
+		}
+		return []string{`APIKey realm=` + realm + `, query=` + quote(s.Query)}
+	case HMAC:
+		return []string{sigV4Algorithm + ` realm=` + realm}
+	}
+	return nil
+}
+
+// Result is the outcome of Authenticate.
+type Result struct {
+	User *common.User
+	// Scheme is the type of the scheme that accepted the request or, when
+	// none did, of those that tried, comma-separated.
+	Scheme string
+	// Challenges are the WWW-Authenticate values to send on failure.
+	Challenges []string
+}
+
+// Authenticate tries each scheme whose credentials r carries and returns the
+// first user one of them accepts. A none scheme lets every request through
+// without a user.
+func Authenticate(r *http.Request, schemes []Scheme) (Result, error) {
+	var res Result
+	errs := make([]error, len(schemes))
+	var tried []string
+	for i := range schemes {
+		s := &schemes[i]
+		if s.Type == None {
+			return Result{Scheme: None}, nil
+		}
+		if !s.present(r) {
+			continue
+		}
+		tried = append(tried, s.Type)
+		user, err := s.authenticate(r)
+		if err == nil {
+			return Result{User: user, Scheme: s.Type}, nil
+		}
+		errs[i] = err
+	}
+	for i := range schemes {
+		res.Challenges = append(res.Challenges, schemes[i].challenges(errs[i])...)
+	}
+	if len(tried) == 0 {
+		return res, ErrMissingCredentials
+	}
+	res.Scheme = strings.Join(tried, ",")
+	return res, fmt.Errorf("%w: %w", ErrInvalidCredentials, errors.Join(errs...))
+}
+
+// WriteChallenges sets a WWW-Authenticate header for each challenge.
+func (res Result) WriteChallenges(h http.Header) {
+	for _, c := range res.Challenges {
+		h.Add("WWW-Authenticate", c)
+	}
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// parseParams splits comma-separated auth-params such as
+// realm="x", nc=00000001 into a map, unquoting quoted values.
+func parseParams(s string) map[string]string {
+	out := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value, s = b.String(), s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		out[name] = value
+	}
+	return out
+}
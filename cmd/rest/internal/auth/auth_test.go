@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The built-in test user, used when no users file is loaded.
+const (
+	testUser      = "testuser"
+	testPassword  = "testpass"
+	testAccessKey = "AKIDTESTUSER"
+	testSecretKey = "test-secret-key"
+)
+
+func validScheme(t *testing.T, s Scheme) Scheme {
+	t.Helper()
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// digestAuthorization answers a Digest challenge the way a client would.
+type digestAuthorization struct {
+	username, password, realm, algorithm, qop, nonce, uri string
+	newHash                                               func() hash.Hash
+}
+
+func (d digestAuthorization) header(method string) string {
+	h := func(parts ...string) string {
+		sum := d.newHash()
+		sum.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	const nc, cnonce = "00000001", "0a4f113b"
+	ha1 := h(d.username, d.realm, d.password)
+	if strings.HasSuffix(d.algorithm, "-sess") {
+		ha1 = h(ha1, d.nonce, cnonce)
+	}
+	ha2 := h(method, d.uri)
+	response := h(ha1, d.nonce, ha2)
+	if d.qop != "" {
+		response = h(ha1, d.nonce, nc, cnonce, d.qop, ha2)
+	}
+	return `Digest username="` + d.username + `", realm="` + d.realm + `", nonce="` + d.nonce + `", uri="` + d.uri +
+		`", algorithm=` + d.algorithm + `, qop=` + d.qop + `, nc=` + nc + `, cnonce="` + cnonce + `", response="` + response + `"`
+}
+
+func staleNonce() string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Add(-2*nonceLifetime).Unix()))
+	mac := hmac.New(sha256.New, nonceKey)
+	mac.Write(b)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(b))
+}
+
+func TestDigest(t *testing.T) {
+	s := validScheme(t, Scheme{Type: Digest})
+	valid := digestAuthorization{
+		username: testUser, password: testPassword, realm: defaultRealm,
+		algorithm: "SHA-256", qop: "auth", nonce: newNonce(), uri: "/customers?page=2", newHash: sha256.New,
+	}
+
+	tests := []struct {
+		name string
+		edit func(*digestAuthorization)
+		want error
+	}{
+		{"SHA-256", func(*digestAuthorization) {}, nil},
+		{"MD5", func(d *digestAuthorization) { d.algorithm, d.newHash = "MD5", md5.New }, nil},
+		{"MD5 session", func(d *digestAuthorization) { d.algorithm, d.newHash = "MD5-sess", md5.New }, nil},
+		{"no qop", func(d *digestAuthorization) { d.qop = "" }, nil},
+		{"wrong password", func(d *digestAuthorization) { d.password = "guess" }, ErrInvalidCredentials},
+		{"unknown user", func(d *digestAuthorization) { d.username = "nobody" }, ErrInvalidCredentials},
+		{"wrong realm", func(d *digestAuthorization) { d.realm = "elsewhere" }, ErrInvalidCredentials},
+		{"another URI", func(d *digestAuthorization) { d.uri = "/customers" }, ErrInvalidCredentials},
+		{"unsupported qop", func(d *digestAuthorization) { d.qop = "auth-int" }, ErrInvalidCredentials},
+		{"unsupported algorithm", func(d *digestAuthorization) { d.algorithm, d.newHash = "SHA-512-256", sha256.New }, ErrInvalidCredentials},
+		{"forged nonce", func(d *digestAuthorization) { d.nonce = base64.RawURLEncoding.EncodeToString(make([]byte, 40)) }, ErrInvalidCredentials},
+		{"stale nonce", func(d *digestAuthorization) { d.nonce = staleNonce() }, errStaleNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := valid
+			tt.edit(&d)
+			r := httptest.NewRequest("GET", "/customers?page=2", nil)
+			r.Header.Set("Authorization", d.header("GET"))
+			user, err := s.authenticate(r)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("authenticate = %v, want %v", err, tt.want)
+			}
+			if err == nil && user.Username != testUser {
+				t.Errorf("authenticated as %q", user.Username)
+			}
+		})
+	}
+}
+
+func TestDigestChallenges(t *testing.T) {
+	s := validScheme(t, Scheme{Type: Digest, Realm: `my "realm"`})
+	got := s.challenges(errStaleNonce)
+	if len(got) != 2 || !strings.Contains(got[0], "algorithm=SHA-256") || !strings.Contains(got[1], "algorithm=MD5") {
+		t.Fatalf("challenges = %v", got)
+	}
+	params := parseParams(strings.TrimPrefix(got[0], "Digest "))
+	if params["realm"] != `my "realm"` || params["qop"] != "auth" || params["stale"] != "true" || checkNonce(params["nonce"]) != nil {
+		t.Errorf("challenge params = %v", params)
+	}
+}
+
+// signSigV4 signs r as a client would, with the payload hash header set
+// when payloadHash is not empty.
+func signSigV4(r *http.Request, keyID, secret, region, service string, at time.Time, payloadHash string) {
+	stamp := at.UTC().Format(sigV4TimeFormat)
+	date := stamp[:8]
+	r.Header.Set("X-Amz-Date", stamp)
+	signed := "host;x-amz-date"
+	hashed := payloadHash
+	if payloadHash != "" {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		signed = "host;x-amz-content-sha256;x-amz-date"
+	} else {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		hashed = hexSHA256(body)
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, strings.Split(signed, ";")),
+		signed,
+		hashed,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := sigV4Algorithm + "\n" + stamp + "\n" + scope + "\n" + hexSHA256([]byte(canonical))
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	r.Header.Set("Authorization", sigV4Algorithm+" Credential="+keyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+func TestSigV4(t *testing.T) {
+	const body = `{"name":"Alice"}`
+	s := validScheme(t, Scheme{Type: HMAC, Region: "eu-west-1", Service: "servr"})
+
+	tests := []struct {
+		name        string
+		keyID       string
+		secret      string
+		region      string
+		at          time.Time
+		payloadHash string
+		tamper      func(*http.Request)
+		want        error
+	}{
+		{name: "signed body", want: nil},
+		{name: "payload hash header", payloadHash: hexSHA256([]byte(body)), want: nil},
+		{name: "unsigned payload", payloadHash: unsignedPayload, want: nil},
+		{name: "wrong payload hash", payloadHash: hexSHA256([]byte("other")), want: ErrInvalidCredentials},
+		{name: "wrong secret", secret: "guess", want: ErrInvalidCredentials},
+		{name: "unknown key", keyID: "AKIDNOBODY", want: ErrInvalidCredentials},
+		{name: "another region", region: "us-east-1", want: ErrInvalidCredentials},
+		{name: "too old", at: time.Now().Add(-time.Hour), want: ErrInvalidCredentials},
+		{name: "too far ahead", at: time.Now().Add(time.Hour), want: ErrInvalidCredentials},
+		{name: "within the skew", at: time.Now().Add(-10 * time.Minute), want: nil},
+		{name: "changed body", tamper: func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"name":"Mallory"}`)) }, want: ErrInvalidCredentials},
+		{name: "changed query", tamper: func(r *http.Request) { r.URL.RawQuery = "dry_run=false" }, want: ErrInvalidCredentials},
+		{name: "changed method", tamper: func(r *http.Request) { r.Method = "DELETE" }, want: ErrInvalidCredentials},
+		{name: "date outside the scope", tamper: func(r *http.Request) {
+			r.Header.Set("X-Amz-Date", time.Now().Add(48*time.Hour).UTC().Format(sigV4TimeFormat))
+		}, want: ErrInvalidCredentials},
+		{name: "malformed credential", tamper: func(r *http.Request) {
+			r.Header.Set("Authorization", sigV4Algorithm+" Credential="+testAccessKey+", SignedHeaders=host, Signature=00")
+		}, want: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyID, secret, region, at := testAccessKey, testSecretKey, "eu-west-1", time.Now()
+			if tt.keyID != "" {
+				keyID = tt.keyID
+			}
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+			if tt.region != "" {
+				region = tt.region
+			}
+			if !tt.at.IsZero() {
+				at = tt.at
+			}
+			r := httptest.NewRequest("POST", "/customers?dry_run=true&a=b%20c", strings.NewReader(body))
+			signSigV4(r, keyID, secret, region, "servr", at, tt.payloadHash)
+			if tt.tamper != nil {
+				tt.tamper(r)
+			}
+			user, err := s.authenticate(r)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("authenticate = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if user.Username != testUser {
+				t.Errorf("authenticated as %q", user.Username)
+			}
+			if read, _ := io.ReadAll(r.Body); string(read) != body {
+				t.Errorf("handler would read body %q, want %q", read, body)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	tests := []struct {
+		name       string
+		schemes    []Scheme
+		authz      string
+		target     string
+		header     map[string]string
+		want       error
+		wantScheme string
+	}{
+		{"basic", []Scheme{{Type: Basic}}, basic(testUser, testPassword), "/", nil, nil, Basic},
+		{"wrong basic password", []Scheme{{Type: Basic}}, basic(testUser, "guess"), "/", nil, ErrInvalidCredentials, Basic},
+		{"bearer", []Scheme{{Type: Bearer}}, "Bearer valid-token", "/", nil, nil, Bearer},
+		{"bare token", []Scheme{{Type: Bearer}}, "valid-token", "/", nil, nil, Bearer},
+		{"token in the query", []Scheme{{Type: Bearer}}, "", "/?token=valid-token", nil, nil, Bearer},
+		{"API key header", []Scheme{{Type: APIKey}}, "", "/", map[string]string{"X-API-Key": "test-api-key"}, nil, APIKey},
+		{"API key query", []Scheme{{Type: APIKey, Query: "key"}}, "", "/?key=test-api-key", nil, nil, APIKey},
+		{"wrong API key", []Scheme{{Type: APIKey}}, "", "/", map[string]string{"X-API-Key": "guess"}, ErrInvalidCredentials, APIKey},
+		{"nothing sent", []Scheme{{Type: Basic}, {Type: APIKey}}, "", "/", nil, ErrMissingCredentials, ""},
+		{"other scheme sent", []Scheme{{Type: Basic}}, "Bearer valid-token", "/", nil, ErrMissingCredentials, ""},
+		{"second scheme accepts", []Scheme{{Type: APIKey}, {Type: Basic}}, basic(testUser, testPassword), "/", map[string]string{"X-API-Key": "guess"}, nil, Basic},
+		{"none", []Scheme{{Type: None}, {Type: Basic}}, "", "/", nil, nil, None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSchemes(tt.schemes); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.authz != "" {
+				r.Header.Set("Authorization", tt.authz)
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			res, err := Authenticate(r, tt.schemes)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("Authenticate = %v, want %v", err, tt.want)
+			}
+			if res.Scheme != tt.wantScheme {
+				t.Errorf("scheme = %q, want %q", res.Scheme, tt.wantScheme)
+			}
+			if err == nil && tt.wantScheme != None && res.User.Username != testUser {
+				t.Errorf("authenticated as %+v", res.User)
+			}
+			if err != nil && len(res.Challenges) == 0 {
+				t.Error("a failure sent no challenges")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		scheme  Scheme
+		want    Scheme
+		wantErr bool
+	}{
+		{Scheme{Type: APIKey}, Scheme{Type: APIKey, Header: "X-API-Key", Realm: defaultRealm}, false},
+		{Scheme{Type: APIKey, Query: "key"}, Scheme{Type: APIKey, Query: "key", Realm: defaultRealm}, false},
+		{Scheme{Type: HMAC, Realm: "r"}, Scheme{Type: HMAC, Realm: "r", MaxSkewSeconds: 900}, false},
+		{Scheme{Type: "oauth"}, Scheme{}, true},
+		{Scheme{Type: HMAC, MaxSkewSeconds: -1}, Scheme{}, true},
+	}
+	for _, tt := range tests {
+		s := tt.scheme
+		err := s.Validate()
+		if (err != nil) != tt.wantErr || (!tt.wantErr && s != tt.want) {
+			t.Errorf("Validate(%+v) = %+v, %v; want %+v, error %v", tt.scheme, s, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	got := parseParams(`username="a\"b", realm="servr", nc=00000001, qop=auth,uri="/x?a=1,2"`)
+	want := map[string]string{"username": `a"b`, "realm": "servr", "nc": "00000001", "qop": "auth", "uri": "/x?a=1,2"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("parseParams = %v", got)
+	}
+}
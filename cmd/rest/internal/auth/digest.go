@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"mock-server/internal/common"
+)
+
+// nonceLifetime is how long a Digest nonce is accepted; after that the
+// client is told it is stale and should retry with a fresh one.
+const nonceLifetime = 5 * time.Minute
+
+var errStaleNonce = errors.New("stale nonce")
+
+// nonceKey signs nonces so they need not be stored.
+var nonceKey, opaque = func() ([]byte, string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	o := make([]byte, 16)
+	rand.Read(o)
+	return key, hex.EncodeToString(o)
+}()
+
+// digestAlgorithms are offered in order of preference.
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"SHA-256", sha256.New},
+	{"MD5", md5.New},
+}
+
+func newNonce() string {
+	b := make([]byte, 8, 8+sha256.Size)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Unix()))
+	mac := hmac.New(sha256.New, nonceKey)
+	mac.Write(b)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(b))
+}
+
+// checkNonce verifies a nonce was issued by this process and is still fresh.
+func checkNonce(nonce string) error {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+sha256.Size {
+		return ErrInvalidCredentials
+	}
+	mac := hmac.New(sha256.New, nonceKey)
+	mac.Write(b[:8])
+	if !hmac.Equal(mac.Sum(nil), b[8:]) {
+		return ErrInvalidCredentials
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(b[:8])), 0)
+	if time.Since(issued) > nonceLifetime {
+		return errStaleNonce
+	}
+	return nil
+}
+
+func (s *Scheme) digestChallenges(stale bool) []string {
+	nonce := newNonce()
+	var out []string
+	for _, alg := range digestAlgorithms {
+		c := `Digest realm=` + quote(s.Realm) + `, qop="auth", algorithm=` + alg.name +
+			`, nonce=` + quote(nonce) + `, opaque=` + quote(opaque)
+		if stale {
+			c += `, stale=true`
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// authenticateDigest checks an RFC 7616 Digest response with qop=auth or,
+// for old clients, no qop.
+func (s *Scheme) authenticateDigest(r *http.Request) (*common.User, error) {
+	params := parseParams(r.Header.Get("Authorization")[len("Digest "):])
+
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	session := strings.HasSuffix(strings.ToUpper(algorithm), "-SESS")
+	var newHash func() hash.Hash
+	for _, alg := range digestAlgorithms {
+		if strings.EqualFold(strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS"), alg.name) {
+			newHash = alg.hash
+		}
+	}
+	if newHash == nil || params["realm"] != s.Realm || params["uri"] != r.URL.RequestURI() {
+		return nil, ErrInvalidCredentials
+	}
+	if params["qop"] != "" && params["qop"] != "auth" {
+		return nil, ErrInvalidCredentials
+	}
+
+	password, user, ok := common.LookupPassword(params["username"])
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	h := func(parts ...string) string {
+		d := newHash()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	ha1 := h(params["username"], s.Realm, password)
+	if session {
+		ha1 = h(ha1, params["nonce"], params["cnonce"])
+	}
+	ha2 := h(r.Method, params["uri"])
+	expected := h(ha1, params["nonce"], ha2)
+	if params["qop"] == "auth" {
+		expected = h(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	// only a correct response to an expired nonce is stale
+	if err := checkNonce(params["nonce"]); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import "sync"
+
+// Registry holds the schemes that authenticate each route, replacing the
+// route's default.
+type Registry struct {
+	mu     sync.RWMutex
+	routes map[string][]Scheme
+}
+
+func NewRegistry(routes map[string][]Scheme) *Registry {
+	if routes == nil {
+		routes = map[string][]Scheme{}
+	}
+	return &Registry{routes: routes}
+}
+
+// Routes returns a copy of the schemes keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string][]Scheme {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string][]Scheme, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs the schemes for a route; none removes them.
+func (reg *Registry) SetRoute(route string, schemes []Scheme) error {
+	if err := ValidateSchemes(schemes); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if len(schemes) == 0 {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = schemes
+	return nil
+}
+
+// Resolve returns the schemes of the first of routeKeys that has any.
+func (reg *Registry) Resolve(routeKeys ...string) (string, []Scheme) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if schemes, ok := reg.routes[key]; ok {
+			return key, schemes
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,432 @@
+// Package authserver is a mock OAuth 2.0 authorization server. It issues
+// JWT access tokens for the client_credentials, password, refresh_token and
+// authorization_code (with PKCE) grants, keeping codes and refresh tokens in
+// memory.
+package authserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"mock-server/internal/common"
+	"mock-server/internal/oauth"
+)
+
+// Error is an RFC 6749 error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func errorf(status int, code, format string, args ...any) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...), Status: status}
+}
+
+// TokenResponse is a successful token response.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// Subject is who the token was issued to: a user or, for
+	// client_credentials, the client.
+	Subject string `json:"-"`
+}
+
+// grant is what an authorization code or refresh token stands for.
+type grant struct {
+	clientID  string
+	user      *common.User // nil for the client itself
+	scopes    []string
+	expiresAt time.Time
+	// authTime is when the user signed in, for ID tokens.
+	authTime time.Time
+
+	// authorization codes only
+	redirectURI     string
+	challenge       string
+	challengeMethod string
+	nonce           string
+}
+
+// Server issues tokens for the provider's clients.
+type Server struct {
+	provider *oauth.Provider
+
+	mu       sync.Mutex
+	codes    map[string]*grant
+	refresh  map[string]*grant
+	sessions map[string]*Session
+}
+
+// New returns a server issuing tokens signed by provider.
+func New(provider *oauth.Provider) *Server {
+	return &Server{
+		provider: provider,
+		codes:    make(map[string]*grant),
+		refresh:  make(map[string]*grant),
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Config is the provider's configuration.
+func (s *Server) Config() *oauth.Config {
+	return &s.provider.Config
+}
+
+// Token handles a token request: a form-encoded POST carrying the grant and
+// the client's credentials, in a Basic Authorization header or the form.
+func (s *Server) Token(r *http.Request) (*TokenResponse, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid_request", "malformed form body")
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return nil, err
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if grantType == "" {
+		return nil, errorf(http.StatusBadRequest, "invalid_request", "missing grant_type")
+	}
+	if !client.Allows(grantType) {
+		return nil, errorf(http.StatusBadRequest, "unauthorized_client", "client may not use %s", grantType)
+	}
+
+	switch grantType {
+	case oauth.ClientCredentials:
+		scopes, err := requestedScopes(client, r.PostForm.Get("scope"), client.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		return s.issue(client, &grant{scopes: scopes}, false)
+
+	case oauth.Password:
+		user, err := common.ValidatePassword(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid_grant", "%v", err)
+		}
+		scopes, err := requestedScopes(client, r.PostForm.Get("scope"), client.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		return s.issue(client, &grant{user: user, scopes: scopes, authTime: time.Now()}, client.Allows(oauth.RefreshToken))
+
+	case oauth.RefreshToken:
+		g, err := s.take(s.refresh, r.PostForm.Get("refresh_token"), client)
+		if err != nil {
+			return nil, err
+		}
+		// a refresh may narrow the scopes but never widen them
+		scopes, err := requestedScopes(client, r.PostForm.Get("scope"), g.scopes)
+		if err != nil {
+			return nil, err
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(g.scopes, scope) {
+				return nil, errorf(http.StatusBadRequest, "invalid_scope", "scope %s was not granted", scope)
+			}
+		}
+		return s.issue(client, &grant{user: g.user, scopes: scopes, authTime: g.authTime}, true)
+
+	case oauth.AuthorizationCode:
+		g, err := s.take(s.codes, r.PostForm.Get("code"), client)
+		if err != nil {
+			return nil, err
+		}
+		if g.redirectURI != r.PostForm.Get("redirect_uri") {
+			return nil, errorf(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+		}
+		if err := verifyPKCE(g, r.PostForm.Get("code_verifier")); err != nil {
+			return nil, err
+		}
+		return s.issue(client, g, client.Allows(oauth.RefreshToken))
+	}
+	return nil, errorf(http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type %q", grantType)
+}
+
+func (s *Server) authenticateClient(r *http.Request) (*oauth.Client, error) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		return nil, errorf(http.StatusUnauthorized, "invalid_client", "missing client credentials")
+	}
+
+	client, ok := s.provider.Config.Client(id)
+	if !ok {
+		return nil, errorf(http.StatusUnauthorized, "invalid_client", "unknown client")
+	}
+	if client.Public {
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		return nil, errorf(http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+	}
+	return client, nil
+}
+
+// requestedScopes parses a scope parameter, which must only name scopes the
+// client may request or OpenID Connect scopes. An empty parameter means
+// fallback.
+func requestedScopes(client *oauth.Client, param string, fallback []string) ([]string, error) {
+	scopes := strings.Fields(param)
+	if len(scopes) == 0 {
+		return append([]string(nil), fallback...), nil
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) && !slices.Contains(oauth.OIDCScopes, scope) {
+			return nil, errorf(http.StatusBadRequest, "invalid_scope", "client may not request %s", scope)
+		}
+	}
+	return scopes, nil
+}
+
+// take removes and returns the unexpired grant behind an authorization code
+// or refresh token issued to client. Both are single use.
+func (s *Server) take(grants map[string]*grant, key string, client *oauth.Client) (*grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := grants[key]
+	if !ok || key == "" {
+		return nil, errorf(http.StatusBadRequest, "invalid_grant", "unknown, used or expired grant")
+	}
+	delete(grants, key)
+	if time.Now().After(g.expiresAt) {
+		return nil, errorf(http.StatusBadRequest, "invalid_grant", "grant has expired")
+	}
+	if g.clientID != client.ID {
+		return nil, errorf(http.StatusBadRequest, "invalid_grant", "grant was issued to another client")
+	}
+	return g, nil
+}
+
+func (s *Server) store(grants map[string]*grant, g *grant) string {
+	key := common.NewID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, old := range grants {
+		if now.After(old.expiresAt) {
+			delete(grants, k)
+		}
+	}
+	grants[key] = g
+	return key
+}
+
+// issue signs an access token for the grant's user, or for the client
+// itself when there is none, and an ID token when openid was granted. When
+// refreshable it also stores a refresh token for the grant.
+func (s *Server) issue(client *oauth.Client, g *grant, refreshable bool) (*TokenResponse, error) {
+	cfg := &s.provider.Config
+	now := time.Now()
+	user, scopes := g.user, g.scopes
+
+	claims := oauth.Claims{}
+	for k, v := range cfg.Claims {
+		claims[k] = v
+	}
+	for k, v := range client.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = cfg.Issuer
+	claims["sub"] = client.ID
+	claims["aud"] = client.Audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(client.AccessTokenTTL).Unix()
+	claims["jti"] = common.NewID()
+	claims["client_id"] = client.ID
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	roles := client.Roles
+	if user != nil {
+		claims["sub"] = user.Username
+		claims["preferred_username"] = user.Username
+		claims["email"] = user.Email
+		roles = user.Roles
+	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+
+	token, err := s.provider.Sign(oauth.AccessTokenType, claims)
+	if err != nil {
+		return nil, errorf(http.StatusInternalServerError, "server_error", "%v", err)
+	}
+	resp := &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(client.AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+		Subject:     claims.String("sub"),
+	}
+	if user != nil && slices.Contains(scopes, "openid") {
+		if resp.IDToken, err = s.idToken(client, g, token); err != nil {
+			return nil, errorf(http.StatusInternalServerError, "server_error", "%v", err)
+		}
+	}
+	if refreshable {
+		resp.RefreshToken = s.store(s.refresh, &grant{
+			clientID:  client.ID,
+			user:      user,
+			scopes:    scopes,
+			expiresAt: now.Add(client.RefreshTokenTTL),
+			authTime:  g.authTime,
+		})
+	}
+	return resp, nil
+}
+
+// AuthorizationRequest is a validated authorization_code request.
+type AuthorizationRequest struct {
+	Client              *oauth.Client
+	RedirectURI         string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is echoed in the ID token. Prompt is none (fail unless already
+	// signed in), login (always pick a user) or empty.
+	Nonce  string
+	Prompt string
+
+	// redirectParam is the redirect_uri as sent, which the token request
+	// must repeat.
+	redirectParam string
+}
+
+// ParseAuthorization validates an authorization request. Errors about the
+// client or redirect URI are returned without a request and must be shown
+// to the user; the rest go back to the client with ErrorRedirect.
+func (s *Server) ParseAuthorization(q url.Values) (*AuthorizationRequest, error) {
+	client, ok := s.provider.Config.Client(q.Get("client_id"))
+	if !ok {
+		return nil, errorf(http.StatusBadRequest, "invalid_client", "unknown client")
+	}
+	req := &AuthorizationRequest{Client: client, State: q.Get("state"), redirectParam: q.Get("redirect_uri")}
+	switch {
+	case req.redirectParam != "":
+		if !slices.Contains(client.RedirectURIs, req.redirectParam) {
+			return nil, errorf(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+		}
+		req.RedirectURI = req.redirectParam
+	case len(client.RedirectURIs) == 1:
+		req.RedirectURI = client.RedirectURIs[0]
+	default:
+		return nil, errorf(http.StatusBadRequest, "invalid_request", "missing redirect_uri")
+	}
+
+	if q.Get("response_type") != "code" {
+		return req, errorf(http.StatusBadRequest, "unsupported_response_type", "response_type must be code")
+	}
+	if !client.Allows(oauth.AuthorizationCode) {
+		return req, errorf(http.StatusBadRequest, "unauthorized_client", "client may not use %s", oauth.AuthorizationCode)
+	}
+	scopes, err := requestedScopes(client, q.Get("scope"), client.Scopes)
+	if err != nil {
+		return req, err
+	}
+	req.Scopes = scopes
+
+	req.Nonce, req.Prompt = q.Get("nonce"), q.Get("prompt")
+	switch req.Prompt {
+	case "", "none", "login", "consent", "select_account":
+	default:
+		return req, errorf(http.StatusBadRequest, "invalid_request", "unsupported prompt %q", req.Prompt)
+	}
+
+	req.CodeChallenge, req.CodeChallengeMethod = q.Get("code_challenge"), q.Get("code_challenge_method")
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return req, errorf(http.StatusBadRequest, "invalid_request", "public clients must send a PKCE code_challenge")
+		}
+	} else {
+		if req.CodeChallengeMethod == "" {
+			req.CodeChallengeMethod = "plain"
+		}
+		if req.CodeChallengeMethod != "S256" && req.CodeChallengeMethod != "plain" {
+			return req, errorf(http.StatusBadRequest, "invalid_request", "code_challenge_method must be S256 or plain")
+		}
+	}
+	return req, nil
+}
+
+// IssueCode stores an authorization code for user, who signed in at
+// authTime, and returns the URL the user agent is sent back to.
+func (s *Server) IssueCode(req *AuthorizationRequest, user *common.User, authTime time.Time) string {
+	code := s.store(s.codes, &grant{
+		clientID:        req.Client.ID,
+		user:            user,
+		scopes:          req.Scopes,
+		expiresAt:       time.Now().Add(s.provider.Config.CodeTTL),
+		authTime:        authTime,
+		redirectURI:     req.redirectParam,
+		challenge:       req.CodeChallenge,
+		challengeMethod: req.CodeChallengeMethod,
+		nonce:           req.Nonce,
+	})
+	return req.redirect(url.Values{"code": {code}})
+}
+
+// ErrorRedirect returns the URL that reports err to the client.
+func (req *AuthorizationRequest) ErrorRedirect(err error) string {
+	params := url.Values{"error": {"server_error"}}
+	if e, ok := err.(*Error); ok {
+		params.Set("error", e.Code)
+		if e.Description != "" {
+			params.Set("error_description", e.Description)
+		}
+	}
+	return req.redirect(params)
+}
+
+func (req *AuthorizationRequest) redirect(params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	sep := "?"
+	if strings.Contains(req.RedirectURI, "?") {
+		sep = "&"
+	}
+	return req.RedirectURI + sep + params.Encode()
+}
+
+func verifyPKCE(g *grant, verifier string) error {
+	if g.challenge == "" {
+		return nil
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return errorf(http.StatusBadRequest, "invalid_grant", "code_verifier must be 43 to 128 characters")
+	}
+	expected := verifier
+	if g.challengeMethod == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(g.challenge)) != 1 {
+		return errorf(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+	}
+	return nil
+}
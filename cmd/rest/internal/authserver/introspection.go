@@ -0,0 +1,146 @@
+package authserver
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"mock-server/internal/common"
+	"mock-server/internal/oauth"
+)
+
+// inactive is the introspection response for every token that is unknown,
+// expired or revoked; RFC 7662 says no more.
+var inactive = oauth.Claims{"active": false}
+
+// Introspect handles an RFC 7662 introspection request from an
+// authenticated confidential client; public clients prove nothing about
+// themselves, so they may not ask. Access tokens report their claims,
+// refresh tokens their grant and user-store API tokens their user.
+func (s *Server) Introspect(r *http.Request) (oauth.Claims, error) {
+	token, client, err := s.tokenRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, errorf(http.StatusUnauthorized, "invalid_client", "public clients may not introspect tokens")
+	}
+
+	if g, ok := s.peek(s.refresh, token); ok {
+		resp := oauth.Claims{
+			"active":     true,
+			"token_type": oauth.RefreshToken,
+			"client_id":  g.clientID,
+			"scope":      strings.Join(g.scopes, " "),
+			"exp":        g.expiresAt.Unix(),
+		}
+		if g.user != nil {
+			resp["sub"] = g.user.Username
+			resp["username"] = g.user.Username
+		}
+		return resp, nil
+	}
+
+	if oauth.IsJWT(token) {
+		claims, err := s.provider.Active(token)
+		if err != nil {
+			return inactive, nil
+		}
+		resp := oauth.Claims{"active": true, "token_type": "Bearer"}
+		for k, v := range claims {
+			resp[k] = v
+		}
+		if username := claims.String("preferred_username"); username != "" {
+			resp["username"] = username
+		}
+		return resp, nil
+	}
+
+	user, err := common.ValidateAuth(token)
+	if err != nil {
+		return inactive, nil
+	}
+	return oauth.Claims{
+		"active":     true,
+		"token_type": "Bearer",
+		"sub":        user.Username,
+		"username":   user.Username,
+	}, nil
+}
+
+// Revoke handles an RFC 7009 revocation request. Refresh tokens are
+// forgotten; access tokens and user-store API tokens go on the revocation
+// list, which every service checks. Clients may only revoke tokens issued
+// to them, though confidential clients may also revoke API tokens. Unknown
+// and invalid tokens are ignored, as the RFC asks.
+func (s *Server) Revoke(r *http.Request) error {
+	token, client, err := s.tokenRequest(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	g, ok := s.refresh[token]
+	if ok && g.clientID == client.ID {
+		delete(s.refresh, token)
+	}
+	s.mu.Unlock()
+	if ok {
+		if g.clientID != client.ID {
+			return errorf(http.StatusBadRequest, "unauthorized_client", "token was issued to another client")
+		}
+		return nil
+	}
+
+	var expiresAt time.Time
+	if oauth.IsJWT(token) {
+		claims, err := s.provider.Parse(token)
+		if err != nil || claims.String("iss") != s.provider.Config.Issuer {
+			return nil
+		}
+		if claims.String("client_id") != client.ID {
+			return errorf(http.StatusBadRequest, "unauthorized_client", "token was issued to another client")
+		}
+		if expiresAt, _ = claims.Time("exp"); time.Now().After(expiresAt) {
+			return nil
+		}
+	} else if client.Public {
+		// API tokens are issued to no client, so a public client could
+		// revoke anyone's
+		return errorf(http.StatusBadRequest, "unauthorized_client", "public clients may only revoke tokens issued to them")
+	} else if _, err := common.ValidateAuth(token); err != nil {
+		return nil
+	}
+	if err := s.provider.Revoke(oauth.TokenID(token), expiresAt); err != nil {
+		return errorf(http.StatusInternalServerError, "server_error", "%v", err)
+	}
+	return nil
+}
+
+// tokenRequest authenticates the client of an introspection or revocation
+// request and returns the token it is about.
+func (s *Server) tokenRequest(r *http.Request) (string, *oauth.Client, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", nil, errorf(http.StatusBadRequest, "invalid_request", "malformed form body")
+	}
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return "", nil, err
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		return "", nil, errorf(http.StatusBadRequest, "invalid_request", "missing token")
+	}
+	return token, client, nil
+}
+
+// peek returns a live grant without using it up.
+func (s *Server) peek(grants map[string]*grant, key string) (*grant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := grants[key]
+	if !ok || time.Now().After(g.expiresAt) {
+		return nil, false
+	}
+	return g, true
+}
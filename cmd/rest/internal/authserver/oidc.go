@@ -0,0 +1,201 @@
+package authserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"mock-server/internal/common"
+	"mock-server/internal/oauth"
+)
+
+// Session is a user's sign-in at the authorization endpoint, which lets
+// later authorization requests skip the login page.
+type Session struct {
+	ID       string
+	User     *common.User
+	AuthTime time.Time
+
+	expiresAt time.Time
+}
+
+// StartSession signs user in for the configured session lifetime.
+func (s *Server) StartSession(user *common.User) *Session {
+	now := time.Now()
+	session := &Session{ID: common.NewID(), User: user, AuthTime: now, expiresAt: now.Add(s.provider.Config.SessionTTL)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, old := range s.sessions {
+		if now.After(old.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[session.ID] = session
+	return session
+}
+
+// Session returns a live session with the user's current details. Sessions
+// of users who may no longer authenticate are ended.
+func (s *Server) Session(id string) (*Session, bool) {
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok || time.Now().After(session.expiresAt) {
+		return nil, false
+	}
+	user, err := common.SelectUser(session.User.Username)
+	if err != nil {
+		s.EndSession(id)
+		return nil, false
+	}
+	return &Session{ID: id, User: user, AuthTime: session.AuthTime, expiresAt: session.expiresAt}, true
+}
+
+// EndSession signs a session out.
+func (s *Server) EndSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// idToken signs the OpenID Connect ID token that accompanies accessToken.
+func (s *Server) idToken(client *oauth.Client, g *grant, accessToken string) (string, error) {
+	cfg := &s.provider.Config
+	now := time.Now()
+	hash := sha256.Sum256([]byte(accessToken))
+
+	claims := oauth.Claims{
+		"iss":     cfg.Issuer,
+		"sub":     g.user.Username,
+		"aud":     client.ID,
+		"azp":     client.ID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(client.AccessTokenTTL).Unix(),
+		"at_hash": base64.RawURLEncoding.EncodeToString(hash[:len(hash)/2]),
+	}
+	if !g.authTime.IsZero() {
+		claims["auth_time"] = g.authTime.Unix()
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	for k, v := range userClaims(g.user, g.scopes) {
+		claims[k] = v
+	}
+	return s.provider.Sign(oauth.IDTokenType, claims)
+}
+
+// userClaims are the claims about user that scopes release.
+func userClaims(user *common.User, scopes []string) oauth.Claims {
+	claims := oauth.Claims{"sub": user.Username}
+	if slices.Contains(scopes, "profile") {
+		claims["preferred_username"] = user.Username
+		if len(user.Roles) > 0 {
+			claims["roles"] = user.Roles
+		}
+	}
+	if slices.Contains(scopes, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = true
+	}
+	return claims
+}
+
+// UserInfo returns the claims about the user an access token was issued to.
+// The token must have been granted the openid scope.
+func (s *Server) UserInfo(token string) (oauth.Claims, error) {
+	user, err := common.ValidateAuth(token)
+	if err != nil {
+		return nil, errorf(http.StatusUnauthorized, "invalid_token", "%v", err)
+	}
+	if !slices.Contains(user.Scopes, "openid") {
+		return nil, errorf(http.StatusForbidden, "insufficient_scope", "token was not granted openid")
+	}
+	scopes := user.Scopes
+	if stored, ok := common.LookupUser(user.Username); ok {
+		user = stored
+	}
+	return userClaims(user, scopes), nil
+}
+
+// Discovery is the OpenID Provider metadata served at
+// /.well-known/openid-configuration.
+func (s *Server) Discovery() map[string]any {
+	cfg := &s.provider.Config
+	scopes := slices.Clone(oauth.OIDCScopes)
+	for _, client := range cfg.Clients {
+		for _, scope := range client.Scopes {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return map[string]any{
+		"issuer":                                cfg.Issuer,
+		"authorization_endpoint":                cfg.Issuer + "/oauth/authorize",
+		"token_endpoint":                        cfg.Issuer + "/oauth/token",
+		"userinfo_endpoint":                     cfg.Issuer + "/oauth/userinfo",
+		"jwks_uri":                              cfg.Issuer + "/oauth/jwks",
+		"end_session_endpoint":                  cfg.Issuer + "/oauth/logout",
+		"introspection_endpoint":                cfg.Issuer + "/oauth/introspect",
+		"revocation_endpoint":                   cfg.Issuer + "/oauth/revoke",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 []string{oauth.AuthorizationCode, oauth.ClientCredentials, oauth.Password, oauth.RefreshToken},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{oauth.RS256, oauth.ES256},
+		"scopes_supported":                      scopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"prompt_values_supported":               []string{"none", "login", "consent", "select_account"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "azp", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"preferred_username", "email", "email_verified", "roles",
+		},
+	}
+}
+
+// Logout validates an RP-initiated logout request and returns where to send
+// the user agent afterwards, or "" when the request named nowhere. The
+// caller ends the session.
+func (s *Server) Logout(q url.Values) (string, error) {
+	clientID := q.Get("client_id")
+	if hint := q.Get("id_token_hint"); hint != "" {
+		// Expired ID tokens are fine as hints, so only the signature and
+		// issuer are checked.
+		claims, err := s.provider.Parse(hint)
+		if err != nil || claims.String("iss") != s.provider.Config.Issuer {
+			return "", errorf(http.StatusBadRequest, "invalid_request", "id_token_hint is not an ID token from this issuer")
+		}
+		aud := claims.Strings("aud")
+		if clientID != "" && !slices.Contains(aud, clientID) {
+			return "", errorf(http.StatusBadRequest, "invalid_request", "id_token_hint was not issued to %s", clientID)
+		}
+		if clientID == "" && len(aud) > 0 {
+			clientID = aud[0]
+		}
+	}
+
+	target := q.Get("post_logout_redirect_uri")
+	if target == "" {
+		return "", nil
+	}
+	client, ok := s.provider.Config.Client(clientID)
+	if !ok {
+		return "", errorf(http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri needs id_token_hint or client_id")
+	}
+	if !slices.Contains(client.PostLogoutRedirectURIs, target) {
+		return "", errorf(http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri is not registered for the client")
+	}
+	if state := q.Get("state"); state != "" {
+		req := &AuthorizationRequest{RedirectURI: target, State: state}
+		return req.redirect(url.Values{}), nil
+	}
+	return target, nil
+}
+
+// ErrLoginRequired is the error for prompt=none requests without a session.
+var ErrLoginRequired = &Error{Code: "login_required", Description: "no user is signed in", Status: http.StatusBadRequest}
@@ -0,0 +1,169 @@
+// Package caching gives responses HTTP validators and Cache-Control
+// policies, and evaluates the conditional request headers of RFC 9110:
+// If-None-Match and If-Modified-Since for reads, If-Match and
+// If-Unmodified-Since for updates.
+package caching
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPreconditionRequired means an update was sent without If-Match or
+	// If-Unmodified-Since while they are required.
+	ErrPreconditionRequired = errors.New("precondition required")
+	// ErrPreconditionFailed means the resource changed since the client
+	// last saw it.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Policy is the caching policy of a route or stub.
+type Policy struct {
+	// CacheControl is sent as the Cache-Control header of successful
+	// responses, e.g. "private, max-age=60, must-revalidate".
+	CacheControl string `yaml:"cache_control" json:"cacheControl,omitempty"`
+	// RequireIfMatch refuses updates through the route without If-Match
+	// or If-Unmodified-Since with 428, whatever the global setting.
+	RequireIfMatch bool `yaml:"require_if_match" json:"requireIfMatch,omitempty"`
+}
+
+var directive = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+(=("[^"]*"|[A-Za-z0-9!#$%&'*+.^_|~-]+))?$`)
+
+// Validate checks that the policy does something and that its
+// Cache-Control value is a list of directives.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.CacheControl == "" {
+		if !p.RequireIfMatch {
+			return fmt.Errorf("policy needs a cache control or require_if_match")
+		}
+		return nil
+	}
+	return ValidateCacheControl(p.CacheControl)
+}
+
+// ValidateCacheControl checks the syntax of a Cache-Control value.
+func ValidateCacheControl(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("cache control must not be empty")
+	}
+	for _, d := range strings.Split(value, ",") {
+		if !directive.MatchString(strings.TrimSpace(d)) {
+			return fmt.Errorf("invalid cache control directive %q", strings.TrimSpace(d))
+		}
+	}
+	return nil
+}
+
+// Cacheable reports whether a response with status may carry a policy and
+// validators: successful responses and 304s.
+func Cacheable(status int) bool {
+	return (status >= 200 && status < 300) || status == http.StatusNotModified
+}
+
+// ETag returns a strong entity tag for content.
+func ETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Validators identify the state of a resource. Either may be unset.
+type Validators struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// Write sets the ETag and Last-Modified headers.
+func (v Validators) Write(h http.Header) {
+	if v.ETag != "" {
+		h.Set("ETag", v.ETag)
+	}
+	if !v.LastModified.IsZero() {
+		h.Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// modified is truncated to the second resolution of HTTP dates.
+func (v Validators) modified() time.Time {
+	return v.LastModified.Truncate(time.Second)
+}
+
+// NotModified reports whether a GET or HEAD of a resource with validators v
+// can be answered with 304. If-None-Match takes precedence over
+// If-Modified-Since, as RFC 9110 requires.
+func NotModified(r *http.Request, v Validators) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return v.ETag != "" && matchTags(inm, v.ETag, false)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !v.LastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !v.modified().After(since)
+	}
+	return false
+}
+
+// WriteNotModified answers 304 with the resource's validators.
+func WriteNotModified(w http.ResponseWriter, v Validators) {
+	v.Write(w.Header())
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// CheckPreconditions evaluates If-Match and If-Unmodified-Since for an
+// update of a resource whose current validators are v. With required set, a
+// request carrying neither fails with ErrPreconditionRequired.
+func CheckPreconditions(r *http.Request, v Validators, required bool) error {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchTags(im, v.ETag, true) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		since, err := http.ParseTime(ius)
+		if err != nil {
+			// an invalid date is ignored
+			return nil
+		}
+		if v.modified().After(since) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+	if required {
+		return ErrPreconditionRequired
+	}
+	return nil
+}
+
+// matchTags compares etag against a list of entity tags or "*". Strong
+// comparison, used by If-Match, never matches weak tags.
+func matchTags(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if strong && strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package caching
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var modified = time.Date(2025, 6, 1, 12, 0, 0, 500, time.UTC)
+
+func request(method string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(method, "/customers/1", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	v := Validators{ETag: `"abc"`, LastModified: modified}
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	at := modified.Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		required bool
+		want     error
+	}{
+		{"no headers", nil, false, nil},
+		{"no headers when required", nil, true, ErrPreconditionRequired},
+		{"matching tag", map[string]string{"If-Match": `"abc"`}, true, nil},
+		{"one of several tags", map[string]string{"If-Match": `"x", "abc"`}, true, nil},
+		{"any tag", map[string]string{"If-Match": "*"}, true, nil},
+		{"stale tag", map[string]string{"If-Match": `"old"`}, true, ErrPreconditionFailed},
+		{"weak tag never matches strongly", map[string]string{"If-Match": `W/"abc"`}, true, ErrPreconditionFailed},
+		{"unmodified since", map[string]string{"If-Unmodified-Since": at}, true, nil},
+		{"modified since", map[string]string{"If-Unmodified-Since": before}, true, ErrPreconditionFailed},
+		{"invalid date is ignored", map[string]string{"If-Unmodified-Since": "yesterday"}, true, nil},
+		{"If-Match takes precedence", map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckPreconditions(request(http.MethodPut, tt.headers), v, tt.required); got != tt.want {
+				t.Errorf("CheckPreconditions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	v := Validators{ETag: `"abc"`, LastModified: modified}
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	at := modified.Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"no headers", http.MethodGet, nil, false},
+		{"matching tag", http.MethodGet, map[string]string{"If-None-Match": `"abc"`}, true},
+		{"weak tag matches weakly", http.MethodGet, map[string]string{"If-None-Match": `W/"abc"`}, true},
+		{"different tag", http.MethodGet, map[string]string{"If-None-Match": `"old"`}, false},
+		{"head", http.MethodHead, map[string]string{"If-None-Match": `"abc"`}, true},
+		{"not a read", http.MethodPut, map[string]string{"If-None-Match": `"abc"`}, false},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": at}, true},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": before}, false},
+		{"If-None-Match takes precedence", http.MethodGet, map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": at}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotModified(request(tt.method, tt.headers), v); got != tt.want {
+				t.Errorf("NotModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy  *Policy
+		wantErr bool
+	}{
+		{nil, false},
+		{&Policy{CacheControl: "private, max-age=60, must-revalidate"}, false},
+		{&Policy{CacheControl: `no-cache="Set-Cookie"`}, false},
+		{&Policy{RequireIfMatch: true}, false},
+		{&Policy{}, true},
+		{&Policy{CacheControl: "max-age=60;"}, true},
+		{&Policy{CacheControl: " , "}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRequiresIfMatch(t *testing.T) {
+	reg := NewRegistry(false, map[string]*Policy{
+		"PUT /customers/{id}": {RequireIfMatch: true},
+		"/health":             {CacheControl: "no-store"},
+	})
+	tests := []struct {
+		keys []string
+		want bool
+	}{
+		{[]string{"PUT /customers/{id}", "/customers/{id}"}, true},
+		{[]string{"PATCH /customers/{id}", "/customers/{id}"}, false},
+		{[]string{"GET /health", "/health"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := reg.RequiresIfMatch(tt.keys...); got != tt.want {
+			t.Errorf("RequiresIfMatch(%v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+
+	reg.SetRequireIfMatch(true)
+	if !reg.RequiresIfMatch("PATCH /customers/{id}", "/customers/{id}") {
+		t.Error("RequiresIfMatch = false once required everywhere")
+	}
+}
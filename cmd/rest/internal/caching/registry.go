@@ -0,0 +1,80 @@
+package caching
+
+import "sync"
+
+// Registry holds the per-route policies and whether updates must be
+// conditional.
+type Registry struct {
+	mu             sync.RWMutex
+	requireIfMatch bool
+	routes         map[string]*Policy
+}
+
+func NewRegistry(requireIfMatch bool, routes map[string]*Policy) *Registry {
+	if routes == nil {
+		routes = map[string]*Policy{}
+	}
+	return &Registry{requireIfMatch: requireIfMatch, routes: routes}
+}
+
+// RequireIfMatch reports whether updates without If-Match or
+// If-Unmodified-Since are refused.
+func (reg *Registry) RequireIfMatch() bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.requireIfMatch
+}
+
+// RequiresIfMatch reports whether updates through the route identified by
+// routeKeys must be conditional, either everywhere or by its policy.
+func (reg *Registry) RequiresIfMatch(routeKeys ...string) bool {
+	if reg.RequireIfMatch() {
+		return true
+	}
+	_, p := reg.Resolve(routeKeys...)
+	return p != nil && p.RequireIfMatch
+}
+
+func (reg *Registry) SetRequireIfMatch(required bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.requireIfMatch = required
+}
+
+// Routes returns a copy of the per-route policies keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string]*Policy {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]*Policy, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs a policy for a route; nil removes it.
+func (reg *Registry) SetRoute(route string, p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if p == nil {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = p
+	return nil
+}
+
+// Resolve returns the policy of the first of routeKeys that has one.
+func (reg *Registry) Resolve(routeKeys ...string) (string, *Policy) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if p, ok := reg.routes[key]; ok {
+			return key, p
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mock-server/cmd/rest/internal/auth"
+	"mock-server/cmd/rest/internal/caching"
+	"mock-server/cmd/rest/internal/faults"
+	"mock-server/cmd/rest/internal/jobs"
+	"mock-server/cmd/rest/internal/ratelimit"
+	"mock-server/cmd/rest/internal/sequence"
+	"mock-server/cmd/rest/internal/stream"
+	"mock-server/cmd/rest/internal/webhook"
+	"mock-server/internal/certs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the REST service configuration, loaded from the YAML file named
+// by the REST_CONFIG environment variable.
+type Config struct {
+	StubsDir     string      `yaml:"stubs_dir"`
+	JournalLimit int         `yaml:"journal_limit"`
+	NearMisses   int         `yaml:"near_misses"`
+	Proxy        Proxy       `yaml:"proxy"`
+	Faults       Faults      `yaml:"faults"`
+	RateLimits   RateLimits  `yaml:"rate_limits"`
+	Caching      Caching     `yaml:"caching"`
+	Idempotency  Idempotency `yaml:"idempotency"`
+	Auth         Auth        `yaml:"auth"`
+	OpenAPI      OpenAPI     `yaml:"openapi"`
+	Validation   Validation  `yaml:"validation"`
+	// Sequences serve built-in routes from a list of responses in turn,
+	// keyed like fault routes.
+	Sequences map[string]*sequence.Route `yaml:"sequences"`
+	TLS       certs.Settings             `yaml:"tls"`
+	Webhooks  Webhooks                   `yaml:"webhooks"`
+	Jobs      Jobs                       `yaml:"jobs"`
+	// Streams are SSE and WebSocket endpoints keyed by path.
+	Streams map[string]*stream.Endpoint `yaml:"streams"`
+}
+
+// Jobs configures built-in routes that accept work with 202 and complete it
+// later.
+type Jobs struct {
+	// HistoryLimit bounds how many jobs are kept.
+	HistoryLimit int                         `yaml:"history_limit"`
+	Routes       map[string]*jobs.Definition `yaml:"routes"`
+}
+
+// Webhooks configures outbound callbacks sent after built-in routes respond.
+type Webhooks struct {
+	// HistoryLimit bounds how many deliveries the admin API can list.
+	HistoryLimit int                           `yaml:"history_limit"`
+	Routes       map[string][]webhook.Callback `yaml:"routes"`
+}
+
+// Validation checks requests against the built-in routes' OpenAPI document
+// and the configured one. Strict mode also checks the mock's own responses.
+type Validation struct {
+	Enabled bool `yaml:"enabled"`
+	Strict  bool `yaml:"strict"`
+}
+
+// OpenAPI points the service at an OpenAPI 3 document whose operations are
+// mocked alongside the built-in routes.
+type OpenAPI struct {
+	Spec string `yaml:"spec"`
+	// BasePath overrides the path of the document's first server URL.
+	BasePath string `yaml:"base_path"`
+}
+
+// Faults configures latency and failure injection. Routes are keyed by
+// "METHOD /template" (or just "/template" for every method).
+type Faults struct {
+	AllowRequestHeaders bool                        `yaml:"allow_request_headers"`
+	Global              *faults.Settings            `yaml:"global"`
+	Routes              map[string]*faults.Settings `yaml:"routes"`
+}
+
+// RateLimits configures simulated rate limiting. Routes override the global
+// policy and are keyed like fault routes.
+type RateLimits struct {
+	Global *ratelimit.Policy            `yaml:"global"`
+	Routes map[string]*ratelimit.Policy `yaml:"routes"`
+}
+
+// Caching configures conditional requests on the customer routes and the
+// Cache-Control policies of built-in routes, keyed like fault routes.
+type Caching struct {
+	// RequireIfMatch refuses every update without If-Match or
+	// If-Unmodified-Since with 428; routes can opt in on their own.
+	RequireIfMatch bool                       `yaml:"require_if_match"`
+	Routes         map[string]*caching.Policy `yaml:"routes"`
+}
+
+// Auth configures how built-in routes authenticate. Routes are keyed like
+// fault routes and list schemes any of which may authenticate a request;
+// they replace the bearer token the customer and echo routes require by
+// default.
+type Auth struct {
+	Routes map[string][]auth.Scheme `yaml:"routes"`
+}
+
+// Idempotency configures how long responses to POST and PATCH requests with
+// an Idempotency-Key are kept for replay.
+type Idempotency struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Proxy configures forwarding unmatched requests to a real upstream and
+// recording the exchanges as stub files.
+type Proxy struct {
+	// Mode is one of "", "proxy", "record" or "playback".
+	Mode          string        `yaml:"mode"`
+	Upstream      string        `yaml:"upstream"`
+	Timeout       time.Duration `yaml:"timeout"`
+	RecordingsDir string        `yaml:"recordings_dir"`
+
+	// CaptureHeaders are request headers that become part of a recorded
+	// stub's request pattern.
+	CaptureHeaders []string `yaml:"capture_headers"`
+	// IgnoreHeaders are response headers left out of recordings.
+	IgnoreHeaders []string `yaml:"ignore_headers"`
+	// RedactHeaders are kept in recordings with their value masked.
+	RedactHeaders []string `yaml:"redact_headers"`
+	// IgnoreBodyFields are JSON fields ignored when matching recorded
+	// request bodies and dropped from recorded response bodies.
+	IgnoreBodyFields []string `yaml:"ignore_body_fields"`
+	// RedactBodyFields are JSON fields whose values are masked in recordings.
+	RedactBodyFields []string `yaml:"redact_body_fields"`
+}
+
+func defaults() *Config {
+	return &Config{
+		JournalLimit: 1000,
+		NearMisses:   3,
+		Webhooks:     Webhooks{HistoryLimit: 500},
+		Jobs:         Jobs{HistoryLimit: 500},
+		Idempotency:  Idempotency{TTL: 24 * time.Hour},
+		Proxy: Proxy{
+			Timeout:       30 * time.Second,
+			IgnoreHeaders: []string{"Date", "Server"},
+			RedactHeaders: []string{"Authorization", "Cookie", "Set-Cookie"},
+		},
+	}
+}
+
+// Load reads the file named by REST_CONFIG. An unset variable is not an error;
+// the service simply runs with the defaults.
+func Load() (*Config, error) {
+	cfg := defaults()
+
+	path := os.Getenv("REST_CONFIG")
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	// relative paths in the config are resolved against the config file itself
+	base := filepath.Dir(path)
+	cfg.StubsDir = resolve(base, cfg.StubsDir)
+	cfg.Proxy.RecordingsDir = resolve(base, cfg.Proxy.RecordingsDir)
+	cfg.OpenAPI.Spec = resolve(base, cfg.OpenAPI.Spec)
+	cfg.TLS.Resolve(base)
+	if cfg.Proxy.RecordingsDir == "" && cfg.StubsDir != "" {
+		cfg.Proxy.RecordingsDir = filepath.Join(cfg.StubsDir, "recordings")
+	}
+
+	switch cfg.Proxy.Mode {
+	case "", "proxy", "record", "playback":
+	default:
+		return nil, fmt.Errorf("unknown proxy mode %q", cfg.Proxy.Mode)
+	}
+	if (cfg.Proxy.Mode == "proxy" || cfg.Proxy.Mode == "record") && cfg.Proxy.Upstream == "" {
+		return nil, fmt.Errorf("proxy mode %q requires an upstream", cfg.Proxy.Mode)
+	}
+
+	if err := cfg.Faults.Global.Validate(); err != nil {
+		return nil, fmt.Errorf("faults.global: %w", err)
+	}
+	for route, s := range cfg.Faults.Routes {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("faults.routes[%s]: %w", route, err)
+		}
+	}
+	if err := cfg.TLS.Validate(); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	if err := cfg.RateLimits.Global.Validate(); err != nil {
+		return nil, fmt.Errorf("rate_limits.global: %w", err)
+	}
+	for route, p := range cfg.RateLimits.Routes {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("rate_limits.routes[%s]: %w", route, err)
+		}
+	}
+	if cfg.Idempotency.TTL <= 0 {
+		return nil, fmt.Errorf("idempotency.ttl must be positive")
+	}
+	for route, schemes := range cfg.Auth.Routes {
+		if err := auth.ValidateSchemes(schemes); err != nil {
+			return nil, fmt.Errorf("auth.routes[%s]%w", route, err)
+		}
+	}
+	for route, p := range cfg.Caching.Routes {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("caching.routes[%s]: %w", route, err)
+		}
+	}
+	for path, e := range cfg.Streams {
+		if err := e.Validate(); err != nil {
+			return nil, fmt.Errorf("streams[%s]: %w", path, err)
+		}
+	}
+	for route, def := range cfg.Jobs.Routes {
+		if err := def.Validate(); err != nil {
+			return nil, fmt.Errorf("jobs.routes[%s]: %w", route, err)
+		}
+	}
+	for route, callbacks := range cfg.Webhooks.Routes {
+		for i := range callbacks {
+			if err := callbacks[i].Validate(); err != nil {
+				return nil, fmt.Errorf("webhooks.routes[%s][%d]: %w", route, i, err)
+			}
+		}
+	}
+	for route, seq := range cfg.Sequences {
+		if err := seq.Validate(); err != nil {
+			return nil, fmt.Errorf("sequences[%s]: %w", route, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func resolve(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
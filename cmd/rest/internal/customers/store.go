@@ -0,0 +1,324 @@
+package customers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	M "mock-server/internal/common/models"
+)
+
+// ErrNotFound is returned for operations on a customer that does not exist.
+var ErrNotFound = errors.New("customer not found")
+
+// FieldError describes why one field of a customer was rejected.
+type FieldError struct {
+	Field  string `json:"field" yaml:"field" xml:"field"`
+	Reason string `json:"reason" yaml:"reason" xml:"reason"`
+}
+
+// ValidationError lists every invalid field of a create or update.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fe.Field+": "+fe.Reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// maxNameLength bounds names so clients can exercise length validation.
+const maxNameLength = 100
+
+// Validate checks the fields clients may set.
+func Validate(c M.Customer) error {
+	var errs []FieldError
+	if strings.TrimSpace(c.Cust_Type) == "" {
+		errs = append(errs, FieldError{Field: "type", Reason: "is required"})
+	}
+	if len(c.Name) > maxNameLength {
+		errs = append(errs, FieldError{Field: "name", Reason: fmt.Sprintf("must be at most %d characters", maxNameLength)})
+	}
+	if c.Email != "" {
+		if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != c.Email {
+			errs = append(errs, FieldError{Field: "email", Reason: "must be a valid email address"})
+		}
+	}
+	if errs != nil {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Precondition is checked against the current customer and the time it
+// last changed before an update is applied, under the store's lock. An
+// error aborts the update and is returned to the caller.
+type Precondition func(current M.Customer, modified time.Time) error
+
+// Store holds customers in memory, safe for concurrent use.
+type Store struct {
+	mu        sync.RWMutex
+	customers map[int]M.Customer
+	modified  map[int]time.Time
+	// changed is when any customer was last created, updated or deleted.
+	changed time.Time
+	nextID  int
+}
+
+// NewStore creates a store holding seed.
+func NewStore(seed []M.Customer) *Store {
+	now := time.Now()
+	s := &Store{customers: map[int]M.Customer{}, modified: map[int]time.Time{}, changed: now, nextID: 1}
+	for _, c := range seed {
+		s.customers[c.ID] = c
+		s.modified[c.ID] = now
+		if c.ID >= s.nextID {
+			s.nextID = c.ID + 1
+		}
+	}
+	return s
+}
+
+// Get returns the customer with id.
+func (s *Store) Get(id int) (M.Customer, bool) {
+	c, _, ok := s.Lookup(id)
+	return c, ok
+}
+
+// Lookup returns the customer with id and when it last changed.
+func (s *Store) Lookup(id int) (M.Customer, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.customers[id]
+	return c, s.modified[id], ok
+}
+
+// Changed returns when any customer was last created, updated or deleted.
+func (s *Store) Changed() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+func (s *Store) put(c M.Customer) {
+	s.changed = time.Now()
+	s.customers[c.ID] = c
+	s.modified[c.ID] = s.changed
+}
+
+// check runs pre, if any, against the stored customer with id.
+func (s *Store) check(id int, pre Precondition) (M.Customer, error) {
+	current, ok := s.customers[id]
+	if !ok {
+		return M.Customer{}, ErrNotFound
+	}
+	if pre != nil {
+		if err := pre(current, s.modified[id]); err != nil {
+			return M.Customer{}, err
+		}
+	}
+	return current, nil
+}
+
+// Create validates c and stores it under a new ID. Any ID in c is ignored.
+func (s *Store) Create(c M.Customer) (M.Customer, error) {
+	if err := Validate(c); err != nil {
+		return M.Customer{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.ID = s.nextID
+	s.nextID++
+	s.put(c)
+	return c, nil
+}
+
+// Replace overwrites every field of the customer with id once pre, if any,
+// is satisfied.
+func (s *Store) Replace(id int, c M.Customer, pre Precondition) (M.Customer, error) {
+	if c.ID != 0 && c.ID != id {
+		return M.Customer{}, &ValidationError{Errors: []FieldError{{Field: "id", Reason: "does not match the customer being updated"}}}
+	}
+	c.ID = id
+	if err := Validate(c); err != nil {
+		return M.Customer{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.check(id, pre); err != nil {
+		return M.Customer{}, err
+	}
+	s.put(c)
+	return c, nil
+}
+
+// Patch applies an RFC 7396 JSON Merge Patch to the customer with id. The
+// read, merge and write happen under one lock so concurrent patches to the
+// same customer do not lose updates. pre, if any, must be satisfied first.
+func (s *Store) Patch(id int, patch []byte, pre Precondition) (M.Customer, error) {
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return M.Customer{}, &ValidationError{Errors: []FieldError{{Field: "body", Reason: "is not valid JSON"}}}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.check(id, pre)
+	if err != nil {
+		return M.Customer{}, err
+	}
+
+	doc, err := toMap(current)
+	if err != nil {
+		return M.Customer{}, err
+	}
+	merged, ok := MergePatch(doc, changes).(map[string]interface{})
+	if !ok {
+		return M.Customer{}, &ValidationError{Errors: []FieldError{{Field: "body", Reason: "must be a JSON object"}}}
+	}
+
+	var updated M.Customer
+	data, _ := json.Marshal(merged)
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return M.Customer{}, &ValidationError{Errors: []FieldError{{Field: "body", Reason: err.Error()}}}
+	}
+	if updated.ID != id {
+		return M.Customer{}, &ValidationError{Errors: []FieldError{{Field: "id", Reason: "cannot be changed"}}}
+	}
+	if err := Validate(updated); err != nil {
+		return M.Customer{}, err
+	}
+	s.put(updated)
+	return updated, nil
+}
+
+// Delete removes the customer with id once pre, if any, is satisfied. It
+// returns ErrNotFound when there is no such customer.
+func (s *Store) Delete(id int, pre Precondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.check(id, pre); err != nil {
+		return err
+	}
+	delete(s.customers, id)
+	delete(s.modified, id)
+	s.changed = time.Now()
+	return nil
+}
+
+// MergePatch applies patch to target as described by RFC 7396: null removes
+// a member, objects merge recursively and anything else replaces the target.
+func MergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = MergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
+
+func toMap(c M.Customer) (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	return m, json.Unmarshal(data, &m)
+}
+
+// Query selects a page of customers. Filters match case-insensitively:
+// Type exactly, Name and Email as substrings. Sort lists fields, each
+// optionally prefixed with "-" for descending order. Pages count from 1;
+// a PerPage of zero returns every match.
+type Query struct {
+	Type    string
+	Name    string
+	Email   string
+	Sort    []string
+	Page    int
+	PerPage int
+}
+
+// SortFields are the fields a list can be ordered by.
+var SortFields = map[string]func(a, b M.Customer) int{
+	"id":    func(a, b M.Customer) int { return a.ID - b.ID },
+	"name":  func(a, b M.Customer) int { return compareFold(a.Name, b.Name) },
+	"type":  func(a, b M.Customer) int { return compareFold(a.Cust_Type, b.Cust_Type) },
+	"email": func(a, b M.Customer) int { return compareFold(a.Email, b.Email) },
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// List returns the requested page and the number of customers matching the
+// filters across all pages. Results are ordered by ID unless sorted otherwise.
+func (s *Store) List(q Query) ([]M.Customer, int) {
+	s.mu.RLock()
+	matched := make([]M.Customer, 0, len(s.customers))
+	for _, c := range s.customers {
+		if q.matches(c) {
+			matched = append(matched, c)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		for _, field := range q.Sort {
+			desc := strings.HasPrefix(field, "-")
+			cmp, ok := SortFields[strings.TrimPrefix(field, "-")]
+			if !ok {
+				continue
+			}
+			if d := cmp(matched[i], matched[j]); d != 0 {
+				return (d < 0) != desc
+			}
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	total := len(matched)
+	if q.PerPage <= 0 {
+		return matched, total
+	}
+	// Compare page counts rather than offsets so a huge page cannot
+	// overflow into a negative start.
+	if q.Page < 1 || q.Page-1 >= (total+q.PerPage-1)/q.PerPage {
+		return []M.Customer{}, total
+	}
+	start := (q.Page - 1) * q.PerPage
+	return matched[start:min(start+q.PerPage, total)], total
+}
+
+func (q Query) matches(c M.Customer) bool {
+	if q.Type != "" && !strings.EqualFold(c.Cust_Type, q.Type) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(c.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.Email != "" && !strings.Contains(strings.ToLower(c.Email), strings.ToLower(q.Email)) {
+		return false
+	}
+	return true
+}
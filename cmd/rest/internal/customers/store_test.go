@@ -0,0 +1,162 @@
+package customers
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	M "mock-server/internal/common/models"
+)
+
+var seed = []M.Customer{
+	{ID: 1, Name: "Alice Smith", Cust_Type: "Regular", Email: "alice@example.com"},
+	{ID: 2, Name: "bob jones", Cust_Type: "Premium", Email: "bob@example.com"},
+	{ID: 3, Name: "Charlie Brown", Cust_Type: "Regular", Email: "charlie@example.org"},
+	{ID: 4, Cust_Type: "Closed"},
+	{ID: 5, Name: "Dana Smith", Cust_Type: "premium"},
+}
+
+func ids(cs []M.Customer) []int {
+	out := make([]int, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func TestListPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		q         Query
+		wantIDs   []int
+		wantTotal int
+	}{
+		{"first page", Query{Page: 1, PerPage: 2}, []int{1, 2}, 5},
+		{"middle page", Query{Page: 2, PerPage: 2}, []int{3, 4}, 5},
+		{"partial last page", Query{Page: 3, PerPage: 2}, []int{5}, 5},
+		{"past the end", Query{Page: 4, PerPage: 2}, []int{}, 5},
+		{"unpaged", Query{}, []int{1, 2, 3, 4, 5}, 5},
+		{"page zero", Query{Page: 0, PerPage: 2}, []int{}, 5},
+		{"offset would overflow", Query{Page: math.MaxInt, PerPage: 100}, []int{}, 5},
+		{"offset just overflows", Query{Page: math.MaxInt/100 + 2, PerPage: 100}, []int{}, 5},
+		{"filtered", Query{Type: "premium", Page: 1, PerPage: 10}, []int{2, 5}, 2},
+		{"name substring", Query{Name: "SMITH", Page: 1, PerPage: 10}, []int{1, 5}, 2},
+		{"email substring", Query{Email: "example.org", Page: 1, PerPage: 10}, []int{3}, 1},
+		{"no match", Query{Type: "gold", Page: 1, PerPage: 10}, []int{}, 0},
+	}
+	s := NewStore(seed)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := s.List(tt.q)
+			if !reflect.DeepEqual(ids(got), tt.wantIDs) || total != tt.wantTotal {
+				t.Errorf("List(%+v) = %v, %d; want %v, %d", tt.q, ids(got), total, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestListSort(t *testing.T) {
+	tests := []struct {
+		sort []string
+		want []int
+	}{
+		{nil, []int{1, 2, 3, 4, 5}},
+		{[]string{"-id"}, []int{5, 4, 3, 2, 1}},
+		{[]string{"name"}, []int{4, 1, 2, 3, 5}},
+		{[]string{"-name"}, []int{5, 3, 2, 1, 4}},
+		{[]string{"type", "-id"}, []int{4, 5, 2, 3, 1}},
+		{[]string{"unknown"}, []int{1, 2, 3, 4, 5}},
+	}
+	s := NewStore(seed)
+	for _, tt := range tests {
+		got, _ := s.List(Query{Sort: tt.sort})
+		if !reflect.DeepEqual(ids(got), tt.want) {
+			t.Errorf("List(sort %v) = %v, want %v", tt.sort, ids(got), tt.want)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    M.Customer
+		wantErr string
+	}{
+		{"changes a field", `{"name":"Alice Jones"}`, M.Customer{ID: 1, Name: "Alice Jones", Cust_Type: "Regular", Email: "alice@example.com"}, ""},
+		{"null removes a field", `{"email":null}`, M.Customer{ID: 1, Name: "Alice Smith", Cust_Type: "Regular"}, ""},
+		{"same id", `{"id":1,"type":"Premium"}`, M.Customer{ID: 1, Name: "Alice Smith", Cust_Type: "Premium", Email: "alice@example.com"}, ""},
+		{"changed id", `{"id":9}`, M.Customer{}, "id: cannot be changed"},
+		{"required field removed", `{"type":null}`, M.Customer{}, "type: is required"},
+		{"invalid email", `{"email":"nope"}`, M.Customer{}, "email: must be a valid email address"},
+		{"not an object", `[1]`, M.Customer{}, "body: must be a JSON object"},
+		{"not JSON", `{`, M.Customer{}, "body: is not valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(seed)
+			got, err := s.Patch(1, []byte(tt.patch), nil)
+			if tt.wantErr != "" {
+				var ve *ValidationError
+				if !errors.As(err, &ve) || err.Error() != tt.wantErr {
+					t.Fatalf("Patch(%s) error = %v, want %q", tt.patch, err, tt.wantErr)
+				}
+				if current, _ := s.Get(1); current != seed[0] {
+					t.Errorf("customer changed to %+v after a failed patch", current)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Patch(%s): %v", tt.patch, err)
+			}
+			if got != tt.want {
+				t.Errorf("Patch(%s) = %+v, want %+v", tt.patch, got, tt.want)
+			}
+			if stored, _ := s.Get(1); stored != tt.want {
+				t.Errorf("stored %+v, want %+v", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreconditionAbortsUpdates(t *testing.T) {
+	refuse := errors.New("refused")
+	pre := func(M.Customer, time.Time) error { return refuse }
+	s := NewStore(seed)
+
+	if _, err := s.Patch(1, []byte(`{"name":"x"}`), pre); err != refuse {
+		t.Errorf("Patch error = %v, want the precondition's", err)
+	}
+	if _, err := s.Replace(1, M.Customer{Cust_Type: "Regular"}, pre); err != refuse {
+		t.Errorf("Replace error = %v, want the precondition's", err)
+	}
+	if err := s.Delete(1, pre); err != refuse {
+		t.Errorf("Delete error = %v, want the precondition's", err)
+	}
+	if current, ok := s.Get(1); !ok || current != seed[0] {
+		t.Errorf("customer = %+v, %v after refused updates", current, ok)
+	}
+	if err := s.Delete(42, nil); err != ErrNotFound {
+		t.Errorf("Delete of a missing customer = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want interface{}
+	}{
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"a": "c"}, map[string]interface{}{"a": "c"}},
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"b": "c"}, map[string]interface{}{"a": "b", "b": "c"}},
+		{map[string]interface{}{"a": "b"}, map[string]interface{}{"a": nil}, map[string]interface{}{}},
+		{map[string]interface{}{"a": map[string]interface{}{"b": "c"}}, map[string]interface{}{"a": map[string]interface{}{"d": "e"}}, map[string]interface{}{"a": map[string]interface{}{"b": "c", "d": "e"}}},
+		{map[string]interface{}{"a": "b"}, []interface{}{"c"}, []interface{}{"c"}},
+		{"a", map[string]interface{}{"b": "c"}, map[string]interface{}{"b": "c"}},
+	}
+	for _, tt := range tests {
+		if got := MergePatch(tt.target, tt.patch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MergePatch(%v, %v) = %v, want %v", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
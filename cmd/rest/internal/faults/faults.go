@@ -0,0 +1,331 @@
+package faults
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault types that replace or corrupt the real response.
+const (
+	EmptyResponse       = "EMPTY_RESPONSE"
+	MalformedJSON       = "MALFORMED_JSON"
+	ConnectionReset     = "CONNECTION_RESET_BY_PEER"
+	RandomDataThenClose = "RANDOM_DATA_THEN_CLOSE"
+)
+
+const (
+	defaultErrorStatus     = http.StatusInternalServerError
+	defaultFaultPercentage = 100
+)
+
+// Settings describes the misbehaviour injected into a response. Delays are in
+// milliseconds so the same shape works in stub JSON, config YAML and the admin
+// API.
+type Settings struct {
+	FixedDelayMs      int           `json:"fixedDelayMilliseconds,omitempty" yaml:"fixed_delay_ms"`
+	DelayDistribution *Distribution `json:"delayDistribution,omitempty" yaml:"delay_distribution"`
+
+	// ErrorPercent of requests are answered with ErrorStatus instead.
+	ErrorPercent float64 `json:"errorPercent,omitempty" yaml:"error_percent"`
+	ErrorStatus  int     `json:"errorStatus,omitempty" yaml:"error_status"`
+
+	// Fault is applied to FaultPercent of requests (all of them when unset).
+	Fault        string  `json:"fault,omitempty" yaml:"fault"`
+	FaultPercent float64 `json:"faultPercent,omitempty" yaml:"fault_percent"`
+
+	Dribble *Dribble `json:"chunkedDribbleDelay,omitempty" yaml:"dribble"`
+}
+
+// Distribution is a random delay: "uniform" between Lower and Upper, or
+// "lognormal" around Median with spread Sigma.
+type Distribution struct {
+	Type   string  `json:"type" yaml:"type"`
+	Lower  int     `json:"lower,omitempty" yaml:"lower"`
+	Upper  int     `json:"upper,omitempty" yaml:"upper"`
+	Median int     `json:"median,omitempty" yaml:"median"`
+	Sigma  float64 `json:"sigma,omitempty" yaml:"sigma"`
+}
+
+// Dribble sends the body in NumberOfChunks pieces spread over TotalDuration
+// milliseconds.
+type Dribble struct {
+	NumberOfChunks int `json:"numberOfChunks" yaml:"chunks"`
+	TotalDuration  int `json:"totalDuration" yaml:"total_duration_ms"`
+}
+
+func (s *Settings) Validate() error {
+	if s == nil {
+		return nil
+	}
+	switch s.Fault {
+	case "", EmptyResponse, MalformedJSON, ConnectionReset, RandomDataThenClose:
+	default:
+		return fmt.Errorf("unknown fault %q", s.Fault)
+	}
+	if d := s.DelayDistribution; d != nil {
+		switch d.Type {
+		case "uniform":
+			if d.Upper < d.Lower {
+				return fmt.Errorf("uniform delay upper bound is below lower bound")
+			}
+		case "lognormal":
+			if d.Median <= 0 {
+				return fmt.Errorf("lognormal delay requires a positive median")
+			}
+		default:
+			return fmt.Errorf("unknown delay distribution %q", d.Type)
+		}
+	}
+	if s.ErrorPercent < 0 || s.ErrorPercent > 100 || s.FaultPercent < 0 || s.FaultPercent > 100 {
+		return fmt.Errorf("percentages must be between 0 and 100")
+	}
+	if s.Dribble != nil && s.Dribble.NumberOfChunks < 1 {
+		return fmt.Errorf("dribble needs at least one chunk")
+	}
+	return nil
+}
+
+// Delay picks the delay to apply to one request.
+func (s *Settings) Delay() time.Duration {
+	delay := time.Duration(s.FixedDelayMs) * time.Millisecond
+	if d := s.DelayDistribution; d != nil {
+		switch d.Type {
+		case "uniform":
+			ms := d.Lower
+			if d.Upper > d.Lower {
+				ms += rand.Intn(d.Upper - d.Lower + 1)
+			}
+			delay += time.Duration(ms) * time.Millisecond
+		case "lognormal":
+			ms := float64(d.Median) * math.Exp(rand.NormFloat64()*d.Sigma)
+			delay += time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return delay
+}
+
+func chance(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+// Serve runs next under the settings: after the delay the request may be
+// answered with an error status, have its connection broken, or have the real
+// response corrupted or dribbled out slowly. Nil settings serve next as is.
+func Serve(w http.ResponseWriter, r *http.Request, s *Settings, next http.Handler) {
+	if s == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if delay := s.Delay(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if chance(s.ErrorPercent) {
+		status := s.ErrorStatus
+		if status == 0 {
+			status = defaultErrorStatus
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"success":false,"error":"Injected fault: status %d"}`+"\n", status)
+		return
+	}
+
+	fault := s.Fault
+	percent := s.FaultPercent
+	if percent == 0 {
+		percent = defaultFaultPercentage
+	}
+	if fault != "" && !chance(percent) {
+		fault = ""
+	}
+
+	switch fault {
+	case EmptyResponse:
+		closeConnection(w, nil, false)
+		return
+	case ConnectionReset:
+		closeConnection(w, nil, true)
+		return
+	case RandomDataThenClose:
+		garbage := make([]byte, 64)
+		rand.Read(garbage)
+		closeConnection(w, garbage, false)
+		return
+	}
+
+	if fault != MalformedJSON && s.Dribble == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	buf := newBuffer()
+	next.ServeHTTP(buf, r)
+	body := buf.body.Bytes()
+	if fault == MalformedJSON {
+		body = corrupt(body)
+	}
+
+	for k, v := range buf.header {
+		w.Header()[k] = v
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(buf.status)
+
+	if s.Dribble == nil {
+		w.Write(body)
+		return
+	}
+	dribble(w, r, body, *s.Dribble)
+}
+
+// corrupt cuts a JSON body in half so clients fail to parse it.
+func corrupt(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) < 2 {
+		return []byte(`{"success": tr`)
+	}
+	return body[:len(body)/2]
+}
+
+func dribble(w http.ResponseWriter, r *http.Request, body []byte, d Dribble) {
+	flusher, _ := w.(http.Flusher)
+	chunks := d.NumberOfChunks
+	if chunks > len(body) && len(body) > 0 {
+		chunks = len(body)
+	}
+	size := int(math.Ceil(float64(len(body)) / float64(chunks)))
+	pause := time.Duration(d.TotalDuration) * time.Millisecond / time.Duration(chunks)
+
+	for start := 0; start < len(body); start += size {
+		end := min(start+size, len(body))
+		w.Write(body[start:end])
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if end == len(body) {
+			return
+		}
+		select {
+		case <-time.After(pause):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// closeConnection takes over the TCP connection, optionally writes data, and
+// closes it. With reset the socket is closed with SO_LINGER 0 so the peer sees
+// a RST instead of an orderly FIN.
+func closeConnection(w http.ResponseWriter, data []byte, reset bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "fault injection unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	if len(data) > 0 {
+		bufrw.Write(data)
+		bufrw.Flush()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && reset {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// FromHeaders builds settings from opt-in request headers:
+//
+//	X-Servr-Delay: 250 (milliseconds) or 250ms
+//	X-Servr-Error-Status: 503
+//	X-Servr-Error-Percent: 50 (defaults to 100 when a status is given)
+//	X-Servr-Fault: CONNECTION_RESET_BY_PEER
+//	X-Servr-Dribble: 10/2000 (chunks/milliseconds)
+//
+// It returns nil when none are present.
+func FromHeaders(h http.Header) (*Settings, error) {
+	var (
+		s   Settings
+		set bool
+	)
+
+	if v := h.Get("X-Servr-Delay"); v != "" {
+		ms, err := parseMillis(v)
+		if err != nil {
+			return nil, fmt.Errorf("X-Servr-Delay: %w", err)
+		}
+		s.FixedDelayMs, set = ms, true
+	}
+	if v := h.Get("X-Servr-Error-Status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("X-Servr-Error-Status: invalid status %q", v)
+		}
+		s.ErrorStatus, s.ErrorPercent, set = status, 100, true
+	}
+	if v := h.Get("X-Servr-Error-Percent"); v != "" {
+		percent, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("X-Servr-Error-Percent: %w", err)
+		}
+		s.ErrorPercent, set = percent, true
+	}
+	if v := h.Get("X-Servr-Fault"); v != "" {
+		s.Fault, set = strings.ToUpper(v), true
+	}
+	if v := h.Get("X-Servr-Dribble"); v != "" {
+		chunks, duration, ok := strings.Cut(v, "/")
+		n, err1 := strconv.Atoi(chunks)
+		ms, err2 := parseMillis(duration)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("X-Servr-Dribble: expected <chunks>/<milliseconds>, got %q", v)
+		}
+		s.Dribble, set = &Dribble{NumberOfChunks: n, TotalDuration: ms}, true
+	}
+
+	if !set {
+		return nil, nil
+	}
+	return &s, s.Validate()
+}
+
+func parseMillis(v string) (int, error) {
+	if ms, err := strconv.Atoi(v); err == nil {
+		return ms, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	return int(d / time.Millisecond), nil
+}
+
+// buffer captures a handler's response so it can be altered before sending.
+type buffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBuffer() *buffer {
+	return &buffer{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *buffer) Header() http.Header         { return b.header }
+func (b *buffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *buffer) WriteHeader(status int)      { b.status = status }
@@ -0,0 +1,108 @@
+package faults
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Registry holds the global and per-route fault settings.
+type Registry struct {
+	mu           sync.RWMutex
+	global       *Settings
+	routes       map[string]*Settings
+	allowHeaders bool
+}
+
+func NewRegistry(global *Settings, routes map[string]*Settings, allowHeaders bool) *Registry {
+	if routes == nil {
+		routes = map[string]*Settings{}
+	}
+	return &Registry{global: global, routes: routes, allowHeaders: allowHeaders}
+}
+
+func (reg *Registry) Global() *Settings {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.global
+}
+
+func (reg *Registry) SetGlobal(s *Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.global = s
+	return nil
+}
+
+// Routes returns a copy of the per-route settings keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string]*Settings {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]*Settings, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs settings for a route; nil removes them.
+func (reg *Registry) SetRoute(route string, s *Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if s == nil {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = s
+	return nil
+}
+
+// Reset clears every global and per-route setting.
+func (reg *Registry) Reset() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.global = nil
+	reg.routes = map[string]*Settings{}
+}
+
+func (reg *Registry) AllowHeaders() bool {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.allowHeaders
+}
+
+func (reg *Registry) SetAllowHeaders(allow bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.allowHeaders = allow
+}
+
+// Resolve picks the settings for a request, most specific first: opt-in
+// request headers, then the stub's own settings, then the route's, then the
+// global ones. routeKeys are tried in order, e.g. "GET /customer/{id}" before
+// "/customer/{id}".
+func (reg *Registry) Resolve(r *http.Request, own *Settings, routeKeys ...string) (*Settings, error) {
+	if reg.AllowHeaders() {
+		s, err := FromHeaders(r.Header)
+		if err != nil || s != nil {
+			return s, err
+		}
+	}
+	if own != nil {
+		return own, nil
+	}
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if s, ok := reg.routes[key]; ok {
+			return s, nil
+		}
+	}
+	return reg.global, nil
+}
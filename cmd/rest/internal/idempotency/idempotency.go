@@ -0,0 +1,169 @@
+// Package idempotency stores the first response to a request carrying an
+// Idempotency-Key so retries with the same key get it again instead of
+// repeating the operation, as in the IETF Idempotency-Key header draft.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Header carries the client's key.
+const Header = "Idempotency-Key"
+
+var (
+	// ErrConflict means the key was first used by another caller or with a
+	// different method, path or body.
+	ErrConflict = errors.New("idempotency key was used for a different request")
+	// ErrInProgress means the first request with the key has not finished.
+	ErrInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// Fingerprint identifies a request so a reused key can be told apart from
+// a retry. caller identifies who sent it, so a response is only replayed to
+// the caller it was first served to.
+func Fingerprint(caller, method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(caller + "\n" + method + " " + uri + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Response is a stored response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"headers"`
+	Body   string      `json:"body"`
+}
+
+// Record is what the store knows about one key.
+type Record struct {
+	Key         string `json:"key"`
+	Method      string `json:"method"`
+	URI         string `json:"uri"`
+	Fingerprint string `json:"fingerprint"`
+	// Response is nil while the first request is being processed.
+	Response  *Response `json:"response,omitempty"`
+	Replays   int       `json:"replays"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Store keeps records until their TTL runs out, safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	records map[string]*Record
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, records: map[string]*Record{}}
+}
+
+// purge drops expired records; the caller holds the lock.
+func (s *Store) purge(now time.Time) {
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
+
+// Begin claims key for a request with fingerprint. It returns the stored
+// response when the request is a retry, nil when the caller should process
+// it and then Complete or Abandon the key, or ErrConflict or ErrInProgress.
+func (s *Store) Begin(key, method, uri, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.purge(now)
+	rec, ok := s.records[key]
+	if !ok {
+		s.records[key] = &Record{
+			Key:         key,
+			Method:      method,
+			URI:         uri,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+		return nil, nil
+	}
+	if rec.Fingerprint != fingerprint {
+		return nil, ErrConflict
+	}
+	if rec.Response == nil {
+		return nil, ErrInProgress
+	}
+	rec.Replays++
+	resp := *rec.Response
+	resp.Header = rec.Response.Header.Clone()
+	return &resp, nil
+}
+
+// Complete stores the response to the request that claimed key.
+func (s *Store) Complete(key string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok {
+		rec.Response = &resp
+	}
+}
+
+// Abandon releases key without storing a response, so a retry is
+// processed again.
+func (s *Store) Abandon(key string) {
+	s.Delete(key)
+}
+
+// List returns the live records, oldest first.
+func (s *Store) List() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	out := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		out = append(out, *rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Get returns the record of key.
+func (s *Store) Get(key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	rec, ok := s.records[key]
+	if !ok {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// Delete forgets key and reports whether it was stored.
+func (s *Store) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.records[key]
+	delete(s.records, key)
+	return ok
+}
+
+// Reset forgets every key.
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = map[string]*Record{}
+}
+
+// TTL is how long keys are kept.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("alice", "POST", "/customers", []byte(`{"name":"a"}`))
+	tests := []struct {
+		name                string
+		caller, method, uri string
+		body                string
+	}{
+		{"caller", "bob", "POST", "/customers", `{"name":"a"}`},
+		{"method", "alice", "PATCH", "/customers", `{"name":"a"}`},
+		{"uri", "alice", "POST", "/customers?x=1", `{"name":"a"}`},
+		{"body", "alice", "POST", "/customers", `{"name":"b"}`},
+		{"boundary", "alice\nPOST", "/customers", "", `{"name":"a"}`},
+	}
+	for _, tt := range tests {
+		if Fingerprint(tt.caller, tt.method, tt.uri, []byte(tt.body)) == base {
+			t.Errorf("a different %s gives the same fingerprint", tt.name)
+		}
+	}
+	if Fingerprint("alice", "POST", "/customers", []byte(`{"name":"a"}`)) != base {
+		t.Error("the same request gives different fingerprints")
+	}
+}
+
+func TestBegin(t *testing.T) {
+	s := NewStore(time.Hour)
+
+	if resp, err := s.Begin("k", "POST", "/customers", "f1"); resp != nil || err != nil {
+		t.Fatalf("first Begin = %v, %v; want nil, nil", resp, err)
+	}
+	if _, err := s.Begin("k", "POST", "/customers", "f1"); err != ErrInProgress {
+		t.Errorf("Begin while processing = %v, want ErrInProgress", err)
+	}
+	if _, err := s.Begin("k", "POST", "/customers", "f2"); err != ErrConflict {
+		t.Errorf("Begin with another fingerprint = %v, want ErrConflict", err)
+	}
+
+	s.Complete("k", Response{Status: http.StatusCreated, Header: http.Header{"Location": {"/customers/9"}}, Body: "{}"})
+	for i := 1; i <= 2; i++ {
+		resp, err := s.Begin("k", "POST", "/customers", "f1")
+		if err != nil || resp == nil || resp.Status != http.StatusCreated || resp.Header.Get("Location") != "/customers/9" {
+			t.Fatalf("replay %d = %+v, %v", i, resp, err)
+		}
+		// a replay's headers are its own
+		resp.Header.Set("Location", "/elsewhere")
+	}
+	if rec, ok := s.Get("k"); !ok || rec.Replays != 2 || rec.Response.Header.Get("Location") != "/customers/9" {
+		t.Errorf("record = %+v, %v", rec, ok)
+	}
+}
+
+func TestAbandon(t *testing.T) {
+	s := NewStore(time.Hour)
+	s.Begin("k", "POST", "/customers", "f1")
+	s.Abandon("k")
+	if resp, err := s.Begin("k", "POST", "/customers", "f2"); resp != nil || err != nil {
+		t.Errorf("Begin after Abandon = %v, %v; want the key free again", resp, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s := NewStore(time.Millisecond)
+	s.Begin("k", "POST", "/customers", "f1")
+	s.Complete("k", Response{Status: http.StatusOK})
+	time.Sleep(5 * time.Millisecond)
+
+	if got := s.List(); len(got) != 0 {
+		t.Errorf("List after the TTL = %+v", got)
+	}
+	if resp, err := s.Begin("k", "POST", "/customers", "f2"); resp != nil || err != nil {
+		t.Errorf("Begin after the TTL = %v, %v; want the key free again", resp, err)
+	}
+}
+
+func TestListDeleteReset(t *testing.T) {
+	s := NewStore(time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Begin(key, "POST", "/customers", key)
+		time.Sleep(time.Millisecond)
+	}
+	if got := s.List(); len(got) != 3 || got[0].Key != "a" || got[2].Key != "c" {
+		t.Errorf("List = %+v, want a, b and c oldest first", got)
+	}
+	if !s.Delete("b") || s.Delete("b") {
+		t.Error("Delete did not report whether the key was stored")
+	}
+	s.Reset()
+	if got := s.List(); len(got) != 0 {
+		t.Errorf("List after Reset = %+v", got)
+	}
+}
@@ -0,0 +1,181 @@
+// Package jobs simulates long-running operations: a request is accepted with
+// 202, the job walks through a list of states over time or on demand, and it
+// finally yields a templated result or failure.
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"mock-server/cmd/rest/internal/tmpl"
+)
+
+const (
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Step is an intermediate state. A job stays in it for DurationMs; zero waits
+// for an admin transition.
+type Step struct {
+	State      string `json:"state" yaml:"state"`
+	DurationMs int    `json:"durationMs,omitempty" yaml:"duration_ms"`
+}
+
+// Outcome is what the result URL serves once a job has finished. Header
+// values and the body are templates rendered against Data.
+type Outcome struct {
+	Status  int               `json:"status,omitempty" yaml:"status"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers"`
+	Body    string            `json:"body,omitempty" yaml:"body"`
+}
+
+// Definition describes the jobs a stub or route starts.
+type Definition struct {
+	// Steps default to queued for one second, then running for two.
+	Steps []Step `json:"steps,omitempty" yaml:"steps"`
+	// Outcome is the state reached after the last step: succeeded (the
+	// default) or failed.
+	Outcome string   `json:"outcome,omitempty" yaml:"outcome"`
+	Result  *Outcome `json:"result,omitempty" yaml:"result"`
+	Failure *Outcome `json:"failure,omitempty" yaml:"failure"`
+	// RetryAfter is the polling interval, in seconds, suggested to clients
+	// while the job is running.
+	RetryAfter int `json:"retryAfter,omitempty" yaml:"retry_after"`
+}
+
+var defaultSteps = []Step{
+	{State: "queued", DurationMs: 1000},
+	{State: "running", DurationMs: 2000},
+}
+
+// Validate checks the definition and fills in defaults.
+func (d *Definition) Validate() error {
+	if d == nil {
+		return nil
+	}
+	if len(d.Steps) == 0 {
+		d.Steps = append([]Step{}, defaultSteps...)
+	}
+	for i, step := range d.Steps {
+		switch {
+		case step.State == "":
+			return fmt.Errorf("steps[%d]: a state name is required", i)
+		case step.State == StateSucceeded || step.State == StateFailed:
+			return fmt.Errorf("steps[%d]: %s is a final state", i, step.State)
+		case step.DurationMs < 0:
+			return fmt.Errorf("steps[%d]: durationMs must not be negative", i)
+		}
+	}
+	switch d.Outcome {
+	case "":
+		d.Outcome = StateSucceeded
+	case StateSucceeded, StateFailed:
+	default:
+		return fmt.Errorf("unknown job outcome %q (want %s or %s)", d.Outcome, StateSucceeded, StateFailed)
+	}
+	if d.RetryAfter < 0 {
+		return fmt.Errorf("retryAfter must not be negative")
+	}
+	if d.RetryAfter == 0 {
+		d.RetryAfter = 1
+	}
+	for name, outcome := range map[string]*Outcome{"result": d.Result, "failure": d.Failure} {
+		if outcome == nil {
+			continue
+		}
+		if outcome.Status != 0 && (outcome.Status < 100 || outcome.Status > 599) {
+			return fmt.Errorf("%s status %d is not a valid HTTP status", name, outcome.Status)
+		}
+		if _, err := tmpl.Parse(name, outcome.Body); err != nil {
+			return fmt.Errorf("%s body: %w", name, err)
+		}
+		for k, v := range outcome.Headers {
+			if _, err := tmpl.Parse(name+" header "+k, v); err != nil {
+				return fmt.Errorf("%s header %s: %w", name, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Rendered is a finished job's outcome ready to be written.
+type Rendered struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+}
+
+// Write sends the outcome to w.
+func (r Rendered) Write(w http.ResponseWriter) {
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(r.Status)
+	w.Write([]byte(r.Body))
+}
+
+// Data is what outcome templates are rendered against, e.g. {{.Job.ID}},
+// {{.Request.JSON.reportType}} or {{.Request.PathParams.id}}.
+type Data struct {
+	Job     Job
+	Request tmpl.Request
+}
+
+func (d *Definition) render(data Data) (Rendered, error) {
+	outcome, status, body := d.Result, http.StatusOK, `{"success":true,"data":{"jobId":"{{.Job.ID}}"}}`
+	if data.Job.State == StateFailed {
+		outcome, status, body = d.Failure, http.StatusInternalServerError, `{"success":false,"error":"Job {{.Job.ID}} failed"}`
+	}
+	if outcome == nil {
+		outcome = &Outcome{}
+	}
+	if outcome.Status != 0 {
+		status = outcome.Status
+	}
+	if outcome.Body != "" {
+		body = outcome.Body
+	}
+
+	out := Rendered{Status: status, Headers: map[string]string{}}
+	var err error
+	if out.Body, err = tmpl.Render("body", body, data); err != nil {
+		return Rendered{}, err
+	}
+	for k, v := range outcome.Headers {
+		if out.Headers[k], err = tmpl.Render("header "+k, v, data); err != nil {
+			return Rendered{}, err
+		}
+	}
+	return out, nil
+}
+
+// Transition is one change of a job's state.
+type Transition struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+	// By is "timer" or "admin".
+	By string `json:"by"`
+}
+
+// Job is a snapshot of an accepted operation.
+type Job struct {
+	ID        string       `json:"id"`
+	Source    string       `json:"source"`
+	State     string       `json:"state"`
+	Done      bool         `json:"done"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	StatusURL string       `json:"statusUrl"`
+	ResultURL string       `json:"resultUrl"`
+	History   []Transition `json:"history"`
+}
+
+// Finished reports whether the job has reached a final state.
+func Finished(state string) bool {
+	return state == StateSucceeded || state == StateFailed
+}
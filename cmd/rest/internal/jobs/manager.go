@@ -0,0 +1,207 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"mock-server/cmd/rest/internal/tmpl"
+	"mock-server/internal/common"
+)
+
+// BasePath is where clients poll jobs: <BasePath>/<id> for the status and
+// <BasePath>/<id>/result for the outcome.
+const BasePath = "/jobs"
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrNotFinished = errors.New("job has not finished")
+)
+
+type job struct {
+	Job
+	def     *Definition
+	request tmpl.Request
+	// step is the index of the current step; len(def.Steps) once finished.
+	step    int
+	entered time.Time
+}
+
+// advance moves the job through every timed step that has elapsed by now.
+// The recorded transition times are when each step ran out, not when the
+// job was next looked at.
+func (j *job) advance(now time.Time) {
+	for j.step < len(j.def.Steps) {
+		duration := time.Duration(j.def.Steps[j.step].DurationMs) * time.Millisecond
+		if duration == 0 || now.Sub(j.entered) < duration {
+			return
+		}
+		j.next(j.entered.Add(duration), "timer")
+	}
+}
+
+func (j *job) next(at time.Time, by string) {
+	j.step++
+	state := j.def.Outcome
+	if j.step < len(j.def.Steps) {
+		state = j.def.Steps[j.step].State
+	}
+	j.enter(state, at, by)
+}
+
+func (j *job) enter(state string, at time.Time, by string) {
+	j.State = state
+	j.Done = Finished(state)
+	j.entered = at
+	j.UpdatedAt = at
+	j.History = append(j.History, Transition{State: state, At: at, By: by})
+}
+
+func (j *job) snapshot() Job {
+	c := j.Job
+	c.History = append([]Transition{}, j.History...)
+	return c
+}
+
+// Manager keeps the accepted jobs, at most limit of them.
+type Manager struct {
+	mu    sync.Mutex
+	jobs  []*job
+	limit int
+}
+
+func NewManager(limit int) *Manager {
+	return &Manager{limit: limit}
+}
+
+// Create accepts a job started by source ("stub:<id>" or "route:<key>").
+func (m *Manager) Create(def *Definition, source string, req tmpl.Request) Job {
+	req.JSON = tmpl.ParseJSON(req.Body)
+	now := time.Now()
+	j := &job{
+		Job: Job{
+			ID:        common.NewID(),
+			Source:    source,
+			CreatedAt: now,
+		},
+		def:     def,
+		request: req,
+	}
+	j.StatusURL = BasePath + "/" + j.ID
+	j.ResultURL = j.StatusURL + "/result"
+	j.enter(def.Steps[0].State, now, "timer")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = append(m.jobs, j)
+	if m.limit > 0 && len(m.jobs) > m.limit {
+		m.jobs = m.jobs[len(m.jobs)-m.limit:]
+	}
+	return j.snapshot()
+}
+
+func (m *Manager) find(id string) *job {
+	for _, j := range m.jobs {
+		if j.ID == id {
+			j.advance(time.Now())
+			return j
+		}
+	}
+	return nil
+}
+
+// Get returns the job's current state.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.find(id)
+	if j == nil {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+// RetryAfter is the polling interval, in seconds, for the job with id.
+func (m *Manager) RetryAfter(id string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j := m.find(id); j != nil {
+		return j.def.RetryAfter
+	}
+	return 0
+}
+
+// List returns the jobs, oldest first, optionally filtered by source and
+// state.
+func (m *Manager) List(source, state string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	out := []Job{}
+	for _, j := range m.jobs {
+		j.advance(now)
+		if (source == "" || j.Source == source) && (state == "" || j.State == state) {
+			out = append(out, j.snapshot())
+		}
+	}
+	return out
+}
+
+// Transition moves a job to state, which is one of its step names or a final
+// state. An empty state moves it to the next step.
+func (m *Manager) Transition(id, state string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.find(id)
+	if j == nil {
+		return Job{}, ErrNotFound
+	}
+	if j.Done {
+		return Job{}, fmt.Errorf("job has already %s", j.State)
+	}
+
+	now := time.Now()
+	switch {
+	case state == "":
+		j.next(now, "admin")
+	case Finished(state):
+		j.step = len(j.def.Steps)
+		j.enter(state, now, "admin")
+	default:
+		step := -1
+		for i, s := range j.def.Steps {
+			if s.State == state {
+				step = i
+				break
+			}
+		}
+		if step < 0 {
+			return Job{}, fmt.Errorf("job has no %q state", state)
+		}
+		j.step = step
+		j.enter(state, now, "admin")
+	}
+	return j.snapshot(), nil
+}
+
+// Result renders the outcome of a finished job.
+func (m *Manager) Result(id string) (Rendered, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.find(id)
+	if j == nil {
+		return Rendered{}, ErrNotFound
+	}
+	if !j.Done {
+		return Rendered{}, ErrNotFinished
+	}
+	return j.def.render(Data{Job: j.snapshot(), Request: j.request})
+}
+
+// Reset forgets every job.
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = nil
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import "sync"
+
+// Registry holds the job definitions configured for built-in routes.
+type Registry struct {
+	mu     sync.RWMutex
+	routes map[string]*Definition
+}
+
+func NewRegistry(routes map[string]*Definition) *Registry {
+	if routes == nil {
+		routes = map[string]*Definition{}
+	}
+	return &Registry{routes: routes}
+}
+
+// Routes returns a copy of the definitions keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string]*Definition {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]*Definition, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute makes a route start jobs; nil restores its handler.
+func (reg *Registry) SetRoute(route string, def *Definition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if def == nil {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = def
+	return nil
+}
+
+// Resolve returns the definition for the first of routeKeys that has one.
+func (reg *Registry) Resolve(routeKeys ...string) (string, *Definition) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if def, ok := reg.routes[key]; ok {
+			return key, def
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,104 @@
+package journal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mock-server/cmd/rest/internal/stubs"
+)
+
+// Entry is a single request served by the REST service.
+type Entry struct {
+	ID        int            `json:"id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Request   *stubs.Request `json:"request"`
+	MatchedBy string         `json:"matchedBy,omitempty"`
+	Status    int            `json:"status"`
+}
+
+// Matched reports whether a route or stub handled the request.
+func (e *Entry) Matched() bool {
+	return e.MatchedBy != ""
+}
+
+// Journal keeps the most recent requests, bounded by limit.
+type Journal struct {
+	mu      sync.RWMutex
+	entries []*Entry
+	limit   int
+	nextID  int
+}
+
+func New(limit int) *Journal {
+	return &Journal{limit: limit}
+}
+
+func (j *Journal) Record(e *Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextID++
+	e.ID = j.nextID
+	j.entries = append(j.entries, e)
+	if j.limit > 0 && len(j.entries) > j.limit {
+		j.entries = j.entries[len(j.entries)-j.limit:]
+	}
+}
+
+func (j *Journal) Entries() []*Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return append([]*Entry(nil), j.entries...)
+}
+
+func (j *Journal) Unmatched() []*Entry {
+	var out []*Entry
+	for _, e := range j.Entries() {
+		if !e.Matched() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Find returns the entries whose request satisfies pattern.
+func (j *Journal) Find(pattern stubs.RequestPattern) []*Entry {
+	var out []*Entry
+	for _, e := range j.Entries() {
+		if pattern.Match(e.Request).Matched() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Requests returns the captured requests of entries.
+func Requests(entries []*Entry) []*stubs.Request {
+	out := make([]*stubs.Request, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.Request)
+	}
+	return out
+}
+
+func (j *Journal) Reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = nil
+}
+
+type entryKey struct{}
+
+// WithEntry attaches the in-flight entry to the request context so handlers
+// further down can annotate it.
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// MarkMatched records what handled the request, if it is being journaled.
+func MarkMatched(ctx context.Context, matchedBy string) {
+	if e, ok := ctx.Value(entryKey{}).(*Entry); ok {
+		e.MatchedBy = matchedBy
+	}
+}
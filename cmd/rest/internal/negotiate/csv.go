@@ -0,0 +1,197 @@
+package negotiate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table lets a value choose its own CSV layout, such as a page listing its
+// items rather than itself.
+type Table interface {
+	CSVTable() (header []string, rows [][]string)
+}
+
+// TableOf lays v out as CSV: a slice of structs becomes a row per element, a
+// struct or map a single row, and anything else a single "value" column.
+// Struct columns are named after their json tags.
+func TableOf(v interface{}) ([]string, [][]string) {
+	if t, ok := v.(Table); ok {
+		return t.CSVTable()
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	switch {
+	case !rv.IsValid():
+		return []string{"value"}, nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8:
+		elem := rv.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			rows := make([][]string, rv.Len())
+			for i := range rows {
+				rows[i] = []string{cell(rv.Index(i))}
+			}
+			return []string{"value"}, rows
+		}
+		header, fields := columns(elem)
+		rows := make([][]string, rv.Len())
+		for i := range rows {
+			rows[i] = structRow(indirect(rv.Index(i)), fields)
+		}
+		return header, rows
+	case rv.Kind() == reflect.Struct:
+		header, fields := columns(rv.Type())
+		return header, [][]string{structRow(rv, fields)}
+	case rv.Kind() == reflect.Map:
+		var header []string
+		for _, k := range rv.MapKeys() {
+			header = append(header, fmt.Sprint(k.Interface()))
+		}
+		sort.Strings(header)
+		row := make([]string, len(header))
+		for i, k := range header {
+			row[i] = cell(rv.MapIndex(reflect.ValueOf(k)))
+		}
+		return header, [][]string{row}
+	}
+	return []string{"value"}, [][]string{{cell(rv)}}
+}
+
+func marshalCSV(v interface{}) ([]byte, error) {
+	header, rows := TableOf(v)
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	w.WriteAll(rows)
+	return buf.Bytes(), w.Error()
+}
+
+// unmarshalCSV reads a header row and one record into the struct v points
+// to, matching columns to json tags.
+func unmarshalCSV(r io.Reader, v interface{}) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) != 2 {
+		return fmt.Errorf("expected a header row and one record, got %d rows", len(records))
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode CSV into %T", v)
+	}
+	rv = rv.Elem()
+	header, fields := columns(rv.Type())
+	index := map[string]int{}
+	for i, name := range header {
+		index[name] = fields[i]
+	}
+
+	for i, name := range records[0] {
+		f, ok := index[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		if err := setCell(rv.Field(f), records[1][i]); err != nil {
+			return fmt.Errorf("column %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// columns returns the exported fields of t with their json names.
+func columns(t reflect.Type) ([]string, []int) {
+	var names []string
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+		fields = append(fields, i)
+	}
+	return names, fields
+}
+
+func structRow(rv reflect.Value, fields []int) []string {
+	row := make([]string, len(fields))
+	if !rv.IsValid() {
+		return row
+	}
+	for i, f := range fields {
+		row[i] = cell(rv.Field(f))
+	}
+	return row
+}
+
+func cell(rv reflect.Value) string {
+	rv = indirect(rv)
+	if !rv.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+func setCell(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Bool:
+		if s == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package negotiate picks the representation of a response from the Accept
+// header or a ?format= override, and decodes request bodies by Content-Type.
+// JSON, XML, YAML and CSV are supported.
+package negotiate
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a supported representation.
+type Format struct {
+	// Name is what ?format= accepts.
+	Name string
+	// MediaType is sent as the response's Content-Type.
+	MediaType string
+	// aliases are other media types that select the format.
+	aliases []string
+}
+
+var (
+	JSON = Format{Name: "json", MediaType: "application/json"}
+	XML  = Format{Name: "xml", MediaType: "application/xml", aliases: []string{"text/xml"}}
+	YAML = Format{Name: "yaml", MediaType: "application/yaml", aliases: []string{"application/x-yaml", "text/yaml"}}
+	CSV  = Format{Name: "csv", MediaType: "text/csv"}
+
+	// Formats are in order of preference when the client accepts several
+	// equally.
+	Formats = []Format{JSON, XML, YAML, CSV}
+)
+
+var (
+	ErrNotAcceptable        = errors.New("none of the accepted media types can be produced")
+	ErrUnsupportedMediaType = errors.New("unsupported request media type")
+)
+
+// MediaTypes lists every media type that can be produced.
+func MediaTypes() []string {
+	var out []string
+	for _, f := range Formats {
+		out = append(out, f.MediaType)
+	}
+	return out
+}
+
+func (f Format) matches(mediaType string) bool {
+	if mediaType == f.MediaType {
+		return true
+	}
+	for _, alias := range f.aliases {
+		if mediaType == alias {
+			return true
+		}
+	}
+	// structured suffixes, e.g. application/vnd.servr+json
+	return strings.HasSuffix(mediaType, "+"+f.Name)
+}
+
+// ByName returns the format called name.
+func ByName(name string) (Format, bool) {
+	for _, f := range Formats {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// ByMediaType returns the format of a Content-Type value.
+func ByMediaType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Format{}, false
+	}
+	for _, f := range Formats {
+		if f.matches(mediaType) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+type accepted struct {
+	mediaType string
+	q         float64
+}
+
+// Response picks the format for r: ?format= wins, then the Accept header's
+// most preferred type we can produce. Without either, JSON is used.
+func Response(r *http.Request) (Format, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		if f, ok := ByName(name); ok {
+			return f, nil
+		}
+		return Format{}, ErrNotAcceptable
+	}
+
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(header) == "" {
+		return JSON, nil
+	}
+
+	var ranges []accepted
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, accepted{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, a := range ranges {
+		switch {
+		case a.mediaType == "*/*", a.mediaType == "application/*":
+			return JSON, nil
+		case a.mediaType == "text/*":
+			return CSV, nil
+		}
+		for _, f := range Formats {
+			if f.matches(a.mediaType) {
+				return f, nil
+			}
+		}
+	}
+	return Format{}, ErrNotAcceptable
+}
+
+// Write encodes v in format f with the given status.
+func Write(w http.ResponseWriter, f Format, status int, v interface{}) error {
+	body, err := Marshal(f, v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", f.MediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
+
+// Marshal encodes v in format f. XML and YAML use the xml and yaml struct
+// tags; CSV lays v out as a Table.
+func Marshal(f Format, v interface{}) ([]byte, error) {
+	switch f.Name {
+	case XML.Name:
+		out, err := xml.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), append(out, '\n')...), nil
+	case YAML.Name:
+		return yaml.Marshal(v)
+	case CSV.Name:
+		return marshalCSV(v)
+	}
+	out, err := json.Marshal(v)
+	return append(out, '\n'), err
+}
+
+// Decode reads r's body into v according to its Content-Type and returns the
+// format it was read as. A missing Content-Type is taken to be JSON.
+func Decode(r *http.Request, v interface{}) (Format, error) {
+	f := JSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var ok bool
+		if f, ok = ByMediaType(ct); !ok {
+			return Format{}, ErrUnsupportedMediaType
+		}
+	}
+
+	switch f.Name {
+	case XML.Name:
+		return f, xml.NewDecoder(r.Body).Decode(v)
+	case YAML.Name:
+		return f, yaml.NewDecoder(r.Body).Decode(v)
+	case CSV.Name:
+		return f, unmarshalCSV(r.Body, v)
+	}
+	return f, json.NewDecoder(r.Body).Decode(v)
+}
@@ -0,0 +1,118 @@
+package negotiate
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	ID      int     `json:"id" xml:"id" yaml:"id"`
+	Name    string  `json:"name,omitempty" xml:"name" yaml:"name"`
+	Price   float64 `json:"price" xml:"price" yaml:"price"`
+	Active  bool    `json:"active" xml:"active" yaml:"active"`
+	Secret  string  `json:"-"`
+	private string
+}
+
+func TestResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept []string
+		want   string
+		err    error
+	}{
+		{"default", "/", nil, "json", nil},
+		{"format wins", "/?format=YAML", []string{"application/json"}, "yaml", nil},
+		{"unknown format", "/?format=toml", nil, "", ErrNotAcceptable},
+		{"exact type", "/", []string{"application/xml"}, "xml", nil},
+		{"alias", "/", []string{"text/yaml"}, "yaml", nil},
+		{"structured suffix", "/", []string{"application/vnd.servr+json"}, "json", nil},
+		{"highest q wins", "/", []string{"application/json;q=0.5, text/csv"}, "csv", nil},
+		{"several headers", "/", []string{"image/png", "application/xml;q=0.8"}, "xml", nil},
+		{"ties keep order", "/", []string{"text/csv, application/xml"}, "csv", nil},
+		{"q of zero refuses", "/", []string{"application/json;q=0"}, "", ErrNotAcceptable},
+		{"any type", "/", []string{"*/*"}, "json", nil},
+		{"any text", "/", []string{"text/*"}, "csv", nil},
+		{"nothing producible", "/", []string{"image/png"}, "", ErrNotAcceptable},
+		{"malformed ranges skipped", "/", []string{"bad/;;, application/xml;q=x, text/xml"}, "xml", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			for _, a := range tt.accept {
+				r.Header.Add("Accept", a)
+			}
+			f, err := Response(r)
+			if err != tt.err || f.Name != tt.want {
+				t.Errorf("Response = %q, %v; want %q, %v", f.Name, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMarshalCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"slice of structs", []item{{ID: 1, Name: "a, b", Price: 1.5}, {ID: 2, Active: true}}, "id,name,price,active\n1,\"a, b\",1.5,false\n2,,0,true\n"},
+		{"pointer elements", []*item{{ID: 1}, nil}, "id,name,price,active\n1,,0,false\n,,,\n"},
+		{"struct", item{ID: 3, Name: "c"}, "id,name,price,active\n3,c,0,false\n"},
+		{"map", map[string]int{"b": 2, "a": 1}, "a,b\n1,2\n"},
+		{"slice of values", []string{"x", "y"}, "value\nx\ny\n"},
+		{"scalar", 42, "value\n42\n"},
+		{"nil", nil, "value\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(CSV, tt.v)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Marshal(CSV) = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	want := item{ID: 7, Name: "seven", Price: 2.5, Active: true}
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+		wantErr     bool
+	}{
+		{"", `{"id":7,"name":"seven","price":2.5,"active":true}`, "json", false},
+		{"application/json; charset=utf-8", `{"id":7,"name":"seven","price":2.5,"active":true}`, "json", false},
+		{"application/xml", `<item><id>7</id><name>seven</name><price>2.5</price><active>true</active></item>`, "xml", false},
+		{"application/x-yaml", "id: 7\nname: seven\nprice: 2.5\nactive: true\n", "yaml", false},
+		{"text/csv", "active,price,name,id\ntrue,2.5,seven,7\n", "csv", false},
+		{"text/csv", "id,colour\n7,red\n", "csv", true},
+		{"text/csv", "id\n7\n8\n", "csv", true},
+		{"text/csv", "id\nseven\n", "csv", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		var got item
+		f, err := Decode(r, &got)
+		if f.Name != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Decode(%q) = %q, %v; want %q, error %v", tt.contentType, f.Name, err, tt.want, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, want) {
+			t.Errorf("Decode(%q) read %+v, want %+v", tt.contentType, got, want)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("x"))
+	r.Header.Set("Content-Type", "image/png")
+	if _, err := Decode(r, &item{}); err != ErrUnsupportedMediaType {
+		t.Errorf("Decode(image/png) error = %v, want ErrUnsupportedMediaType", err)
+	}
+}
@@ -0,0 +1,318 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Mock serves the operations of an OpenAPI 3 document from its examples and
+// schemas.
+type Mock struct {
+	Doc      *openapi3.T
+	BasePath string
+}
+
+// Operation is one method and path of the document, ready to be registered on
+// a router. Path already includes the base path.
+type Operation struct {
+	ID             string
+	Method         string
+	Path           string
+	SpecPath       string
+	RequiresBearer bool
+
+	op *openapi3.Operation
+}
+
+// Load reads and validates the document at path. basePath overrides the path
+// taken from the first server URL; "/" mounts the operations at the root.
+func Load(path, basePath string) (*Mock, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	return newMock(doc, basePath)
+}
+
+// LoadData parses a document held in memory, such as an embedded one.
+func LoadData(data []byte, basePath string) (*Mock, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		return nil, err
+	}
+	return newMock(doc, basePath)
+}
+
+func newMock(doc *openapi3.T, basePath string) (*Mock, error) {
+	if err := doc.Validate(context.Background(), openapi3.DisableExamplesValidation()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document %q: %w", doc.Info.Title, err)
+	}
+
+	if basePath == "" && len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil && !strings.Contains(u.Path, "{") {
+			basePath = u.Path
+		}
+	}
+	basePath = strings.TrimSuffix(basePath, "/")
+
+	return &Mock{Doc: doc, BasePath: basePath}, nil
+}
+
+// Operations lists every operation in a stable order.
+func (m *Mock) Operations() []Operation {
+	var ops []Operation
+	for _, path := range m.Doc.Paths.InMatchingOrder() {
+		item := m.Doc.Paths.Value(path)
+		methods := item.Operations()
+
+		names := make([]string, 0, len(methods))
+		for method := range methods {
+			names = append(names, method)
+		}
+		sort.Strings(names)
+
+		for _, method := range names {
+			op := methods[method]
+			ops = append(ops, Operation{
+				ID:             op.OperationID,
+				Method:         method,
+				Path:           m.BasePath + path,
+				SpecPath:       path,
+				RequiresBearer: m.requiresBearer(op),
+				op:             op,
+			})
+		}
+	}
+	return ops
+}
+
+// requiresBearer reports whether every security alternative of the operation
+// needs an HTTP bearer token. An empty alternative makes security optional.
+func (m *Mock) requiresBearer(op *openapi3.Operation) bool {
+	reqs := m.Doc.Security
+	if op.Security != nil {
+		reqs = *op.Security
+	}
+	if len(reqs) == 0 || m.Doc.Components == nil {
+		return false
+	}
+
+	for _, req := range reqs {
+		if len(req) == 0 {
+			return false
+		}
+		bearer := false
+		for name := range req {
+			scheme, ok := m.Doc.Components.SecuritySchemes[name]
+			if ok && scheme.Value != nil && scheme.Value.Type == "http" && strings.EqualFold(scheme.Value.Scheme, "bearer") {
+				bearer = true
+			}
+		}
+		if !bearer {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePrefer reads a Prefer header such as `code=404, example=notFound`.
+func ParsePrefer(header string) map[string]string {
+	prefs := map[string]string{}
+	for _, part := range strings.FieldsFunc(header, func(r rune) bool { return r == ',' || r == ';' }) {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		prefs[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+	return prefs
+}
+
+// Handler answers requests for op with the response the client prefers, or
+// the first declared success response.
+func (m *Mock) Handler(op Operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefer := ParsePrefer(r.Header.Get("Prefer"))
+		if code := prefer["code"]; code != "" {
+			if n, err := strconv.Atoi(code); err != nil || n < 100 || n > 599 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid Prefer code %q (want 100-599)", code))
+				return
+			}
+		}
+
+		status, resp, err := selectResponse(op.op, prefer["code"])
+		if err != nil {
+			writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+
+		for name, header := range resp.Headers {
+			if strings.EqualFold(name, "Content-Type") || header.Value == nil {
+				continue
+			}
+			value := header.Value.Example
+			if value == nil {
+				value = Generate(header.Value.Schema)
+			}
+			if value != nil {
+				w.Header().Set(name, fmt.Sprint(value))
+			}
+		}
+
+		if len(resp.Content) == 0 {
+			w.WriteHeader(status)
+			return
+		}
+
+		contentType, media := selectMediaType(resp.Content, r.Header.Get("Accept"))
+		if media == nil {
+			writeError(w, http.StatusNotAcceptable, "No response representation matches the Accept header")
+			return
+		}
+
+		body, err := encode(contentType, exampleFor(media, prefer))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+// selectResponse picks the declared response for the preferred code, or the
+// lowest 2xx when there is no preference.
+func selectResponse(op *openapi3.Operation, preferred string) (int, *openapi3.Response, error) {
+	if op.Responses == nil {
+		return 0, nil, fmt.Errorf("operation declares no responses")
+	}
+	responses := op.Responses.Map()
+
+	if preferred != "" {
+		code, err := strconv.Atoi(preferred)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid Prefer code %q", preferred)
+		}
+		for _, key := range []string{preferred, preferred[:1] + "XX", "default"} {
+			if ref, ok := responses[key]; ok && ref.Value != nil {
+				return code, ref.Value, nil
+			}
+		}
+		return 0, nil, fmt.Errorf("response %d is not declared for this operation", code)
+	}
+
+	keys := make([]string, 0, len(responses))
+	for key := range responses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(key, "2") && responses[key].Value != nil {
+			code, err := strconv.Atoi(key)
+			if err != nil {
+				code = http.StatusOK // 2XX
+			}
+			return code, responses[key].Value, nil
+		}
+	}
+	if ref, ok := responses["default"]; ok && ref.Value != nil {
+		return http.StatusOK, ref.Value, nil
+	}
+	for _, key := range keys {
+		if code, err := strconv.Atoi(key); err == nil && responses[key].Value != nil {
+			return code, responses[key].Value, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("operation declares no usable responses")
+}
+
+// selectMediaType honours the Accept header, falling back to JSON.
+func selectMediaType(content openapi3.Content, accept string) (string, *openapi3.MediaType) {
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		// JSON first so it wins for */* and missing Accept headers
+		ji, jj := strings.Contains(types[i], "json"), strings.Contains(types[j], "json")
+		if ji != jj {
+			return ji
+		}
+		return types[i] < types[j]
+	})
+
+	if strings.TrimSpace(accept) == "" {
+		return types[0], content[types[0]]
+	}
+	for _, part := range strings.Split(accept, ",") {
+		want, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for _, t := range types {
+			if mediaMatches(want, t) {
+				return t, content[t]
+			}
+		}
+	}
+	return "", nil
+}
+
+func mediaMatches(want, have string) bool {
+	if want == "*/*" || strings.EqualFold(want, have) {
+		return true
+	}
+	wantType, wantSub, _ := strings.Cut(want, "/")
+	haveType, _, _ := strings.Cut(have, "/")
+	return wantSub == "*" && strings.EqualFold(wantType, haveType)
+}
+
+// exampleFor picks the named example from Prefer, the media type's example,
+// its first named example, or a value generated from the schema.
+func exampleFor(media *openapi3.MediaType, prefer map[string]string) interface{} {
+	if prefer["dynamic"] == "true" {
+		return Generate(media.Schema)
+	}
+	if name := prefer["example"]; name != "" {
+		if ex, ok := media.Examples[name]; ok && ex.Value != nil {
+			return ex.Value.Value
+		}
+	}
+	if media.Example != nil {
+		return media.Example
+	}
+	if len(media.Examples) > 0 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if ex := media.Examples[names[0]]; ex.Value != nil {
+			return ex.Value.Value
+		}
+	}
+	return Generate(media.Schema)
+}
+
+func encode(contentType string, value interface{}) ([]byte, error) {
+	if s, ok := value.(string); ok && !strings.Contains(contentType, "json") {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": message})
+}
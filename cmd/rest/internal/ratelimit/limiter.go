@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// counter is one client's state under one policy. A token bucket uses tokens
+// and updated; a fixed window uses count and start.
+type counter struct {
+	policy  Policy
+	tokens  float64
+	updated time.Time
+	count   int
+	start   time.Time
+}
+
+func (c *counter) take(now time.Time) Decision {
+	p := &c.policy
+	d := Decision{Limit: p.Limit, Window: p.window()}
+
+	if p.Algorithm == FixedWindow {
+		if now.Sub(c.start) >= p.window() {
+			c.start, c.count = now, 0
+		}
+		d.Reset = c.start.Add(p.window()).Sub(now)
+		if c.count < p.Limit {
+			c.count++
+			d.Allowed = true
+		}
+		d.Remaining = p.Limit - c.count
+		d.RetryAfter = d.Reset
+		return d
+	}
+
+	// refill at Limit tokens per window, up to the bucket's capacity
+	capacity := float64(p.capacity())
+	rate := float64(p.Limit) / float64(p.window())
+	c.tokens = math.Min(capacity, c.tokens+float64(now.Sub(c.updated))*rate)
+	c.updated = now
+	if c.tokens >= 1 {
+		c.tokens--
+		d.Allowed = true
+	}
+	d.Remaining = int(c.tokens)
+	d.Reset = time.Duration((capacity - c.tokens) / rate)
+	d.RetryAfter = time.Duration((1 - c.tokens) / rate)
+	return d
+}
+
+func (c *counter) peek(now time.Time) (int, time.Duration) {
+	p := &c.policy
+	if p.Algorithm == FixedWindow {
+		if now.Sub(c.start) >= p.window() {
+			return p.Limit, 0
+		}
+		return p.Limit - c.count, c.start.Add(p.window()).Sub(now)
+	}
+	capacity := float64(p.capacity())
+	rate := float64(p.Limit) / float64(p.window())
+	tokens := math.Min(capacity, c.tokens+float64(now.Sub(c.updated))*rate)
+	return int(tokens), time.Duration((capacity - tokens) / rate)
+}
+
+// Counter describes a client's standing for the admin API.
+type Counter struct {
+	Scope     string    `json:"scope"`
+	Client    string    `json:"client"`
+	Algorithm string    `json:"algorithm"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+type counterKey struct {
+	scope, client string
+}
+
+// Limiter keeps a counter per scope and client. The scope is "global" or the
+// route whose policy applies.
+type Limiter struct {
+	mu       sync.Mutex
+	counters map[counterKey]*counter
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{counters: map[counterKey]*counter{}}
+}
+
+// Take counts a request from client against policy p in scope.
+func (l *Limiter) Take(scope, client string, p *Policy) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	key := counterKey{scope, client}
+	c, ok := l.counters[key]
+	// a changed policy starts the client afresh
+	if !ok || c.policy != *p {
+		c = &counter{policy: *p, tokens: float64(p.capacity()), updated: now, start: now}
+		l.counters[key] = c
+	}
+	return c.take(now)
+}
+
+// Counters lists the counters, optionally only those of scope.
+func (l *Limiter) Counters(scope string) []Counter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	out := []Counter{}
+	for key, c := range l.counters {
+		if scope != "" && key.scope != scope {
+			continue
+		}
+		remaining, reset := c.peek(now)
+		out = append(out, Counter{
+			Scope:     key.scope,
+			Client:    key.client,
+			Algorithm: c.policy.Algorithm,
+			Limit:     c.policy.Limit,
+			Remaining: remaining,
+			ResetAt:   now.Add(reset),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Scope != out[j].Scope {
+			return out[i].Scope < out[j].Scope
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out
+}
+
+// Reset restores quotas: every counter, a scope's, or one client's within a
+// scope.
+func (l *Limiter) Reset(scope, client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.counters {
+		if (scope == "" || key.scope == scope) && (client == "" || key.client == client) {
+			delete(l.counters, key)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package ratelimit simulates rate-limited APIs with token buckets or fixed
+// windows, counted per client.
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	TokenBucket = "token-bucket"
+	FixedWindow = "fixed-window"
+)
+
+// Policy limits requests to Limit per WindowMs for each client.
+type Policy struct {
+	// Algorithm is TokenBucket (the default) or FixedWindow.
+	Algorithm string `yaml:"algorithm" json:"algorithm,omitempty"`
+	// Limit is the number of requests allowed per window; 0 disables
+	// limiting, which lets a route opt out of the global policy.
+	Limit    int `yaml:"limit" json:"limit"`
+	WindowMs int `yaml:"window_ms" json:"windowMs"`
+	// Burst is a token bucket's capacity; it defaults to Limit. Tokens are
+	// refilled at Limit per window.
+	Burst int `yaml:"burst" json:"burst,omitempty"`
+	// Key counts clients separately by "ip" (the default), "token" (the
+	// Authorization header) or "header:<Name>".
+	Key string `yaml:"key" json:"key,omitempty"`
+}
+
+// Validate checks the policy and fills in defaults.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Algorithm {
+	case "":
+		p.Algorithm = TokenBucket
+	case TokenBucket, FixedWindow:
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q (want %s or %s)", p.Algorithm, TokenBucket, FixedWindow)
+	}
+	if p.Limit < 0 || p.Burst < 0 {
+		return fmt.Errorf("limit and burst must not be negative")
+	}
+	if p.Limit > 0 && p.WindowMs <= 0 {
+		return fmt.Errorf("window_ms must be positive")
+	}
+	if p.Burst > 0 && p.Algorithm != TokenBucket {
+		return fmt.Errorf("burst only applies to %s", TokenBucket)
+	}
+	switch {
+	case p.Key == "":
+		p.Key = "ip"
+	case p.Key == "ip", p.Key == "token":
+	case strings.HasPrefix(p.Key, "header:") && len(p.Key) > len("header:"):
+	default:
+		return fmt.Errorf("unknown rate limit key %q (want ip, token or header:<Name>)", p.Key)
+	}
+	return nil
+}
+
+func (p *Policy) window() time.Duration {
+	return time.Duration(p.WindowMs) * time.Millisecond
+}
+
+func (p *Policy) capacity() int {
+	if p.Algorithm == TokenBucket && p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// ClientKey identifies the caller of r according to the policy's key.
+func (p *Policy) ClientKey(r *http.Request) string {
+	switch {
+	case p.Key == "token":
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	case strings.HasPrefix(p.Key, "header:"):
+		return r.Header.Get(strings.TrimPrefix(p.Key, "header:"))
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Decision is the outcome of counting one request.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client should wait.
+	RetryAfter time.Duration
+	Window     time.Duration
+}
+
+// WriteHeaders sets both the X-RateLimit-* headers and the IETF RateLimit
+// and RateLimit-Policy fields, plus Retry-After when the request is rejected.
+func (d Decision) WriteHeaders(h http.Header) {
+	reset := seconds(d.Reset)
+	h.Set("X-RateLimit-Limit", fmt.Sprint(d.Limit))
+	h.Set("X-RateLimit-Remaining", fmt.Sprint(d.Remaining))
+	h.Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(d.Reset).Unix()))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", d.Limit, seconds(d.Window)))
+	h.Set("RateLimit", fmt.Sprintf("limit=%d, remaining=%d, reset=%d", d.Limit, d.Remaining, reset))
+	if !d.Allowed {
+		h.Set("Retry-After", fmt.Sprint(seconds(d.RetryAfter)))
+	}
+}
+
+// seconds rounds up so clients never retry too early.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
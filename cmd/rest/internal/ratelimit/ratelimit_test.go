@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"defaults", Policy{Limit: 5, WindowMs: 1000}, false},
+		{"fixed window", Policy{Algorithm: FixedWindow, Limit: 5, WindowMs: 1000, Key: "token"}, false},
+		{"burst", Policy{Limit: 5, WindowMs: 1000, Burst: 10, Key: "header:X-Api-Key"}, false},
+		{"disabled", Policy{Limit: 0}, false},
+		{"unknown algorithm", Policy{Algorithm: "leaky-bucket", Limit: 5, WindowMs: 1000}, true},
+		{"negative limit", Policy{Limit: -1, WindowMs: 1000}, true},
+		{"no window", Policy{Limit: 5}, true},
+		{"burst on a fixed window", Policy{Algorithm: FixedWindow, Limit: 5, WindowMs: 1000, Burst: 10}, true},
+		{"unknown key", Policy{Limit: 5, WindowMs: 1000, Key: "cookie"}, true},
+		{"header key without a name", Policy{Limit: 5, WindowMs: 1000, Key: "header:"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (p.Algorithm == "" || p.Key == "") {
+				t.Errorf("Validate() left defaults unset: %+v", p)
+			}
+		})
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := &counter{policy: Policy{Algorithm: FixedWindow, Limit: 2, WindowMs: 1000}, start: start}
+	steps := []struct {
+		after     time.Duration
+		allowed   bool
+		remaining int
+		reset     time.Duration
+	}{
+		{0, true, 1, time.Second},
+		{100 * time.Millisecond, true, 0, 900 * time.Millisecond},
+		{200 * time.Millisecond, false, 0, 800 * time.Millisecond},
+		{time.Second, true, 1, time.Second},
+	}
+	for i, s := range steps {
+		d := c.take(start.Add(s.after))
+		if d.Allowed != s.allowed || d.Remaining != s.remaining || d.Reset != s.reset {
+			t.Errorf("request %d: got allowed %v, remaining %d, reset %v; want %v, %d, %v",
+				i, d.Allowed, d.Remaining, d.Reset, s.allowed, s.remaining, s.reset)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(1000, 0)
+	// two tokens a second, up to a burst of three
+	p := Policy{Algorithm: TokenBucket, Limit: 2, WindowMs: 1000, Burst: 3}
+	c := &counter{policy: p, tokens: 3, updated: start}
+	steps := []struct {
+		after     time.Duration
+		allowed   bool
+		remaining int
+	}{
+		{0, true, 2},
+		{0, true, 1},
+		{0, true, 0},
+		{0, false, 0},
+		{500 * time.Millisecond, true, 0},
+		{10 * time.Second, true, 2},
+	}
+	for i, s := range steps {
+		d := c.take(start.Add(s.after))
+		if d.Allowed != s.allowed || d.Remaining != s.remaining {
+			t.Errorf("request %d: got allowed %v, remaining %d; want %v, %d", i, d.Allowed, d.Remaining, s.allowed, s.remaining)
+		}
+		if !d.Allowed && d.RetryAfter.Round(time.Millisecond) != 500*time.Millisecond {
+			t.Errorf("request %d: retry after %v, want 500ms", i, d.RetryAfter)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter()
+	p := &Policy{Algorithm: FixedWindow, Limit: 1, WindowMs: 60000, Key: "ip"}
+
+	if !l.Take("global", "a", p).Allowed || l.Take("global", "a", p).Allowed {
+		t.Fatal("a second request within the window was allowed")
+	}
+	if !l.Take("global", "b", p).Allowed {
+		t.Error("clients share a counter")
+	}
+	if !l.Take("GET /customers", "a", p).Allowed {
+		t.Error("scopes share a counter")
+	}
+	changed := *p
+	changed.Limit = 2
+	if !l.Take("global", "a", &changed).Allowed {
+		t.Error("a changed policy did not start the client afresh")
+	}
+	if got := len(l.Counters("global")); got != 2 {
+		t.Errorf("Counters(global) has %d entries, want 2", got)
+	}
+
+	l.Reset("global", "b")
+	if got := l.Counters(""); len(got) != 2 || got[0].Scope != "GET /customers" || got[1].Client != "a" {
+		t.Errorf("Counters after resetting b = %+v", got)
+	}
+	l.Reset("", "")
+	if got := l.Counters(""); len(got) != 0 {
+		t.Errorf("Counters after resetting everything = %+v", got)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:5555"
+	r.Header.Set("Authorization", "Bearer abc")
+	r.Header.Set("X-Api-Key", "k1")
+
+	tests := []struct {
+		key, want string
+	}{
+		{"ip", "192.0.2.1"},
+		{"token", "abc"},
+		{"header:X-Api-Key", "k1"},
+	}
+	for _, tt := range tests {
+		p := &Policy{Key: tt.key}
+		if got := p.ClientKey(r); got != tt.want {
+			t.Errorf("ClientKey with key %q = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	h := http.Header{}
+	Decision{Limit: 5, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 200 * time.Millisecond, Window: time.Minute}.WriteHeaders(h)
+	want := map[string]string{
+		"X-RateLimit-Limit":     "5",
+		"X-RateLimit-Remaining": "0",
+		"RateLimit-Policy":      "5;w=60",
+		"RateLimit":             "limit=5, remaining=0, reset=2",
+		"Retry-After":           "1",
+	}
+	for k, v := range want {
+		if got := h.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := &Policy{Limit: 10, WindowMs: 1000}
+	route := &Policy{Limit: 0}
+	reg := NewRegistry(global, map[string]*Policy{"/health": route})
+
+	if scope, p := reg.Resolve("GET /health", "/health"); scope != "/health" || p != route {
+		t.Errorf("Resolve(/health) = %q, %v", scope, p)
+	}
+	if scope, p := reg.Resolve("GET /customers", "/customers"); scope != GlobalScope || p != global {
+		t.Errorf("Resolve(/customers) = %q, %v", scope, p)
+	}
+	if err := reg.SetRoute("/health", &Policy{Limit: 5}); err == nil {
+		t.Error("SetRoute accepted a policy without a window")
+	}
+}
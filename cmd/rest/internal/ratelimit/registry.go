@@ -0,0 +1,76 @@
+package ratelimit
+
+import "sync"
+
+// GlobalScope names the counters of the global policy.
+const GlobalScope = "global"
+
+// Registry holds the global and per-route policies.
+type Registry struct {
+	mu     sync.RWMutex
+	global *Policy
+	routes map[string]*Policy
+}
+
+func NewRegistry(global *Policy, routes map[string]*Policy) *Registry {
+	if routes == nil {
+		routes = map[string]*Policy{}
+	}
+	return &Registry{global: global, routes: routes}
+}
+
+func (reg *Registry) Global() *Policy {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.global
+}
+
+func (reg *Registry) SetGlobal(p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.global = p
+	return nil
+}
+
+// Routes returns a copy of the per-route policies keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string]*Policy {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]*Policy, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs a policy for a route; nil removes it.
+func (reg *Registry) SetRoute(route string, p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if p == nil {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = p
+	return nil
+}
+
+// Resolve picks the policy for a request and the scope its counters live in:
+// the first of routeKeys with a policy, else the global one. A nil policy
+// means the request is not limited.
+func (reg *Registry) Resolve(routeKeys ...string) (string, *Policy) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if p, ok := reg.routes[key]; ok {
+			return key, p
+		}
+	}
+	return GlobalScope, reg.global
+}
@@ -0,0 +1,290 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"mock-server/cmd/rest/internal/config"
+	"mock-server/cmd/rest/internal/stubs"
+	"mock-server/internal/common"
+)
+
+const redacted = "[REDACTED]"
+
+// hopHeaders are connection-level headers that must not be forwarded or
+// recorded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length", "Content-Encoding",
+}
+
+// Response is what the upstream answered.
+type Response struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+// ErrRecorded means an exchange was not recorded because a recording
+// already matches its request.
+var ErrRecorded = errors.New("exchange already recorded")
+
+// Recorder forwards requests to the configured upstream and turns the
+// exchanges into stub files.
+type Recorder struct {
+	mu     sync.RWMutex
+	cfg    config.Proxy
+	client *http.Client
+
+	// recorded holds the stubs in recordedDir, loaded when the first
+	// exchange is recorded there, so repeated requests are recorded once.
+	recordMu    sync.Mutex
+	recorded    *stubs.Store
+	recordedDir string
+}
+
+func New(cfg config.Proxy) *Recorder {
+	return &Recorder{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// redirects are part of the upstream's behaviour and get recorded as is
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (rec *Recorder) Config() config.Proxy {
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+	return rec.cfg
+}
+
+// SetMode switches between proxy, record and playback at runtime.
+func (rec *Recorder) SetMode(mode, upstream string) error {
+	switch mode {
+	case "", "proxy", "record", "playback":
+	default:
+		return fmt.Errorf("unknown proxy mode %q", mode)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if upstream != "" {
+		rec.cfg.Upstream = upstream
+	}
+	if (mode == "proxy" || mode == "record") && rec.cfg.Upstream == "" {
+		return fmt.Errorf("proxy mode %q requires an upstream", mode)
+	}
+	rec.cfg.Mode = mode
+	return nil
+}
+
+// Forwarding reports whether unmatched requests go to the upstream.
+func (rec *Recorder) Forwarding() bool {
+	mode := rec.Config().Mode
+	return mode == "proxy" || mode == "record"
+}
+
+// Recording reports whether forwarded exchanges are written to disk.
+func (rec *Recorder) Recording() bool {
+	return rec.Config().Mode == "record"
+}
+
+// Forward replays req against the upstream.
+func (rec *Recorder) Forward(req *stubs.Request) (*Response, error) {
+	cfg := rec.Config()
+	target := strings.TrimSuffix(cfg.Upstream, "/") + req.URL
+
+	out, err := http.NewRequest(req.Method, target, strings.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	out.Header = req.Headers.Clone()
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	// let the transport negotiate compression so the recorded body is plain
+	out.Header.Del("Accept-Encoding")
+
+	resp, err := rec.client.Do(out)
+	if err != nil {
+		return nil, fmt.Errorf("forward to %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read upstream response: %w", err)
+	}
+
+	headers := resp.Header.Clone()
+	for _, h := range hopHeaders {
+		headers.Del(h)
+	}
+	return &Response{Status: resp.StatusCode, Headers: headers, Body: body}, nil
+}
+
+// Record converts the exchange into a stub and writes it to the recordings
+// directory, returning the stub and the file it was written to. When a
+// recording already matches req, it returns that one and ErrRecorded.
+func (rec *Recorder) Record(req *stubs.Request, resp *Response) (*stubs.Stub, string, error) {
+	cfg := rec.Config()
+	if cfg.RecordingsDir == "" {
+		return nil, "", fmt.Errorf("no recordings directory configured")
+	}
+
+	rec.recordMu.Lock()
+	defer rec.recordMu.Unlock()
+	if rec.recorded == nil || rec.recordedDir != cfg.RecordingsDir {
+		recorded := stubs.NewStore()
+		if _, err := os.Stat(cfg.RecordingsDir); err == nil {
+			if _, err := recorded.LoadDir(cfg.RecordingsDir); err != nil {
+				return nil, "", err
+			}
+		}
+		rec.recorded, rec.recordedDir = recorded, cfg.RecordingsDir
+	}
+	if existing, ok := rec.recorded.Match(req); ok {
+		return existing, existing.Source, ErrRecorded
+	}
+
+	stub := &stubs.Stub{
+		ID:       common.NewID(),
+		Name:     fmt.Sprintf("Recorded %s %s", req.Method, req.Path),
+		Request:  rec.requestPattern(cfg, req),
+		Response: rec.responseDefinition(cfg, resp),
+	}
+	if err := stub.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	if err := os.MkdirAll(cfg.RecordingsDir, 0755); err != nil {
+		return nil, "", err
+	}
+	data, err := json.MarshalIndent(stub, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(cfg.RecordingsDir, fileName(req, stub.ID))
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return nil, "", err
+	}
+	stub.Source = path
+	if err := rec.recorded.Add(stub); err != nil {
+		return nil, "", err
+	}
+	return stub, path, nil
+}
+
+func (rec *Recorder) requestPattern(cfg config.Proxy, req *stubs.Request) stubs.RequestPattern {
+	pattern := stubs.RequestPattern{Method: req.Method, URL: req.URL}
+
+	for _, name := range cfg.CaptureHeaders {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		values, ok := req.Headers[key]
+		if !ok {
+			continue
+		}
+		if pattern.Headers == nil {
+			pattern.Headers = map[string]stubs.StringMatcher{}
+		}
+		if containsFold(cfg.RedactHeaders, key) {
+			// the secret is not stored, so only its presence can be required
+			pattern.Headers[key] = stubs.Matching(".+")
+			continue
+		}
+		pattern.Headers[key] = stubs.EqualTo(strings.Join(values, ","))
+	}
+
+	if req.Body != "" {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(req.Body), &decoded); err == nil {
+			body, _ := json.Marshal(redactFields(decoded, cfg.RedactBodyFields))
+			matcher := stubs.StringMatcher{EqualToJSON: body, IgnoreFields: cfg.IgnoreBodyFields}
+			// a redacted value never equals the live one, so ignore it too
+			matcher.IgnoreFields = append(matcher.IgnoreFields, cfg.RedactBodyFields...)
+			pattern.BodyPatterns = []stubs.StringMatcher{matcher}
+		} else {
+			pattern.BodyPatterns = []stubs.StringMatcher{stubs.EqualTo(req.Body)}
+		}
+	}
+
+	return pattern
+}
+
+func (rec *Recorder) responseDefinition(cfg config.Proxy, resp *Response) stubs.ResponseDefinition {
+	def := stubs.ResponseDefinition{Status: resp.Status, Headers: map[string]string{}}
+
+	for key, values := range resp.Headers {
+		switch {
+		case containsFold(cfg.IgnoreHeaders, key):
+			continue
+		case containsFold(cfg.RedactHeaders, key):
+			def.Headers[key] = redacted
+		default:
+			def.Headers[key] = strings.Join(values, ",")
+		}
+	}
+
+	var decoded interface{}
+	if len(bytes.TrimSpace(resp.Body)) > 0 && json.Unmarshal(resp.Body, &decoded) == nil {
+		decoded = stubs.StripFields(decoded, cfg.IgnoreBodyFields)
+		def.JSONBody, _ = json.Marshal(redactFields(decoded, cfg.RedactBodyFields))
+	} else {
+		def.Body = string(resp.Body)
+	}
+
+	return def
+}
+
+// redactFields masks the values of the named keys in every object of a
+// decoded JSON value.
+func redactFields(v interface{}, fields []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if containsFold(fields, k) {
+				val[k] = redacted
+				continue
+			}
+			val[k] = redactFields(child, fields)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactFields(child, fields)
+		}
+	}
+	return v
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func fileName(req *stubs.Request, id string) string {
+	path := strings.Trim(unsafeChars.ReplaceAllString(req.Path, "-"), "-")
+	if path == "" {
+		path = "root"
+	}
+	return fmt.Sprintf("%s-%s-%s.json", strings.ToLower(req.Method), path, id[:8])
+}
@@ -0,0 +1,54 @@
+package sequence
+
+import "sync"
+
+// Registry holds the response sequences configured for built-in routes.
+type Registry struct {
+	mu     sync.RWMutex
+	routes map[string]*Route
+}
+
+func NewRegistry(routes map[string]*Route) *Registry {
+	if routes == nil {
+		routes = map[string]*Route{}
+	}
+	return &Registry{routes: routes}
+}
+
+// Routes returns a copy of the sequences keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string]*Route {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]*Route, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs a sequence for a route; nil removes it.
+func (reg *Registry) SetRoute(route string, seq *Route) error {
+	if err := seq.Validate(); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if seq == nil {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = seq
+	return nil
+}
+
+// Resolve returns the sequence for the first of routeKeys that has one.
+func (reg *Registry) Resolve(routeKeys ...string) (string, *Route) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if seq, ok := reg.routes[key]; ok {
+			return key, seq
+		}
+	}
+	return "", nil
+}
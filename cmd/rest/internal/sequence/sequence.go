@@ -0,0 +1,216 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RepeatLast keeps serving the final response once the list is exhausted.
+	RepeatLast = "repeat-last"
+	// Cycle starts over from the first response.
+	Cycle = "cycle"
+)
+
+// Settings controls how a list of responses is walked.
+type Settings struct {
+	// Mode is RepeatLast (the default) or Cycle.
+	Mode string `json:"mode,omitempty" yaml:"mode"`
+	// Key tracks the position separately per client: "ip", "token" (the
+	// Authorization header) or "header:<Name>". Empty shares one position.
+	Key string `json:"key,omitempty" yaml:"key"`
+	// ResetAfterMs restarts a sequence that has been idle this long.
+	ResetAfterMs int `json:"resetAfterMs,omitempty" yaml:"reset_after_ms"`
+}
+
+func (s *Settings) Validate() error {
+	if s == nil {
+		return nil
+	}
+	switch s.Mode {
+	case "", RepeatLast, Cycle:
+	default:
+		return fmt.Errorf("unknown sequence mode %q (want %s or %s)", s.Mode, RepeatLast, Cycle)
+	}
+	switch {
+	case s.Key == "", s.Key == "ip", s.Key == "token":
+	case strings.HasPrefix(s.Key, "header:") && len(s.Key) > len("header:"):
+	default:
+		return fmt.Errorf("unknown sequence key %q (want ip, token or header:<Name>)", s.Key)
+	}
+	if s.ResetAfterMs < 0 {
+		return fmt.Errorf("resetAfterMs must not be negative")
+	}
+	return nil
+}
+
+// ClientKey identifies the caller of r according to the settings.
+func (s *Settings) ClientKey(r *http.Request) string {
+	if s == nil {
+		return ""
+	}
+	switch {
+	case s.Key == "ip":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	case s.Key == "token":
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	case strings.HasPrefix(s.Key, "header:"):
+		return r.Header.Get(strings.TrimPrefix(s.Key, "header:"))
+	}
+	return ""
+}
+
+// Response is one step of a built-in route's sequence. Passthrough lets the
+// route's real handler answer that step.
+type Response struct {
+	Status      int               `json:"status,omitempty" yaml:"status"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers"`
+	Body        string            `json:"body,omitempty" yaml:"body"`
+	JSONBody    interface{}       `json:"jsonBody,omitempty" yaml:"json_body"`
+	Passthrough bool              `json:"passthrough,omitempty" yaml:"passthrough"`
+}
+
+// Write sends the response.
+func (resp Response) Write(w http.ResponseWriter) {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	body := []byte(resp.Body)
+	if resp.JSONBody != nil {
+		body, _ = json.Marshal(resp.JSONBody)
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Route is a sequence of responses for a built-in route.
+type Route struct {
+	Settings  `yaml:",inline"`
+	Responses []Response `json:"responses" yaml:"responses"`
+}
+
+func (r *Route) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if len(r.Responses) == 0 {
+		return fmt.Errorf("a sequence needs at least one response")
+	}
+	for i, resp := range r.Responses {
+		if resp.Status != 0 && (resp.Status < 100 || resp.Status > 599) {
+			return fmt.Errorf("responses[%d] status %d is not a valid HTTP status", i, resp.Status)
+		}
+	}
+	return r.Settings.Validate()
+}
+
+// Position is where one client is within one sequence.
+type Position struct {
+	Sequence string    `json:"sequence"`
+	Client   string    `json:"client,omitempty"`
+	Served   int       `json:"served"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Tracker remembers how far each client has got through each sequence. It is
+// safe for concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	positions map[string]map[string]*Position
+	now       func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{positions: map[string]map[string]*Position{}, now: time.Now}
+}
+
+// Next returns the index of the response to serve for the request to
+// sequence id, out of n responses, and advances the client's position.
+func (t *Tracker) Next(id string, s *Settings, r *http.Request, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	if s == nil {
+		s = &Settings{}
+	}
+	client := s.ClientKey(r)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clients, ok := t.positions[id]
+	if !ok {
+		clients = map[string]*Position{}
+		t.positions[id] = clients
+	}
+	now := t.now()
+	pos, ok := clients[client]
+	if !ok || (s.ResetAfterMs > 0 && now.Sub(pos.LastSeen) >= time.Duration(s.ResetAfterMs)*time.Millisecond) {
+		pos = &Position{Sequence: id, Client: client}
+		clients[client] = pos
+	}
+
+	index := pos.Served
+	if s.Mode == Cycle {
+		index %= n
+	} else if index >= n {
+		index = n - 1
+	}
+	pos.Served++
+	pos.LastSeen = now
+	return index
+}
+
+// Positions lists every tracked position ordered by sequence and client.
+func (t *Tracker) Positions() []Position {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []Position
+	for _, clients := range t.positions {
+		for _, pos := range clients {
+			out = append(out, *pos)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Sequence != out[j].Sequence {
+			return out[i].Sequence < out[j].Sequence
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out
+}
+
+// Reset restarts sequences. An empty id restarts every sequence; an empty
+// client restarts every client of the sequence.
+func (t *Tracker) Reset(id, client string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case id == "":
+		t.positions = map[string]map[string]*Position{}
+	case client == "":
+		delete(t.positions, id)
+	default:
+		delete(t.positions[id], client)
+	}
+}
@@ -0,0 +1,225 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"mock-server/internal/common"
+)
+
+// clientBuffer is how many frames may wait for a slow client before pushes to
+// it are dropped.
+const clientBuffer = 64
+
+var ErrNoEndpoint = errors.New("no stream endpoint at that path")
+
+// Client is a connected stream consumer.
+type Client struct {
+	ID          string    `json:"id"`
+	Path        string    `json:"path"`
+	Kind        string    `json:"kind"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Sent        int       `json:"sent"`
+	Received    int       `json:"received"`
+
+	frames chan Frame
+}
+
+// Frames delivers the frames pushed to the client.
+func (c *Client) Frames() <-chan Frame {
+	return c.frames
+}
+
+// Hub holds the streaming endpoints, keyed by path, and their clients.
+type Hub struct {
+	mu        sync.RWMutex
+	endpoints map[string]*Endpoint
+	clients   map[string]*Client
+}
+
+func NewHub(endpoints map[string]*Endpoint) *Hub {
+	if endpoints == nil {
+		endpoints = map[string]*Endpoint{}
+	}
+	return &Hub{endpoints: endpoints, clients: map[string]*Client{}}
+}
+
+// Endpoints returns a copy of the endpoints keyed by path.
+func (h *Hub) Endpoints() map[string]*Endpoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make(map[string]*Endpoint, len(h.endpoints))
+	for k, v := range h.endpoints {
+		out[k] = v
+	}
+	return out
+}
+
+// SetEndpoint installs an endpoint at path; nil removes it. Clients already
+// connected keep their script.
+func (h *Hub) SetEndpoint(path string, e *Endpoint) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e == nil {
+		delete(h.endpoints, path)
+		return nil
+	}
+	h.endpoints[path] = e
+	return nil
+}
+
+// Endpoint returns the endpoint at path.
+func (h *Hub) Endpoint(path string) (*Endpoint, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.endpoints[path]
+	return e, ok
+}
+
+// Connect registers a new client of the endpoint at path.
+func (h *Hub) Connect(path, kind, remoteAddr string) *Client {
+	c := &Client{
+		ID:          common.NewID(),
+		Path:        path,
+		Kind:        kind,
+		RemoteAddr:  remoteAddr,
+		ConnectedAt: time.Now(),
+		frames:      make(chan Frame, clientBuffer),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c.ID] = c
+	return c
+}
+
+// Disconnect forgets a client.
+func (h *Hub) Disconnect(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c.ID)
+}
+
+// Sent and Received count a client's traffic.
+func (h *Hub) Sent(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.Sent++
+}
+
+func (h *Hub) Received(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.Received++
+}
+
+// Clients lists the connected clients, optionally only those of path.
+func (h *Hub) Clients(path string) []Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := []Client{}
+	for _, c := range h.clients {
+		if path == "" || c.Path == path {
+			out = append(out, *c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ConnectedAt.Before(out[j].ConnectedAt) })
+	return out
+}
+
+// Push queues a frame for every client of path, or only for the client with
+// clientID, and returns how many clients it was queued for. Clients whose
+// buffer is full miss it.
+func (h *Hub) Push(path, clientID string, frame Frame) (int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok := h.endpoints[path]; !ok && path != "" {
+		return 0, ErrNoEndpoint
+	}
+
+	delivered := 0
+	for _, c := range h.clients {
+		if (path != "" && c.Path != path) || (clientID != "" && c.ID != clientID) {
+			continue
+		}
+		select {
+		case c.frames <- frame:
+			delivered++
+		default:
+		}
+	}
+	return delivered, nil
+}
+
+// Queue hands a frame to the client's writer, waiting while its buffer is
+// full.
+func (h *Hub) Queue(ctx context.Context, c *Client, frame Frame) error {
+	select {
+	case c.frames <- frame:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Serve plays the endpoint's script to a client and writes every frame queued
+// for it until ctx is done, write fails, or the script ends on a closing
+// endpoint. data supplies the template data for scripted messages.
+func (h *Hub) Serve(ctx context.Context, c *Client, e *Endpoint, data Data, write func(Frame) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	script := make(chan error, 1)
+	go func() {
+		queue := func(f Frame) error { return h.Queue(ctx, c, f) }
+		for {
+			err := Play(ctx, e.Messages, data, queue)
+			if err != nil || !e.Repeat || len(e.Messages) == 0 {
+				script <- err
+				return
+			}
+		}
+	}()
+
+	send := func(f Frame) error {
+		if err := write(f); err != nil {
+			return err
+		}
+		h.Sent(c)
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case f := <-c.frames:
+			if err := send(f); err != nil {
+				return err
+			}
+		case err := <-script:
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+			script = nil
+			if !e.Close {
+				continue
+			}
+			for {
+				select {
+				case f := <-c.frames:
+					if err := send(f); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package stream mocks streaming endpoints: Server-Sent Events and
+// WebSockets that play scripted messages, answer inbound frames and accept
+// messages pushed through the admin API.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"mock-server/cmd/rest/internal/tmpl"
+)
+
+const (
+	KindSSE       = "sse"
+	KindWebSocket = "websocket"
+)
+
+// Message is one scripted message. Data is a template rendered against Data;
+// JSON, when set, is sent marshalled instead.
+type Message struct {
+	// DelayMs is the wait before this message, counted from the previous one.
+	DelayMs int         `json:"delayMs,omitempty" yaml:"delay_ms"`
+	Event   string      `json:"event,omitempty" yaml:"event"`
+	ID      string      `json:"id,omitempty" yaml:"id"`
+	Data    string      `json:"data,omitempty" yaml:"data"`
+	JSON    interface{} `json:"json,omitempty" yaml:"json"`
+}
+
+// Reply answers inbound WebSocket frames matching the regular expression
+// Match; an empty Match answers every frame. Only the first matching reply
+// is used.
+type Reply struct {
+	Match    string    `json:"match,omitempty" yaml:"match"`
+	Messages []Message `json:"messages" yaml:"messages"`
+
+	re *regexp.Regexp
+}
+
+// Endpoint is a mocked streaming endpoint.
+type Endpoint struct {
+	// Kind is sse or websocket.
+	Kind string `json:"kind" yaml:"kind"`
+	// Messages are played to every client once it connects.
+	Messages []Message `json:"messages,omitempty" yaml:"messages"`
+	// Repeat plays Messages again and again until the client leaves.
+	Repeat bool `json:"repeat,omitempty" yaml:"repeat"`
+	// Close ends the stream once Messages have been played.
+	Close bool `json:"close,omitempty" yaml:"close"`
+	// RetryMs is sent to SSE clients as their reconnection delay.
+	RetryMs int `json:"retryMs,omitempty" yaml:"retry_ms"`
+	// Echo sends every inbound WebSocket frame straight back.
+	Echo    bool    `json:"echo,omitempty" yaml:"echo"`
+	Replies []Reply `json:"replies,omitempty" yaml:"replies"`
+}
+
+// Validate checks the endpoint and compiles its patterns.
+func (e *Endpoint) Validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Kind {
+	case KindSSE:
+		if e.Echo || len(e.Replies) > 0 {
+			return fmt.Errorf("echo and replies need a websocket endpoint")
+		}
+	case KindWebSocket:
+	default:
+		return fmt.Errorf("unknown stream kind %q (want %s or %s)", e.Kind, KindSSE, KindWebSocket)
+	}
+	if e.Repeat && e.Close {
+		return fmt.Errorf("repeat and close cannot be combined")
+	}
+	if e.RetryMs < 0 {
+		return fmt.Errorf("retryMs must not be negative")
+	}
+	if err := validateMessages("messages", e.Messages); err != nil {
+		return err
+	}
+	for i := range e.Replies {
+		reply := &e.Replies[i]
+		re, err := regexp.Compile(reply.Match)
+		if err != nil {
+			return fmt.Errorf("replies[%d]: %w", i, err)
+		}
+		reply.re = re
+		if err := validateMessages(fmt.Sprintf("replies[%d].messages", i), reply.Messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateMessages(field string, messages []Message) error {
+	for i, m := range messages {
+		if m.DelayMs < 0 {
+			return fmt.Errorf("%s[%d]: delayMs must not be negative", field, i)
+		}
+		if _, err := tmpl.Parse("data", m.Data); err != nil {
+			return fmt.Errorf("%s[%d]: %w", field, i, err)
+		}
+	}
+	return nil
+}
+
+// Reply returns the messages answering frame and the pattern's submatches.
+func (e *Endpoint) Reply(frame string) ([]Message, []string) {
+	for _, reply := range e.Replies {
+		if m := reply.re.FindStringSubmatch(frame); m != nil {
+			return reply.Messages, m
+		}
+	}
+	return nil, nil
+}
+
+// Data is what message templates are rendered against, e.g.
+// {{.Client}}, {{.Request.Param "topic"}}, {{.JSON.id}} or
+// {{index .Matches 1}}. Frame, JSON and Matches describe the inbound frame
+// being answered and are empty for scripted messages.
+type Data struct {
+	Request tmpl.Request
+	Client  string
+	Frame   string
+	JSON    interface{}
+	Matches []string
+}
+
+// Frame is a rendered message ready to be written.
+type Frame struct {
+	Event string `json:"event,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Data  string `json:"data"`
+}
+
+// Render turns a message into a frame.
+func (m Message) Render(data Data) (Frame, error) {
+	frame := Frame{Event: m.Event, ID: m.ID}
+	if m.JSON != nil {
+		out, err := json.Marshal(m.JSON)
+		if err != nil {
+			return Frame{}, err
+		}
+		frame.Data = string(out)
+		return frame, nil
+	}
+	var err error
+	frame.Data, err = tmpl.Render("data", m.Data, data)
+	return frame, err
+}
+
+// Play renders and sends messages in order, honouring their delays. It stops
+// early when ctx is done or send fails.
+func Play(ctx context.Context, messages []Message, data Data, send func(Frame) error) error {
+	for _, m := range messages {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(m.DelayMs) * time.Millisecond):
+		}
+		frame, err := m.Render(data)
+		if err != nil {
+			return err
+		}
+		if err := send(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// StringMatcher describes how a single value (header, query parameter, body)
+// must look. Exactly one operator is expected to be set.
+type StringMatcher struct {
+	EqualTo     *string         `json:"equalTo,omitempty"`
+	Contains    *string         `json:"contains,omitempty"`
+	Matches     *string         `json:"matches,omitempty"`
+	EqualToJSON json.RawMessage `json:"equalToJson,omitempty"`
+	Absent      bool            `json:"absent,omitempty"`
+
+	// IgnoreFields lists JSON object keys, at any depth, that equalToJson
+	// leaves out of the comparison.
+	IgnoreFields []string `json:"ignoreFields,omitempty"`
+}
+
+func (m StringMatcher) validate() error {
+	if m.Matches != nil {
+		if _, err := regexp.Compile(*m.Matches); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", *m.Matches, err)
+		}
+	}
+	if len(m.EqualToJSON) > 0 && !json.Valid(m.EqualToJSON) {
+		return fmt.Errorf("equalToJson is not valid JSON")
+	}
+	return nil
+}
+
+// Match reports whether the value satisfies the matcher. present is false when
+// the value was missing from the request entirely.
+func (m StringMatcher) Match(value string, present bool) bool {
+	if m.Absent {
+		return !present
+	}
+	if !present {
+		return false
+	}
+
+	switch {
+	case m.EqualTo != nil:
+		return value == *m.EqualTo
+	case m.Contains != nil:
+		return strings.Contains(value, *m.Contains)
+	case m.Matches != nil:
+		re, err := regexp.Compile("^(?:" + *m.Matches + ")$")
+		return err == nil && re.MatchString(value)
+	case len(m.EqualToJSON) > 0:
+		var expected, actual interface{}
+		if err := json.Unmarshal(m.EqualToJSON, &expected); err != nil {
+			return false
+		}
+		if err := json.Unmarshal([]byte(value), &actual); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(StripFields(expected, m.IgnoreFields), StripFields(actual, m.IgnoreFields))
+	default:
+		return true
+	}
+}
+
+// String renders the matcher for diagnostics, e.g. `contains "foo"`.
+func (m StringMatcher) String() string {
+	switch {
+	case m.Absent:
+		return "absent"
+	case m.EqualTo != nil:
+		return fmt.Sprintf("equalTo %q", *m.EqualTo)
+	case m.Contains != nil:
+		return fmt.Sprintf("contains %q", *m.Contains)
+	case m.Matches != nil:
+		return fmt.Sprintf("matches %q", *m.Matches)
+	case len(m.EqualToJSON) > 0:
+		return "equalToJson " + string(m.EqualToJSON)
+	default:
+		return "anything"
+	}
+}
+
+// literal returns the value the matcher compares against, used to score how
+// close a mismatching value came.
+func (m StringMatcher) literal() (string, bool) {
+	switch {
+	case m.EqualTo != nil:
+		return *m.EqualTo, true
+	case m.Contains != nil:
+		return *m.Contains, true
+	case len(m.EqualToJSON) > 0:
+		return string(m.EqualToJSON), true
+	default:
+		return "", false
+	}
+}
+
+// EqualTo is a shorthand for building an exact matcher.
+func EqualTo(value string) StringMatcher {
+	return StringMatcher{EqualTo: &value}
+}
+
+// Matching is a shorthand for building a regular expression matcher.
+func Matching(pattern string) StringMatcher {
+	return StringMatcher{Matches: &pattern}
+}
+
+// StripFields removes the named keys from every object in a decoded JSON
+// value.
+func StripFields(v interface{}, fields []string) interface{} {
+	if len(fields) == 0 {
+		return v
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, f := range fields {
+			delete(val, f)
+		}
+		for k, child := range val {
+			val[k] = StripFields(child, fields)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = StripFields(child, fields)
+		}
+	}
+	return v
+}
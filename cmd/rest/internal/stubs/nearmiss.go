@@ -0,0 +1,88 @@
+package stubs
+
+import "sort"
+
+// Candidate is anything a request could have been meant for: a stub mapping or
+// a built-in route described as a pattern.
+type Candidate struct {
+	Kind    string
+	ID      string
+	Name    string
+	Pattern RequestPattern
+
+	// scenario holds a stub's unmet scenario requirement, if any
+	scenario []FieldDiff
+}
+
+// NearMiss is a candidate that did not match, together with what differed.
+type NearMiss struct {
+	Kind     string      `json:"kind"`
+	ID       string      `json:"id,omitempty"`
+	Name     string      `json:"name,omitempty"`
+	Distance float64     `json:"distance"`
+	Diffs    []FieldDiff `json:"diffs"`
+	Request  *Request    `json:"request,omitempty"`
+}
+
+// StubCandidates describes the store's stubs as near-miss candidates.
+func (s *Store) StubCandidates() []Candidate {
+	var out []Candidate
+	for _, stub := range s.All() {
+		out = append(out, Candidate{Kind: "stub", ID: stub.ID, Name: stub.Name, Pattern: stub.Request, scenario: s.scenarioDiff(stub)})
+	}
+	return out
+}
+
+// FindNearMisses ranks the candidates by how close they came to matching req
+// and returns at most limit of them.
+func FindNearMisses(req *Request, candidates []Candidate, limit int) []NearMiss {
+	var misses []NearMiss
+	for _, c := range candidates {
+		result := c.Pattern.Match(req)
+		if len(c.scenario) > 0 {
+			result = result.with(c.scenario...)
+		}
+		if result.Matched() {
+			continue
+		}
+		misses = append(misses, NearMiss{
+			Kind:     c.Kind,
+			ID:       c.ID,
+			Name:     c.Name,
+			Distance: result.Distance,
+			Diffs:    result.Diffs,
+		})
+	}
+
+	return closest(misses, limit)
+}
+
+// FindRequestNearMisses is the reverse question used for failed
+// verifications: which recorded requests came closest to pattern.
+func FindRequestNearMisses(pattern RequestPattern, requests []*Request, limit int) []NearMiss {
+	var misses []NearMiss
+	for _, req := range requests {
+		result := pattern.Match(req)
+		if result.Matched() {
+			continue
+		}
+		misses = append(misses, NearMiss{
+			Kind:     "request",
+			Distance: result.Distance,
+			Diffs:    result.Diffs,
+			Request:  req,
+		})
+	}
+
+	return closest(misses, limit)
+}
+
+func closest(misses []NearMiss, limit int) []NearMiss {
+	sort.SliceStable(misses, func(i, j int) bool {
+		return misses[i].Distance < misses[j].Distance
+	})
+	if limit > 0 && len(misses) > limit {
+		misses = misses[:limit]
+	}
+	return misses
+}
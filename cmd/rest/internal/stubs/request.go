@@ -0,0 +1,45 @@
+package stubs
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Request is the snapshot of an incoming HTTP request that stubs are matched
+// against and that the request journal keeps.
+type Request struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Path       string      `json:"path"`
+	Query      url.Values  `json:"query,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	RemoteAddr string      `json:"remoteAddr,omitempty"`
+}
+
+// NewRequest captures r. The body is read in full and replaced so downstream
+// handlers can still consume it.
+func NewRequest(r *http.Request) (*Request, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return &Request{
+		Method:     r.Method,
+		URL:        r.URL.RequestURI(),
+		Path:       r.URL.Path,
+		Query:      r.URL.Query(),
+		Headers:    r.Header.Clone(),
+		Body:       string(body),
+		RemoteAddr: r.RemoteAddr,
+	}, nil
+}
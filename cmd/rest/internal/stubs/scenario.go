@@ -0,0 +1,144 @@
+package stubs
+
+import (
+	"sort"
+	"sync"
+)
+
+// ScenarioStarted is the state every scenario begins in and returns to on
+// reset.
+const ScenarioStarted = "Started"
+
+// Scenario is the current state of a named scenario along with every state
+// its stubs mention.
+type Scenario struct {
+	Name           string   `json:"name"`
+	State          string   `json:"state"`
+	PossibleStates []string `json:"possibleStates"`
+	Mappings       []string `json:"mappings"`
+}
+
+// scenarios tracks the current state of each scenario by name. A scenario
+// without an entry is in ScenarioStarted.
+type scenarios struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func (s *scenarios) get(name string) string {
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// allows reports whether the stub's required state is the current one.
+func (s *scenarios) allows(stub *Stub) bool {
+	return stub.ScenarioName == "" || stub.RequiredScenarioState == "" || s.get(stub.ScenarioName) == stub.RequiredScenarioState
+}
+
+func (s *scenarios) transition(stub *Stub) {
+	if stub.ScenarioName != "" && stub.NewScenarioState != "" {
+		if s.states == nil {
+			s.states = map[string]string{}
+		}
+		s.states[stub.ScenarioName] = stub.NewScenarioState
+	}
+}
+
+// Scenarios lists every scenario referenced by a stub.
+func (s *Store) Scenarios() []Scenario {
+	s.scenarios.mu.Lock()
+	defer s.scenarios.mu.Unlock()
+
+	byName := map[string]*Scenario{}
+	possible := map[string]map[string]bool{}
+	for _, stub := range s.All() {
+		if stub.ScenarioName == "" {
+			continue
+		}
+		sc, ok := byName[stub.ScenarioName]
+		if !ok {
+			sc = &Scenario{Name: stub.ScenarioName, State: s.scenarios.get(stub.ScenarioName)}
+			byName[stub.ScenarioName] = sc
+			possible[stub.ScenarioName] = map[string]bool{ScenarioStarted: true}
+		}
+		sc.Mappings = append(sc.Mappings, stub.ID)
+		for _, state := range []string{stub.RequiredScenarioState, stub.NewScenarioState} {
+			if state != "" {
+				possible[stub.ScenarioName][state] = true
+			}
+		}
+	}
+
+	out := make([]Scenario, 0, len(byName))
+	for name, sc := range byName {
+		for state := range possible[name] {
+			sc.PossibleStates = append(sc.PossibleStates, state)
+		}
+		sort.Strings(sc.PossibleStates)
+		out = append(out, *sc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// ScenarioState returns the current state of the named scenario, reporting
+// false when no stub belongs to it.
+func (s *Store) ScenarioState(name string) (string, bool) {
+	for _, sc := range s.Scenarios() {
+		if sc.Name == name {
+			return sc.State, true
+		}
+	}
+	return "", false
+}
+
+// SetScenarioState moves the named scenario to state, reporting false when no
+// stub belongs to the scenario.
+func (s *Store) SetScenarioState(name, state string) bool {
+	if _, ok := s.ScenarioState(name); !ok {
+		return false
+	}
+	s.scenarios.mu.Lock()
+	defer s.scenarios.mu.Unlock()
+	if s.scenarios.states == nil {
+		s.scenarios.states = map[string]string{}
+	}
+	s.scenarios.states[name] = state
+	return true
+}
+
+// ResetScenario returns the named scenario to ScenarioStarted.
+func (s *Store) ResetScenario(name string) bool {
+	return s.SetScenarioState(name, ScenarioStarted)
+}
+
+// ResetScenarios returns every scenario to ScenarioStarted.
+func (s *Store) ResetScenarios() {
+	s.scenarios.mu.Lock()
+	defer s.scenarios.mu.Unlock()
+	s.scenarios.states = nil
+}
+
+// scenarioDiff reports a stub's required scenario state as a near-miss field
+// when the scenario is elsewhere.
+func (s *Store) scenarioDiff(stub *Stub) []FieldDiff {
+	if stub.ScenarioName == "" || stub.RequiredScenarioState == "" {
+		return nil
+	}
+	s.scenarios.mu.Lock()
+	current := s.scenarios.get(stub.ScenarioName)
+	s.scenarios.mu.Unlock()
+
+	d := FieldDiff{
+		Field:    "scenario[" + stub.ScenarioName + "]",
+		Expected: stub.RequiredScenarioState,
+		Actual:   current,
+		Matched:  current == stub.RequiredScenarioState,
+	}
+	if !d.Matched {
+		d.distance = 1
+	}
+	return []FieldDiff{d}
+}
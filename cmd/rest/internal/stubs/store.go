@@ -0,0 +1,184 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"mock-server/internal/common"
+)
+
+// Store is the thread-safe set of stub mappings served by the REST service.
+type Store struct {
+	mu    sync.RWMutex
+	stubs []*Stub
+	seq   int
+	order map[string]int
+
+	scenarios scenarios
+}
+
+func NewStore() *Store {
+	return &Store{order: map[string]int{}}
+}
+
+// Add validates and registers a stub, assigning an ID when it has none. A stub
+// with an existing ID replaces the previous one.
+func (s *Store) Add(stub *Stub) error {
+	if err := stub.Validate(); err != nil {
+		return err
+	}
+	if stub.ID == "" {
+		stub.ID = common.NewID()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(stub.ID)
+	s.seq++
+	s.order[stub.ID] = s.seq
+	s.stubs = append(s.stubs, stub)
+	s.sortLocked()
+	return nil
+}
+
+// Remove deletes the stub with the given ID, reporting whether it existed.
+func (s *Store) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked(id)
+}
+
+func (s *Store) removeLocked(id string) bool {
+	for i, stub := range s.stubs {
+		if stub.ID == id {
+			s.stubs = append(s.stubs[:i], s.stubs[i+1:]...)
+			delete(s.order, id)
+			return true
+		}
+	}
+	return false
+}
+
+// sortLocked orders stubs by priority (lower first), then newest first so a
+// freshly added stub overrides an older one with the same pattern.
+func (s *Store) sortLocked() {
+	sort.SliceStable(s.stubs, func(i, j int) bool {
+		a, b := s.stubs[i], s.stubs[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return s.order[a.ID] > s.order[b.ID]
+	})
+}
+
+func (s *Store) Get(id string) (*Stub, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, stub := range s.stubs {
+		if stub.ID == id {
+			return stub, true
+		}
+	}
+	return nil, false
+}
+
+// All returns the stubs in match order.
+func (s *Store) All() []*Stub {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Stub(nil), s.stubs...)
+}
+
+func (s *Store) Reset() {
+	s.ResetScenarios()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stubs = nil
+	s.order = map[string]int{}
+}
+
+// Match returns the first stub whose pattern fully matches req and whose
+// scenario is in the required state. The scenario stays where it is until
+// the caller serves the stub and calls Transition.
+func (s *Store) Match(req *Request) (*Stub, bool) {
+	s.scenarios.mu.Lock()
+	defer s.scenarios.mu.Unlock()
+
+	for _, stub := range s.All() {
+		if s.scenarios.allows(stub) && stub.Request.Match(req).Matched() {
+			return stub, true
+		}
+	}
+	return nil, false
+}
+
+// Transition moves the stub's scenario to its new state once the stub has
+// been served. It does nothing, and reports false, when a concurrent request
+// has moved the scenario out of the required state in the meantime, so
+// scenarios advance one step at a time.
+func (s *Store) Transition(stub *Stub) bool {
+	s.scenarios.mu.Lock()
+	defer s.scenarios.mu.Unlock()
+
+	if !s.scenarios.allows(stub) {
+		return false
+	}
+	s.scenarios.transition(stub)
+	return true
+}
+
+// LoadDir registers every *.json stub file under dir. A file holds either a
+// single stub or an object with a "mappings" array.
+func (s *Store) LoadDir(dir string) (int, error) {
+	var loaded int
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return nil
+		}
+
+		parsed, err := ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, stub := range parsed {
+			stub.Source = path
+			if err := s.Add(stub); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			loaded++
+		}
+		return nil
+	})
+	return loaded, err
+}
+
+// ReadFile parses a stub file.
+func ReadFile(path string) ([]*Stub, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var multi struct {
+		Mappings []*Stub `json:"mappings"`
+	}
+	if err := json.Unmarshal(data, &multi); err == nil && multi.Mappings != nil {
+		return multi.Mappings, nil
+	}
+
+	var single Stub
+	if err := json.Unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return []*Stub{&single}, nil
+}
@@ -0,0 +1,336 @@
+package stubs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mock-server/cmd/rest/internal/auth"
+	"mock-server/cmd/rest/internal/caching"
+	"mock-server/cmd/rest/internal/faults"
+	"mock-server/cmd/rest/internal/jobs"
+	"mock-server/cmd/rest/internal/sequence"
+	"mock-server/cmd/rest/internal/webhook"
+)
+
+// Stub maps a request pattern to a canned response.
+type Stub struct {
+	ID       string             `json:"id"`
+	Name     string             `json:"name,omitempty"`
+	Priority int                `json:"priority,omitempty"`
+	Request  RequestPattern     `json:"request"`
+	Response ResponseDefinition `json:"response"`
+
+	// Responses, when set, are served in turn instead of Response.
+	Responses []ResponseDefinition `json:"responses,omitempty"`
+	Sequence  *sequence.Settings   `json:"sequence,omitempty"`
+
+	// Job answers with 202 and starts a simulated long-running operation
+	// instead of serving the response.
+	Job *jobs.Definition `json:"job,omitempty"`
+
+	// Auth lists schemes any of which must authenticate the request before
+	// the stub answers; without any the stub is public.
+	Auth []auth.Scheme `json:"auth,omitempty"`
+
+	// CacheControl is sent with successful responses. Such stubs also get an
+	// ETag, unless their response sets one, and answer conditional GETs
+	// with 304.
+	CacheControl string `json:"cacheControl,omitempty"`
+
+	// Callbacks are sent after the response has been served.
+	Callbacks []webhook.Callback `json:"callbacks,omitempty"`
+
+	// A stub in a scenario only matches while the scenario is in
+	// RequiredScenarioState (any state when empty) and moves it to
+	// NewScenarioState when it is served.
+	ScenarioName          string `json:"scenarioName,omitempty"`
+	RequiredScenarioState string `json:"requiredScenarioState,omitempty"`
+	NewScenarioState      string `json:"newScenarioState,omitempty"`
+
+	// Source is the file the stub was loaded from, empty for stubs created
+	// through the admin API.
+	Source string `json:"-"`
+}
+
+// RequestPattern selects the requests a stub applies to. Unset fields match
+// anything.
+type RequestPattern struct {
+	Method          string                   `json:"method,omitempty"`
+	URL             string                   `json:"url,omitempty"`
+	URLPath         string                   `json:"urlPath,omitempty"`
+	URLPathPattern  string                   `json:"urlPathPattern,omitempty"`
+	Headers         map[string]StringMatcher `json:"headers,omitempty"`
+	QueryParameters map[string]StringMatcher `json:"queryParameters,omitempty"`
+	BodyPatterns    []StringMatcher          `json:"bodyPatterns,omitempty"`
+}
+
+// ResponseDefinition is what a stub answers with.
+type ResponseDefinition struct {
+	Status   int               `json:"status,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	JSONBody json.RawMessage   `json:"jsonBody,omitempty"`
+
+	Faults *faults.Settings `json:"faults,omitempty"`
+}
+
+// FieldDiff is the outcome of comparing one field of a pattern to a request.
+type FieldDiff struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Matched  bool   `json:"matched"`
+
+	distance float64
+}
+
+// MatchResult holds the per-field comparison of a pattern against a request.
+// Distance is 0 for an exact match and approaches 1 as fields diverge.
+type MatchResult struct {
+	Diffs    []FieldDiff `json:"diffs"`
+	Distance float64     `json:"distance"`
+}
+
+// Matched reports whether every field of the pattern was satisfied.
+func (m MatchResult) Matched() bool {
+	for _, d := range m.Diffs {
+		if !d.Matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Mismatches returns only the fields that differed.
+func (m MatchResult) Mismatches() []FieldDiff {
+	var out []FieldDiff
+	for _, d := range m.Diffs {
+		if !d.Matched {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+var regexSyntax = regexp.MustCompile(`\[[^\]]*\]|\(\?:|\(\?P<[^>]*>|[()^$+*?|\\]`)
+
+// Validate checks that every regular expression and JSON literal in the stub
+// is well-formed.
+func (s *Stub) Validate() error {
+	if err := s.Request.Validate(); err != nil {
+		return err
+	}
+	if err := s.Response.validate(); err != nil {
+		return fmt.Errorf("response %w", err)
+	}
+	for i, resp := range s.Responses {
+		if err := resp.validate(); err != nil {
+			return fmt.Errorf("responses[%d] %w", i, err)
+		}
+	}
+	if err := s.Sequence.Validate(); err != nil {
+		return err
+	}
+	if err := s.Job.Validate(); err != nil {
+		return fmt.Errorf("job: %w", err)
+	}
+	if err := auth.ValidateSchemes(s.Auth); err != nil {
+		return fmt.Errorf("auth%w", err)
+	}
+	if s.CacheControl != "" {
+		if err := caching.ValidateCacheControl(s.CacheControl); err != nil {
+			return fmt.Errorf("cacheControl: %w", err)
+		}
+	}
+	for i := range s.Callbacks {
+		if err := s.Callbacks[i].Validate(); err != nil {
+			return fmt.Errorf("callbacks[%d]: %w", i, err)
+		}
+	}
+	if s.ScenarioName == "" && (s.RequiredScenarioState != "" || s.NewScenarioState != "") {
+		return fmt.Errorf("scenario states require a scenarioName")
+	}
+	return nil
+}
+
+func (d ResponseDefinition) validate() error {
+	if d.Status != 0 && (d.Status < 100 || d.Status > 599) {
+		return fmt.Errorf("status %d is not a valid HTTP status", d.Status)
+	}
+	if len(d.JSONBody) > 0 && !json.Valid(d.JSONBody) {
+		return fmt.Errorf("jsonBody is not valid JSON")
+	}
+	if err := d.Faults.Validate(); err != nil {
+		return fmt.Errorf("faults: %w", err)
+	}
+	return nil
+}
+
+// Definitions lists the responses the stub can serve, in order.
+func (s *Stub) Definitions() []ResponseDefinition {
+	if len(s.Responses) > 0 {
+		return s.Responses
+	}
+	return []ResponseDefinition{s.Response}
+}
+
+// Validate checks the pattern's regular expressions and JSON literals.
+func (p RequestPattern) Validate() error {
+	if p.URLPathPattern != "" {
+		if _, err := regexp.Compile(p.URLPathPattern); err != nil {
+			return fmt.Errorf("invalid urlPathPattern: %w", err)
+		}
+	}
+	for name, m := range p.Headers {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+	}
+	for name, m := range p.QueryParameters {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("query parameter %s: %w", name, err)
+		}
+	}
+	for i, m := range p.BodyPatterns {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("body pattern %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Match compares the pattern to req field by field.
+func (p RequestPattern) Match(req *Request) MatchResult {
+	var diffs []FieldDiff
+
+	method := strings.ToUpper(p.Method)
+	if method != "" && method != "ANY" {
+		diffs = append(diffs, compareLiteral("method", method, req.Method, method == req.Method))
+	}
+
+	switch {
+	case p.URL != "":
+		diffs = append(diffs, compareLiteral("url", p.URL, req.URL, p.URL == req.URL))
+	case p.URLPath != "":
+		diffs = append(diffs, compareLiteral("path", p.URLPath, req.Path, p.URLPath == req.Path))
+	case p.URLPathPattern != "":
+		re, err := regexp.Compile("^(?:" + p.URLPathPattern + ")$")
+		matched := err == nil && re.MatchString(req.Path)
+		diffs = append(diffs, FieldDiff{
+			Field:    "path",
+			Expected: fmt.Sprintf("matches %q", p.URLPathPattern),
+			Actual:   req.Path,
+			Matched:  matched,
+		})
+		if !matched {
+			// a regular expression has no natural edit distance, comparing its
+			// literal parts still ranks /orders/[0-9]+ close to /order/1
+			diffs[len(diffs)-1].distance = similarityDistance(regexSyntax.ReplaceAllString(p.URLPathPattern, ""), req.Path)
+		}
+	}
+
+	for _, name := range sortedKeys(p.Headers) {
+		m := p.Headers[name]
+		values, present := req.Headers[textproto.CanonicalMIMEHeaderKey(name)]
+		diffs = append(diffs, compareMatcher("header["+name+"]", m, strings.Join(values, ","), present))
+	}
+
+	for _, name := range sortedKeys(p.QueryParameters) {
+		m := p.QueryParameters[name]
+		values, present := req.Query[name]
+		diffs = append(diffs, compareMatcher("query["+name+"]", m, strings.Join(values, ","), present))
+	}
+
+	for _, m := range p.BodyPatterns {
+		diffs = append(diffs, compareMatcher("body", m, req.Body, true))
+	}
+
+	return MatchResult{}.with(diffs...)
+}
+
+// with adds diffs to the result and recomputes its distance.
+func (m MatchResult) with(diffs ...FieldDiff) MatchResult {
+	m.Diffs = append(append([]FieldDiff(nil), m.Diffs...), diffs...)
+	m.Distance = 0
+	if len(m.Diffs) > 0 {
+		var total float64
+		for _, d := range m.Diffs {
+			total += d.distance
+		}
+		m.Distance = total / float64(len(m.Diffs))
+	}
+	return m
+}
+
+func compareLiteral(field, expected, actual string, matched bool) FieldDiff {
+	d := FieldDiff{Field: field, Expected: expected, Actual: actual, Matched: matched}
+	if !matched {
+		d.distance = similarityDistance(expected, actual)
+	}
+	return d
+}
+
+func compareMatcher(field string, m StringMatcher, actual string, present bool) FieldDiff {
+	matched := m.Match(actual, present)
+	d := FieldDiff{Field: field, Expected: m.String(), Actual: actual, Matched: matched}
+	if !present {
+		d.Actual = "(absent)"
+	}
+	if !matched {
+		if lit, ok := m.literal(); ok && present {
+			d.distance = similarityDistance(lit, actual)
+		} else {
+			d.distance = 1
+		}
+	}
+	return d
+}
+
+func sortedKeys(m map[string]StringMatcher) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// similarityDistance is the Levenshtein distance of a and b normalised to
+// [0,1]. Very long values are not compared character by character.
+func similarityDistance(a, b string) float64 {
+	if a == b {
+		return 0
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest == 0 {
+		return 0
+	}
+	if longest > 2048 {
+		return 1
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return float64(prev[len(b)]) / float64(longest)
+}
@@ -0,0 +1,77 @@
+// Package tmpl renders the Go templates used by callbacks and job results.
+package tmpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"mock-server/internal/common"
+)
+
+// Request is the triggering request as seen by templates.
+type Request struct {
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Path       string            `json:"path"`
+	PathParams map[string]string `json:"pathParams,omitempty"`
+	Query      url.Values        `json:"query,omitempty"`
+	Headers    http.Header       `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	// JSON is the parsed body, nil when it is not JSON.
+	JSON interface{} `json:"-"`
+}
+
+// Header returns the first value of a request header.
+func (r Request) Header(name string) string {
+	return r.Headers.Get(name)
+}
+
+// Param returns the first value of a query parameter.
+func (r Request) Param(name string) string {
+	return r.Query.Get(name)
+}
+
+// ParseJSON returns body decoded as JSON, or nil when it is not JSON.
+func ParseJSON(body string) interface{} {
+	var v interface{}
+	if json.Unmarshal([]byte(body), &v) != nil {
+		return nil
+	}
+	return v
+}
+
+var funcs = template.FuncMap{
+	"uuid": common.NewID,
+	"now":  func() string { return time.Now().UTC().Format(time.RFC3339) },
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// Parse parses text with the helper functions uuid, now and json. Missing
+// map keys render as empty values.
+func Parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+}
+
+// Render executes text against data. Text without actions is returned as is.
+func Render(name, text string, data interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := Parse(name, text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
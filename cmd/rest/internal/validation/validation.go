@@ -0,0 +1,219 @@
+package validation
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Issue is a single validation failure reported to the client.
+type Issue struct {
+	In     string `json:"in"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Failure lists why a request or response was rejected.
+type Failure struct {
+	Issues []Issue
+}
+
+func (f *Failure) Error() string {
+	var parts []string
+	for _, issue := range f.Issues {
+		parts = append(parts, strings.TrimSpace(issue.In+" "+issue.Field)+": "+issue.Reason)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator checks requests, and optionally responses, against the operations
+// of one or more OpenAPI documents.
+type Validator struct {
+	routers []routers.Router
+	Strict  bool
+}
+
+// New builds a validator for docs, each mounted at its base path.
+func New(strict bool, docs map[string]*openapi3.T) (*Validator, error) {
+	v := &Validator{Strict: strict}
+	for basePath, doc := range docs {
+		// match on the path alone; the document's server hosts are not ours
+		local := *doc
+		local.Servers = openapi3.Servers{{URL: basePath + "/"}}
+		if basePath == "" {
+			local.Servers = openapi3.Servers{{URL: "/"}}
+		}
+
+		router, err := gorillamux.NewRouter(&local)
+		if err != nil {
+			return nil, fmt.Errorf("build router for %q: %w", doc.Info.Title, err)
+		}
+		v.routers = append(v.routers, router)
+	}
+	return v, nil
+}
+
+func (v *Validator) findRoute(r *http.Request) (*routers.Route, map[string]string) {
+	for _, router := range v.routers {
+		route, params, err := router.FindRoute(r)
+		if err == nil && route.Operation != nil {
+			return route, params
+		}
+	}
+	return nil, nil
+}
+
+func options() *openapi3filter.Options {
+	return &openapi3filter.Options{
+		MultiError: true,
+		// authentication is enforced by the handlers themselves
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+}
+
+// Middleware rejects requests that violate their operation's parameter and
+// body schemas. In strict mode the response is captured and checked too;
+// a response that drifted from the document is replaced by a 500.
+// onFailure writes the error response for both cases.
+func (v *Validator) Middleware(next http.Handler, onFailure func(w http.ResponseWriter, r *http.Request, status int, f *Failure)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params := v.findRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options:    options(),
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			onFailure(w, r, http.StatusBadRequest, &Failure{Issues: issues(err, "")})
+			return
+		}
+
+		if !v.Strict {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &buffer{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+		if buf.hijacked {
+			return
+		}
+
+		err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 buf.status,
+			Header:                 buf.header,
+			Body:                   io.NopCloser(bytes.NewReader(buf.body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+		})
+		if err != nil {
+			onFailure(w, r, http.StatusInternalServerError, &Failure{Issues: issues(err, "response")})
+			return
+		}
+
+		for k, values := range buf.header {
+			w.Header()[k] = values
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// issues flattens kin-openapi's nested errors into one entry per problem. The
+// concrete types are matched before unwrapping so the outer error's context
+// (which parameter, body or response) is not lost.
+func issues(err error, in string) []Issue {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var out []Issue
+		for _, inner := range e {
+			out = append(out, issues(inner, in)...)
+		}
+		return out
+
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			if e.Err == nil {
+				return []Issue{{In: e.Parameter.In, Field: e.Parameter.Name, Reason: e.Reason}}
+			}
+			return prefixed(issues(e.Err, e.Parameter.In), e.Parameter.Name)
+		case e.RequestBody != nil && e.Err != nil:
+			return issues(e.Err, "body")
+		case e.RequestBody != nil:
+			return []Issue{{In: "body", Reason: e.Reason}}
+		}
+		if e.Err != nil {
+			return issues(e.Err, in)
+		}
+		return []Issue{{In: in, Reason: e.Reason}}
+
+	case *openapi3filter.ResponseError:
+		if e.Err == nil {
+			return []Issue{{In: "response", Reason: e.Reason}}
+		}
+		return issues(e.Err, "response")
+
+	case *openapi3.SchemaError:
+		return []Issue{{In: in, Field: strings.Join(e.JSONPointer(), "."), Reason: e.Reason}}
+
+	case *openapi3filter.ParseError:
+		return []Issue{{In: in, Reason: e.Error()}}
+	}
+
+	if inner := errors.Unwrap(err); inner != nil {
+		return issues(inner, in)
+	}
+	return []Issue{{In: in, Reason: err.Error()}}
+}
+
+// prefixed qualifies schema paths inside a parameter with its name.
+func prefixed(list []Issue, name string) []Issue {
+	for i := range list {
+		if list[i].Field == "" {
+			list[i].Field = name
+		} else {
+			list[i].Field = name + "." + list[i].Field
+		}
+	}
+	return list
+}
+
+// buffer holds the response for validation. Hijacking bypasses it, since a
+// broken connection has no body to check.
+type buffer struct {
+	http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	hijacked bool
+}
+
+func (b *buffer) Header() http.Header         { return b.header }
+func (b *buffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *buffer) WriteHeader(status int)      { b.status = status }
+
+func (b *buffer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := b.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	b.hijacked = true
+	return h.Hijack()
+}
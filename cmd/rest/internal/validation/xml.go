@@ -0,0 +1,214 @@
+package validation
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/xml", xmlBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/xml", xmlBodyDecoder)
+}
+
+// element is a parsed XML element.
+type element struct {
+	name     string
+	text     string
+	children []*element
+}
+
+func (e *element) child(name string) *element {
+	for _, c := range e.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *element) all(name string) []*element {
+	var out []*element
+	for _, c := range e.children {
+		if c.name == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// xmlBodyDecoder lets kin-openapi validate XML bodies. The document's schema
+// guides the conversion: property elements are found by name or by their
+// xml.name, wrapped arrays by their wrapper, and leaf text is converted to
+// the property's type so it validates like the JSON equivalent.
+func xmlBodyDecoder(body io.Reader, _ http.Header, schema *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+	root, err := parseXML(body)
+	if err != nil {
+		return nil, &openapi3filter.ParseError{Kind: openapi3filter.KindInvalidFormat, Cause: err}
+	}
+	return fromXML(root, schemaOf(schema)), nil
+}
+
+func parseXML(r io.Reader) (*element, error) {
+	dec := xml.NewDecoder(r)
+	var stack []*element
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{name: t.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			e.text = strings.TrimSpace(e.text)
+			if stack = stack[:len(stack)-1]; len(stack) == 0 {
+				return e, nil
+			}
+		}
+	}
+}
+
+func schemaOf(ref *openapi3.SchemaRef) *openapi3.Schema {
+	if ref == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+// properties merges a schema's own properties with those of its allOf
+// branches; a later, more specific definition wins over an empty one.
+func properties(s *openapi3.Schema) map[string]*openapi3.Schema {
+	out := map[string]*openapi3.Schema{}
+	if s == nil {
+		return out
+	}
+	for _, branch := range s.AllOf {
+		for name, p := range properties(schemaOf(branch)) {
+			if existing, ok := out[name]; !ok || isEmpty(existing) {
+				out[name] = p
+			}
+		}
+	}
+	for name, ref := range s.Properties {
+		if p := schemaOf(ref); p != nil {
+			if existing, ok := out[name]; !ok || isEmpty(existing) || !isEmpty(p) {
+				out[name] = p
+			}
+		}
+	}
+	return out
+}
+
+func isEmpty(s *openapi3.Schema) bool {
+	return s == nil || (s.Type == nil && len(s.Properties) == 0 && len(s.AllOf) == 0 && s.Items == nil)
+}
+
+func xmlName(s *openapi3.Schema, fallback string) string {
+	if s != nil && s.XML != nil && s.XML.Name != "" {
+		return s.XML.Name
+	}
+	return fallback
+}
+
+func fromXML(e *element, s *openapi3.Schema) any {
+	props := properties(s)
+	switch {
+	case len(props) > 0:
+		out := map[string]any{}
+		for name, p := range props {
+			if p.Type.Is("array") {
+				if items, ok := arrayFromXML(e, name, p); ok {
+					out[name] = items
+				}
+				continue
+			}
+			if c := e.child(xmlName(p, name)); c != nil {
+				out[name] = fromXML(c, p)
+			}
+		}
+		return out
+	case s != nil && s.Type.Is("array"):
+		items := []any{}
+		for _, c := range e.children {
+			items = append(items, fromXML(c, schemaOf(s.Items)))
+		}
+		return items
+	case isEmpty(s) && len(e.children) > 0:
+		// untyped: keep the structure, collecting repeated elements
+		out := map[string]any{}
+		for _, c := range e.children {
+			v := fromXML(c, nil)
+			switch existing := out[c.name].(type) {
+			case nil:
+				out[c.name] = v
+			case []any:
+				out[c.name] = append(existing, v)
+			default:
+				out[c.name] = []any{existing, v}
+			}
+		}
+		return out
+	}
+	return scalar(e.text, s)
+}
+
+func arrayFromXML(e *element, name string, s *openapi3.Schema) ([]any, bool) {
+	itemSchema := schemaOf(s.Items)
+	var elems []*element
+	if s.XML != nil && s.XML.Wrapped {
+		wrapper := e.child(xmlName(s, name))
+		if wrapper == nil {
+			return nil, false
+		}
+		elems = wrapper.children
+	} else {
+		elems = e.all(xmlName(itemSchema, xmlName(s, name)))
+		if len(elems) == 0 {
+			return nil, false
+		}
+	}
+	items := make([]any, len(elems))
+	for i, c := range elems {
+		items[i] = fromXML(c, itemSchema)
+	}
+	return items, true
+}
+
+// scalar converts leaf text to the schema's type, leaving it as a string
+// when it does not parse so the validator reports the mismatch.
+func scalar(text string, s *openapi3.Schema) any {
+	if s == nil {
+		return text
+	}
+	switch {
+	case s.Type.Is("integer"):
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case s.Type.Is("number"):
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n
+		}
+	case s.Type.Is("boolean"):
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b
+		}
+	}
+	return text
+}
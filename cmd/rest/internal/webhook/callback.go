@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"fmt"
+	"time"
+
+	"mock-server/cmd/rest/internal/tmpl"
+)
+
+// Callback is an outbound request sent after a stub or route has responded.
+// URL, header values and body are Go templates rendered against Data.
+type Callback struct {
+	Method    string            `json:"method,omitempty" yaml:"method"`
+	URL       string            `json:"url" yaml:"url"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers"`
+	Body      string            `json:"body,omitempty" yaml:"body"`
+	DelayMs   int               `json:"delayMs,omitempty" yaml:"delay_ms"`
+	Retries   int               `json:"retries,omitempty" yaml:"retries"`
+	TimeoutMs int               `json:"timeoutMs,omitempty" yaml:"timeout_ms"`
+	// BackoffMs is the wait before the first retry; each further retry waits
+	// BackoffMultiplier times longer.
+	BackoffMs         int     `json:"backoffMs,omitempty" yaml:"backoff_ms"`
+	BackoffMultiplier float64 `json:"backoffMultiplier,omitempty" yaml:"backoff_multiplier"`
+}
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMultiplier = 2
+)
+
+// Validate checks the callback's templates and numbers.
+func (c *Callback) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("callback url is required")
+	}
+	if c.DelayMs < 0 || c.Retries < 0 || c.TimeoutMs < 0 || c.BackoffMs < 0 || c.BackoffMultiplier < 0 {
+		return fmt.Errorf("callback delays, retries and timeouts must not be negative")
+	}
+	for name, text := range c.templates() {
+		if _, err := tmpl.Parse(name, text); err != nil {
+			return fmt.Errorf("callback %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Callback) templates() map[string]string {
+	out := map[string]string{"url": c.URL, "body": c.Body}
+	for k, v := range c.Headers {
+		out["header "+k] = v
+	}
+	return out
+}
+
+// backoff is the wait before retry n (1-based).
+func (c *Callback) backoff(n int) time.Duration {
+	wait := defaultBackoff
+	if c.BackoffMs > 0 {
+		wait = time.Duration(c.BackoffMs) * time.Millisecond
+	}
+	multiplier := c.BackoffMultiplier
+	if multiplier == 0 {
+		multiplier = defaultMultiplier
+	}
+	for i := 1; i < n; i++ {
+		wait = time.Duration(float64(wait) * multiplier)
+	}
+	return wait
+}
+
+func (c *Callback) timeout() time.Duration {
+	if c.TimeoutMs > 0 {
+		return time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	return defaultTimeout
+}
+
+// RequestData is the triggering request as seen by templates.
+type RequestData = tmpl.Request
+
+// ResponseData is the response the client received.
+type ResponseData struct {
+	Status int         `json:"status"`
+	Body   string      `json:"body,omitempty"`
+	JSON   interface{} `json:"-"`
+}
+
+// Data is what callback templates are rendered against, e.g.
+// {{.Request.JSON.orderId}}, {{.Request.PathParams.id}},
+// {{.Request.Header "X-Request-Id"}} or {{.Response.Status}}.
+type Data struct {
+	Request  RequestData
+	Response ResponseData
+}
+
+// ParseJSON fills the JSON fields from the bodies.
+func (d *Data) ParseJSON() {
+	d.Request.JSON = tmpl.ParseJSON(d.Request.Body)
+	d.Response.JSON = tmpl.ParseJSON(d.Response.Body)
+}
@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mock-server/cmd/rest/internal/tmpl"
+	"mock-server/internal/common"
+)
+
+const (
+	StatePending   = "pending"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+
+	// maxRecordedBody bounds how much of a callback response is kept.
+	maxRecordedBody = 4096
+)
+
+// Attempt is one try at delivering a callback.
+type Attempt struct {
+	Number     int       `json:"number"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"durationMs"`
+	Status     int       `json:"status,omitempty"`
+	Body       string    `json:"body,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Delivery is a rendered callback and the history of its attempts.
+type Delivery struct {
+	ID          string            `json:"id"`
+	Source      string            `json:"source"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	ScheduledAt time.Time         `json:"scheduledAt"`
+	State       string            `json:"state"`
+	Attempts    []Attempt         `json:"attempts"`
+}
+
+// Dispatcher sends callbacks in the background and keeps a bounded history
+// of deliveries.
+type Dispatcher struct {
+	mu         sync.RWMutex
+	deliveries []*Delivery
+	limit      int
+	client     *http.Client
+	logf       func(msg string, keyvals ...interface{})
+}
+
+// NewDispatcher keeps at most limit deliveries; logf receives a line per
+// attempt.
+func NewDispatcher(limit int, logf func(msg string, keyvals ...interface{})) *Dispatcher {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	return &Dispatcher{
+		limit:  limit,
+		client: &http.Client{},
+		logf:   logf,
+	}
+}
+
+// Schedule renders cb against data and delivers it in the background. source
+// names what triggered it, such as "stub:<id>" or "route:POST /orders".
+func (d *Dispatcher) Schedule(cb Callback, data Data, source string) (*Delivery, error) {
+	data.ParseJSON()
+
+	delivery := &Delivery{
+		ID:          common.NewID(),
+		Source:      source,
+		Method:      strings.ToUpper(cb.Method),
+		ScheduledAt: time.Now(),
+		State:       StatePending,
+		Attempts:    []Attempt{},
+	}
+	if delivery.Method == "" {
+		delivery.Method = http.MethodPost
+	}
+
+	var err error
+	if delivery.URL, err = tmpl.Render("url", cb.URL, data); err != nil {
+		return nil, fmt.Errorf("render callback url: %w", err)
+	}
+	if delivery.Body, err = tmpl.Render("body", cb.Body, data); err != nil {
+		return nil, fmt.Errorf("render callback body: %w", err)
+	}
+	if len(cb.Headers) > 0 {
+		delivery.Headers = map[string]string{}
+		for k, v := range cb.Headers {
+			if delivery.Headers[k], err = tmpl.Render("header "+k, v, data); err != nil {
+				return nil, fmt.Errorf("render callback header %s: %w", k, err)
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.deliveries = append(d.deliveries, delivery)
+	if d.limit > 0 && len(d.deliveries) > d.limit {
+		d.deliveries = d.deliveries[len(d.deliveries)-d.limit:]
+	}
+	d.mu.Unlock()
+
+	go d.deliver(cb, delivery)
+	return delivery, nil
+}
+
+func (d *Dispatcher) deliver(cb Callback, delivery *Delivery) {
+	time.Sleep(time.Duration(cb.DelayMs) * time.Millisecond)
+
+	for n := 1; n <= cb.Retries+1; n++ {
+		if n > 1 {
+			time.Sleep(cb.backoff(n - 1))
+		}
+
+		attempt := d.attempt(cb, delivery, n)
+		ok := attempt.Error == "" && attempt.Status < 500 && attempt.Status != http.StatusTooManyRequests
+
+		d.mu.Lock()
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		switch {
+		case ok:
+			delivery.State = StateSucceeded
+		case n == cb.Retries+1:
+			delivery.State = StateFailed
+		}
+		d.mu.Unlock()
+
+		d.logf("Webhook attempt", "id", delivery.ID, "source", delivery.Source, "url", delivery.URL, "attempt", n, "status", attempt.Status, "error", attempt.Error)
+		if ok {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(cb Callback, delivery *Delivery, n int) Attempt {
+	attempt := Attempt{Number: n, Time: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cb.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, delivery.Method, delivery.URL, strings.NewReader(delivery.Body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	for k, v := range delivery.Headers {
+		req.Header.Set(k, v)
+	}
+	if delivery.Body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.DurationMs = time.Since(attempt.Time).Milliseconds()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRecordedBody))
+	attempt.Status = resp.StatusCode
+	attempt.Body = string(body)
+	attempt.DurationMs = time.Since(attempt.Time).Milliseconds()
+	return attempt
+}
+
+// Deliveries returns copies of the recorded deliveries, oldest first,
+// optionally filtered by source and state.
+func (d *Dispatcher) Deliveries(source, state string) []Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := []Delivery{}
+	for _, delivery := range d.deliveries {
+		if (source == "" || delivery.Source == source) && (state == "" || delivery.State == state) {
+			c := *delivery
+			c.Attempts = append([]Attempt{}, delivery.Attempts...)
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Get returns a copy of the delivery with id.
+func (d *Dispatcher) Get(id string) (Delivery, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, delivery := range d.deliveries {
+		if delivery.ID == id {
+			c := *delivery
+			c.Attempts = append([]Attempt{}, delivery.Attempts...)
+			return c, true
+		}
+	}
+	return Delivery{}, false
+}
+
+// Reset forgets every recorded delivery. Callbacks already in flight still
+// run but are no longer listed.
+func (d *Dispatcher) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = nil
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import "sync"
+
+// Registry holds the callbacks configured for built-in routes.
+type Registry struct {
+	mu     sync.RWMutex
+	routes map[string][]Callback
+}
+
+func NewRegistry(routes map[string][]Callback) *Registry {
+	if routes == nil {
+		routes = map[string][]Callback{}
+	}
+	return &Registry{routes: routes}
+}
+
+// Routes returns a copy of the callbacks keyed by "METHOD /template".
+func (reg *Registry) Routes() map[string][]Callback {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string][]Callback, len(reg.routes))
+	for k, v := range reg.routes {
+		out[k] = v
+	}
+	return out
+}
+
+// SetRoute installs the callbacks for a route; an empty list removes them.
+func (reg *Registry) SetRoute(route string, callbacks []Callback) error {
+	for i := range callbacks {
+		if err := callbacks[i].Validate(); err != nil {
+			return err
+		}
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if len(callbacks) == 0 {
+		delete(reg.routes, route)
+		return nil
+	}
+	reg.routes[route] = callbacks
+	return nil
+}
+
+// Resolve returns the callbacks for the first of routeKeys that has any.
+func (reg *Registry) Resolve(routeKeys ...string) (string, []Callback) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, key := range routeKeys {
+		if callbacks, ok := reg.routes[key]; ok {
+			return key, callbacks
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mock-server/cmd/rest/internal/jobs"
+	"mock-server/cmd/rest/internal/stubs"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	jobManager  = jobs.NewManager(500)
+	jobRegistry = jobs.NewRegistry(nil)
+)
+
+func registerJobRoutes(r *mux.Router) {
+	r.HandleFunc(jobs.BasePath+"/{id}", getJob).Methods("GET")
+	r.HandleFunc(jobs.BasePath+"/{id}/result", getJobResult).Methods("GET")
+}
+
+// acceptJob starts a job for the request and answers 202 with its status URL.
+func acceptJob(w http.ResponseWriter, r *http.Request, req *stubs.Request, def *jobs.Definition, source string) {
+	job := jobManager.Create(def, source, templateRequest(r, req))
+	logger.Info("Accepted job", "id", job.ID, "source", source, "state", job.State, "path", r.URL.Path)
+
+	w.Header().Set("Location", job.StatusURL)
+	w.Header().Set("Retry-After", strconv.Itoa(def.RetryAfter))
+	writeJSON(w, http.StatusAccepted, APIResponse{Success: true, Data: job})
+}
+
+// acceptJobs turns built-in routes configured under jobs.routes into
+// long-running operations.
+func acceptJobs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, def := jobRegistry.Resolve(routeKeys(r)...)
+		if def == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		req, err := stubs.NewRequest(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+			return
+		}
+		acceptJob(w, r, req, def, "route:"+key)
+	})
+}
+
+// getJob reports a job's state. Clients are asked to poll again with
+// Retry-After until it is done, then fetch resultUrl.
+func getJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobManager.Get(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Job not found"})
+		return
+	}
+	if !job.Done {
+		w.Header().Set("Retry-After", strconv.Itoa(jobManager.RetryAfter(id)))
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: job})
+}
+
+// getJobResult serves the templated result or failure of a finished job.
+func getJobResult(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	result, err := jobManager.Result(id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Job not found"})
+	case errors.Is(err, jobs.ErrNotFinished):
+		w.Header().Set("Location", jobs.BasePath+"/"+id)
+		w.Header().Set("Retry-After", strconv.Itoa(jobManager.RetryAfter(id)))
+		writeJSON(w, http.StatusConflict, APIResponse{Success: false, Error: "Job has not finished"})
+	case err != nil:
+		logger.Error("Could not render job result", "id", id, "error", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: "Could not render job result"})
+	default:
+		result.Write(w)
+	}
+}
+
+type jobOverview struct {
+	Routes map[string]*jobs.Definition `json:"routes"`
+	Jobs   []jobs.Job                  `json:"jobs"`
+}
+
+// listJobs shows the job routes and every job, optionally filtered with
+// ?source=stub:<id> and ?state=<state>.
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: jobOverview{
+		Routes: jobRegistry.Routes(),
+		Jobs:   jobManager.List(q.Get("source"), q.Get("state")),
+	}})
+}
+
+func getJobAdmin(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobManager.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Job not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: job})
+}
+
+// transitionJob moves a job to {"state": ...}: one of its steps, succeeded or
+// failed. An empty body moves it to the next step.
+func transitionJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		State string `json:"state"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+			return
+		}
+	}
+
+	id := mux.Vars(r)["id"]
+	job, err := jobManager.Transition(id, body.State)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Job not found"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusConflict, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Job transitioned", "id", id, "state", job.State)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: job})
+}
+
+func resetJobs(w http.ResponseWriter, r *http.Request) {
+	jobManager.Reset()
+	logger.Info("Cleared jobs")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setRouteJob(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route string           `json:"route"`
+		Job   *jobs.Definition `json:"job"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || body.Job == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its job"})
+		return
+	}
+	if err := jobRegistry.SetRoute(body.Route, body.Job); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteJob(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	jobRegistry.SetRoute(route, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"mock-server/cmd/rest/internal/journal"
+	"mock-server/cmd/rest/internal/stubs"
+	"mock-server/internal/common"
+
+	"github.com/gorilla/mux"
+)
+
+const adminPrefix = "/__admin"
+
+var requestJournal = journal.New(1000)
+
+// statusRecorder remembers the status code written by a handler. It forwards
+// Flush and Hijack so streaming handlers keep working behind it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recordRequests journals every non-admin request along with what handled it.
+func recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		captured, err := stubs.NewRequest(r)
+		if err != nil {
+			logger.Error("Could not read request body", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		entry := &journal.Entry{Timestamp: time.Now(), Request: journalRequest(captured)}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(journal.WithEntry(r.Context(), entry)))
+
+		entry.Status = rec.status
+		requestJournal.Record(entry)
+	})
+}
+
+// journalRequest masks the credentials in a captured request before it is
+// journaled, unless LOG_SECRETS is true: secret headers and query
+// parameters, and secrets common.Redact finds in the URL and body.
+func journalRequest(req *stubs.Request) *stubs.Request {
+	if common.LogSecrets() {
+		return req
+	}
+	masked := *req
+	masked.URL = common.Redact(req.URL)
+	masked.Query = common.RedactQuery(req.Query)
+	masked.Headers = common.RedactHeaders(req.Headers)
+	masked.Body = common.Redact(req.Body)
+	return &masked
+}
+
+// markRouteMatched tags journal entries with the built-in route that served them.
+func markRouteMatched(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				journal.MarkMatched(r.Context(), "route:"+tpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
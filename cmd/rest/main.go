@@ -2,31 +2,57 @@ package main
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
+	"mock-server/cmd/rest/internal/auth"
+	"mock-server/cmd/rest/internal/authserver"
+	"mock-server/cmd/rest/internal/caching"
+	"mock-server/cmd/rest/internal/config"
+	"mock-server/cmd/rest/internal/faults"
+	"mock-server/cmd/rest/internal/idempotency"
+	"mock-server/cmd/rest/internal/jobs"
+	"mock-server/cmd/rest/internal/journal"
+	"mock-server/cmd/rest/internal/negotiate"
+	"mock-server/cmd/rest/internal/openapi"
+	"mock-server/cmd/rest/internal/ratelimit"
+	"mock-server/cmd/rest/internal/recorder"
+	"mock-server/cmd/rest/internal/sequence"
+	"mock-server/cmd/rest/internal/stream"
+	"mock-server/cmd/rest/internal/webhook"
 	"mock-server/internal/common"
 	M "mock-server/internal/common/models"
 	"mock-server/internal/consts"
+	"mock-server/internal/oauth"
+	"mock-server/internal/rbac"
 
 	CharmLog "github.com/charmbracelet/log"
 	"github.com/gorilla/mux"
 )
 
-var logger = CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
+var logger = common.RedactSecrets(CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
 	ReportTimestamp: true,
 	TimeFormat:      time.Kitchen,
 	Prefix:          "REST Service📡",
-})
+}))
 
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	XMLName xml.Name    `json:"-" yaml:"-" xml:"response"`
+	Success bool        `json:"success" yaml:"success" xml:"success"`
+	Data    interface{} `json:"data,omitempty" yaml:"data,omitempty" xml:"data,omitempty"`
+	Error   string      `json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"`
+}
+
+// CSVTable lays out the data as CSV, or the outcome when there is none.
+func (resp APIResponse) CSVTable() ([]string, [][]string) {
+	if resp.Data != nil {
+		return negotiate.TableOf(resp.Data)
+	}
+	return []string{"success", "error"}, [][]string{{strconv.FormatBool(resp.Success), resp.Error}}
 }
 
 type EchoRequest struct {
@@ -42,23 +68,15 @@ var mockCustomers = []M.Customer{
 
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.URL.Query().Get("token")
-		}
-
-		token = strings.TrimPrefix(token, "Bearer ")
-		if _, err := common.ValidateAuth(token); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(APIResponse{
-				Success: false,
-				Error:   "Authentication Required",
-			})
+		// the route's schemes or access rule have already identified the caller
+		if authenticated(r) {
+			next(w, r)
 			return
 		}
 
-		next(w, r)
+		if r, ok := identify(w, r); ok {
+			next(w, r)
+		}
 	}
 }
 
@@ -66,11 +84,23 @@ func setupRESTRoutes() *mux.Router {
 	r := mux.NewRouter()
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: "OK"})
 	}).Methods("GET")
 
 	r.HandleFunc("/echo", authMiddleware(echoRequest)).Methods("POST")
-	r.HandleFunc("/customer/{id}", authMiddleware(getCustomer)).Methods("GET")
+	r.HandleFunc("/customer/{id}", authMiddleware(negotiated(getCustomer))).Methods("GET")
+	registerCustomerRoutes(r)
+	registerJobRoutes(r)
+	registerHTTPBinRoutes(r)
+	registerOAuthRoutes(r)
+
+	registerOpenAPIRoutes(r)
+	registerDocRoutes(r)
+	setupAdminRoutes(r)
+	r.Use(markRouteMatched, limitRequests, authenticateRoutes, authorizeRoutes, applyCaching, replayIdempotent, triggerWebhooks, injectFaults, serveSequences, acceptJobs)
+	r.NotFoundHandler = unmatchedHandler(http.StatusNotFound)
+	r.MethodNotAllowedHandler = unmatchedHandler(http.StatusMethodNotAllowed)
 
 	return r
 }
@@ -81,6 +111,7 @@ func echoRequest(w http.ResponseWriter, r *http.Request) {
 	var response EchoRequest
 	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
 		logger.Error("Invalid JSON Receieved", "error", err)
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: "Invalid JSON"})
 		return
@@ -93,24 +124,100 @@ func echoRequest(w http.ResponseWriter, r *http.Request) {
 
 func getCustomer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id, _ := strconv.Atoi(vars["id"])
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		logger.Warn("Invalid customer ID", "id", vars["id"])
+		writeNegotiated(w, r, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid customer ID"})
+		return
+	}
 	logger.Info("GetCustomer request received", "customerId", id, "method", r.Method, "path", r.URL.Path)
 
-	for _, customer := range mockCustomers {
-		if customer.ID == id {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(APIResponse{Success: true, Data: customer})
+	if customer, modified, ok := customerStore.Lookup(id); ok {
+		v := customerValidators(r, customer, modified)
+		if caching.NotModified(r, v) {
+			caching.WriteNotModified(w, v)
 			return
 		}
+		v.Write(w.Header())
+		writeNegotiated(w, r, http.StatusOK, APIResponse{Success: true, Data: customer})
+		return
 	}
 
-	w.WriteHeader(http.StatusNotFound)
-	json.NewEncoder(w).Encode(APIResponse{Success: false, Error: "Customer not found"})
+	writeNegotiated(w, r, http.StatusNotFound, APIResponse{Success: false, Error: "Customer not found"})
 }
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("Failed to load config", "error", err)
+	}
+	requestJournal = journal.New(cfg.JournalLimit)
+	nearMissesLimit = cfg.NearMisses
+	stubsDir = cfg.StubsDir
+	upstreamProxy = recorder.New(cfg.Proxy)
+	faultRegistry = faults.NewRegistry(cfg.Faults.Global, cfg.Faults.Routes, cfg.Faults.AllowRequestHeaders)
+	rateLimits = ratelimit.NewRegistry(cfg.RateLimits.Global, cfg.RateLimits.Routes)
+	cachePolicies = caching.NewRegistry(cfg.Caching.RequireIfMatch, cfg.Caching.Routes)
+	idempotencyStore = idempotency.NewStore(cfg.Idempotency.TTL)
+	authRoutes = auth.NewRegistry(cfg.Auth.Routes)
+	if err := common.LoadUsers(); err != nil {
+		logger.Fatal("Failed to load users", "error", err)
+	}
+	if err := common.StartAudit("rest"); err != nil {
+		logger.Fatal("Failed to start auth audit", "error", err)
+	}
+	if accessPolicy, err = rbac.Load(); err != nil {
+		logger.Fatal("Failed to load RBAC policy", "error", err)
+	}
+	if provider, err := oauth.Load(); err != nil {
+		logger.Fatal("Failed to load OAuth settings", "error", err)
+	} else if provider != nil {
+		authServer = authserver.New(provider)
+		logger.Info("OAuth authorization server enabled", "issuer", provider.Config.Issuer, "algorithm", provider.Config.Algorithm)
+	}
+	sequenceRegistry = sequence.NewRegistry(cfg.Sequences)
+	webhookRegistry = webhook.NewRegistry(cfg.Webhooks.Routes)
+	jobManager = jobs.NewManager(cfg.Jobs.HistoryLimit)
+	jobRegistry = jobs.NewRegistry(cfg.Jobs.Routes)
+	streamHub = stream.NewHub(cfg.Streams)
+	webhookDispatcher = webhook.NewDispatcher(cfg.Webhooks.HistoryLimit, func(msg string, keyvals ...interface{}) {
+		logger.Info(msg, keyvals...)
+	})
+	if err := loadStubs(); err != nil {
+		logger.Fatal("Failed to load stub mappings", "dir", stubsDir, "error", err)
+	}
+	if builtinAPI, err = openapi.LoadData(builtinSpec, ""); err != nil {
+		logger.Fatal("Failed to load built-in OpenAPI document", "error", err)
+	}
+	if cfg.OpenAPI.Spec != "" {
+		if apiMock, err = openapi.Load(cfg.OpenAPI.Spec, cfg.OpenAPI.BasePath); err != nil {
+			logger.Fatal("Failed to load OpenAPI document", "spec", cfg.OpenAPI.Spec, "error", err)
+		}
+	}
+
 	router := setupRESTRoutes()
+	builtinRoutes = routeCandidates(router)
+	documentedRoutes = routeTable(router)
+	if mode := cfg.Proxy.Mode; mode != "" {
+		logger.Info("Proxy mode enabled", "mode", mode, "upstream", cfg.Proxy.Upstream, "recordings", cfg.Proxy.RecordingsDir)
+	}
+
+	var handler http.Handler = router
+	if cfg.Validation.Enabled {
+		if handler, err = validateRequests(router, cfg.Validation.Strict); err != nil {
+			logger.Fatal("Failed to set up OpenAPI validation", "error", err)
+		}
+		logger.Info("OpenAPI validation enabled", "strict", cfg.Validation.Strict)
+	}
+
+	handler = recordRequests(handler)
+	tlsSettings = cfg.TLS
+	if tlsSettings.Enabled {
+		if err := serveTLS(handler); err != nil {
+			logger.Fatal("Failed to set up TLS", "error", err)
+		}
+	}
 
 	logger.Info(fmt.Sprintf("Listening on :%d", consts.HTTP_PORT))
-	logger.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", consts.HTTP_PORT), router))
+	logger.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", consts.HTTP_PORT), handler))
 }
@@ -0,0 +1,349 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"mock-server/cmd/rest/internal/auth"
+	"mock-server/cmd/rest/internal/authserver"
+	"mock-server/internal/common"
+	"mock-server/internal/oauth"
+
+	"github.com/gorilla/mux"
+)
+
+// authServer issues OAuth tokens; it is nil when OAUTH_CONFIG is unset.
+var authServer *authserver.Server
+
+// sessionCookie remembers who signed in at the authorization endpoint.
+const sessionCookie = "servr_oidc_session"
+
+// loginPage is the OpenID Connect user picker. Like the docs page it needs
+// no external assets, so login flows work offline.
+//
+//go:embed login.html
+var loginHTML string
+
+var loginPage = template.Must(template.New("login").Funcs(template.FuncMap{"join": strings.Join}).Parse(loginHTML))
+
+// registerOAuthRoutes mounts the OAuth 2.0 authorization server and its
+// OpenID Connect endpoints. Like other OAuth servers it answers with bare
+// JSON rather than an APIResponse.
+func registerOAuthRoutes(r *mux.Router) {
+	if authServer == nil {
+		return
+	}
+	r.HandleFunc("/oauth/token", issueToken).Methods("POST")
+	r.HandleFunc("/oauth/introspect", introspectToken).Methods("POST")
+	r.HandleFunc("/oauth/revoke", revokeToken).Methods("POST")
+	r.HandleFunc("/oauth/authorize", authorize).Methods("GET")
+	r.HandleFunc("/oauth/authorize", signIn).Methods("POST")
+	r.HandleFunc("/oauth/userinfo", getUserInfo).Methods("GET", "POST")
+	r.HandleFunc("/oauth/logout", logout).Methods("GET", "POST")
+	r.HandleFunc("/oauth/jwks", getJWKS).Methods("GET")
+	r.HandleFunc("/.well-known/jwks.json", getJWKS).Methods("GET")
+	r.HandleFunc("/.well-known/openid-configuration", getDiscovery).Methods("GET")
+}
+
+func writeOAuth(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, status, v)
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	e, ok := err.(*authserver.Error)
+	if !ok {
+		e = &authserver.Error{Code: "server_error", Description: err.Error(), Status: http.StatusInternalServerError}
+	}
+	if e.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="servr"`)
+	}
+	writeOAuth(w, e.Status, e)
+}
+
+func issueToken(w http.ResponseWriter, r *http.Request) {
+	resp, err := authServer.Token(r)
+	scheme := "oauth:" + r.PostForm.Get("grant_type")
+	if err != nil {
+		logger.Warn("Token request rejected", "grantType", r.PostForm.Get("grant_type"), "error", err)
+		username := r.PostForm.Get("username")
+		if username == "" {
+			username = clientID(r)
+		}
+		common.Audit(common.AuthEvent{Scheme: scheme, Username: username, Reason: err.Error()}, r.RemoteAddr)
+		writeOAuthError(w, err)
+		return
+	}
+	logger.Info("Issued token", "grantType", r.PostForm.Get("grant_type"), "scope", resp.Scope)
+	common.Audit(common.AuthEvent{Scheme: scheme, Username: resp.Subject, Success: true}, r.RemoteAddr)
+	writeOAuth(w, http.StatusOK, resp)
+}
+
+// clientID is the client a token request claims to come from.
+func clientID(r *http.Request) string {
+	if id, _, ok := r.BasicAuth(); ok {
+		return id
+	}
+	return r.PostForm.Get("client_id")
+}
+
+// introspectToken answers RFC 7662 introspection requests.
+func introspectToken(w http.ResponseWriter, r *http.Request) {
+	resp, err := authServer.Introspect(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	writeOAuth(w, http.StatusOK, resp)
+}
+
+// revokeToken answers RFC 7009 revocation requests. Revoked access tokens
+// are rejected by every service from their next request on.
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	if err := authServer.Revoke(r); err != nil {
+		logger.Warn("Revocation rejected", "error", err)
+		writeOAuthError(w, err)
+		return
+	}
+	logger.Info("Revoked token", "hint", r.PostForm.Get("token_type_hint"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorize runs the authorization_code flow's front channel. A user who
+// sends HTTP Basic credentials or is already signed in is sent straight back
+// to the client with a code; anyone else picks a user on the login page.
+func authorize(w http.ResponseWriter, r *http.Request) {
+	req, ok := authorizationRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	if _, _, basic := r.BasicAuth(); basic {
+		r, ok := requireAuth(w, r, []auth.Scheme{{Type: auth.Basic, Realm: "servr"}})
+		if !ok {
+			return
+		}
+		user, _ := common.UserFromContext(r.Context())
+		grantCode(w, r, req, user, time.Now())
+		return
+	}
+
+	if req.Prompt != "login" && req.Prompt != "select_account" {
+		if session, ok := currentSession(r); ok {
+			grantCode(w, r, req, session.User, session.AuthTime)
+			return
+		}
+	}
+	if req.Prompt == "none" {
+		http.Redirect(w, r, req.ErrorRedirect(authserver.ErrLoginRequired), http.StatusFound)
+		return
+	}
+	renderLogin(w, http.StatusOK, req, r.URL.Query(), "")
+}
+
+// signIn handles the login page: whoever was picked is signed in without a
+// password and sent back to the client.
+func signIn(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	req, ok := authorizationRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+	user, err := common.SelectUser(r.PostForm.Get("username"))
+	if err != nil {
+		logger.Warn("Sign-in rejected", "username", r.PostForm.Get("username"), "error", err)
+		common.Audit(common.AuthEvent{Scheme: "oauth:login", Username: r.PostForm.Get("username"), Reason: err.Error()}, r.RemoteAddr)
+		renderLogin(w, http.StatusUnauthorized, req, r.PostForm, err.Error())
+		return
+	}
+	common.Audit(common.AuthEvent{Scheme: "oauth:login", Username: user.Username, Success: true}, r.RemoteAddr)
+	session := authServer.StartSession(user)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.ID,
+		Path:     "/oauth",
+		Expires:  time.Now().Add(authServer.Config().SessionTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	grantCode(w, r, req, user, session.AuthTime)
+}
+
+// authorizationRequest parses an authorization request, reporting errors
+// to the user or, once the redirect URI is trusted, to the client.
+func authorizationRequest(w http.ResponseWriter, r *http.Request, q url.Values) (*authserver.AuthorizationRequest, bool) {
+	req, err := authServer.ParseAuthorization(q)
+	if err != nil {
+		if req == nil {
+			writeOAuthError(w, err)
+			return nil, false
+		}
+		http.Redirect(w, r, req.ErrorRedirect(err), http.StatusFound)
+		return nil, false
+	}
+	return req, true
+}
+
+func grantCode(w http.ResponseWriter, r *http.Request, req *authserver.AuthorizationRequest, user *common.User, authTime time.Time) {
+	logger.Info("Authorized client", "client", req.Client.ID, "username", user.Username)
+	status := http.StatusFound
+	if r.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+	http.Redirect(w, r, authServer.IssueCode(req, user, authTime), status)
+}
+
+func currentSession(r *http.Request) (*authserver.Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	return authServer.Session(cookie.Value)
+}
+
+type loginUser struct {
+	Username string
+	Email    string
+	Roles    []string
+	Status   string
+}
+
+type loginParam struct {
+	Name, Value string
+}
+
+type loginView struct {
+	Client    string
+	Scopes    string
+	Error     string
+	Users     []loginUser
+	Params    []loginParam
+	SignedOut bool
+}
+
+// renderLogin shows the user picker, carrying the authorization request's
+// parameters through the form.
+func renderLogin(w http.ResponseWriter, status int, req *authserver.AuthorizationRequest, q url.Values, message string) {
+	view := loginView{Client: req.Client.ID, Scopes: strings.Join(req.Scopes, " "), Error: message}
+	for _, account := range common.ListUsers() {
+		u := loginUser{Username: account.User.Username, Email: account.User.Email, Roles: account.User.Roles}
+		if account.Status != nil {
+			u.Status = account.Status.Error()
+		}
+		view.Users = append(view.Users, u)
+	}
+	for name, values := range q {
+		if name == "username" {
+			continue
+		}
+		for _, v := range values {
+			view.Params = append(view.Params, loginParam{name, v})
+		}
+	}
+	sort.Slice(view.Params, func(i, j int) bool { return view.Params[i].Name < view.Params[j].Name })
+	writeLoginPage(w, status, view)
+}
+
+func writeLoginPage(w http.ResponseWriter, status int, view loginView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := loginPage.Execute(w, view); err != nil {
+		logger.Error("Failed to render login page", "error", err)
+	}
+}
+
+// getUserInfo returns the claims about the bearer token's user.
+func getUserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.Method == http.MethodPost {
+		token = r.PostFormValue("access_token")
+	}
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="servr"`)
+		writeOAuth(w, http.StatusUnauthorized, &authserver.Error{Code: "invalid_token", Description: "missing bearer token"})
+		return
+	}
+	claims, err := authServer.UserInfo(token)
+	if err != nil {
+		e := err.(*authserver.Error)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="servr", error="`+e.Code+`"`)
+		writeOAuth(w, e.Status, e)
+		return
+	}
+	writeOAuth(w, http.StatusOK, claims)
+}
+
+// logout is RP-initiated logout: it ends the session and returns to the
+// client's post_logout_redirect_uri, or shows a signed-out page.
+func logout(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	target, err := authServer.Logout(r.Form)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		authServer.EndSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/oauth", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	logger.Info("Signed out", "redirect", target)
+	if target != "" {
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	writeLoginPage(w, http.StatusOK, loginView{SignedOut: true})
+}
+
+func getDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, authServer.Discovery())
+}
+
+func getJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oauth.Current().Keys.JWKS())
+}
+
+// getRevocations lists the revoked tokens, by jti or token hash.
+func getRevocations(w http.ResponseWriter, r *http.Request) {
+	if authServer == nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "OAuth is not configured"})
+		return
+	}
+	list, err := oauth.Current().Revocations()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: list})
+}
+
+// clearRevocations reinstates every revoked token.
+func clearRevocations(w http.ResponseWriter, r *http.Request) {
+	if authServer == nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "OAuth is not configured"})
+		return
+	}
+	if err := oauth.Current().ClearRevocations(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Cleared token revocations")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+// getOAuthSettings shows the authorization server's configuration, without
+// client secrets.
+func getOAuthSettings(w http.ResponseWriter, r *http.Request) {
+	if authServer == nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "OAuth is not configured"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: authServer.Config()})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"mock-server/cmd/rest/internal/openapi"
+	"mock-server/cmd/rest/internal/validation"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+)
+
+// builtinSpec describes the routes registered in setupRESTRoutes.
+//
+//go:embed openapi.yaml
+var builtinSpec []byte
+
+var (
+	// apiMock is set when an OpenAPI document is configured.
+	apiMock    *openapi.Mock
+	builtinAPI *openapi.Mock
+)
+
+// registerOpenAPIRoutes mounts every operation of the configured document.
+// Built-in routes are registered first and therefore win on conflicts.
+func registerOpenAPIRoutes(r *mux.Router) {
+	if apiMock == nil {
+		return
+	}
+
+	for _, op := range apiMock.Operations() {
+		var handler http.HandlerFunc = apiMock.Handler(op)
+		if op.RequiresBearer {
+			handler = authMiddleware(handler)
+		}
+		r.HandleFunc(op.Path, handler).Methods(op.Method)
+		logger.Debug("Registered OpenAPI operation", "method", op.Method, "path", op.Path, "operationId", op.ID, "auth", op.RequiresBearer)
+	}
+	logger.Info("Mocking OpenAPI document", "title", apiMock.Doc.Info.Title, "operations", len(apiMock.Operations()), "basePath", apiMock.BasePath)
+}
+
+// validateRequests wraps the router with schema validation for the built-in
+// routes and, if configured, the mocked OpenAPI document.
+func validateRequests(next http.Handler, strict bool) (http.Handler, error) {
+	docs := map[string]*openapi3.T{builtinAPI.BasePath: builtinAPI.Doc}
+	if apiMock != nil {
+		docs[apiMock.BasePath] = apiMock.Doc
+	}
+
+	validator, err := validation.New(strict, docs)
+	if err != nil {
+		return nil, err
+	}
+	return validator.Middleware(next, func(w http.ResponseWriter, r *http.Request, status int, f *validation.Failure) {
+		if status >= http.StatusInternalServerError {
+			logger.Error("Response does not match its OpenAPI schema", "method", r.Method, "path", r.URL.Path, "issues", f.Error())
+			writeJSON(w, status, APIResponse{Success: false, Error: "Response validation failed", Data: f.Issues})
+			return
+		}
+		logger.Warn("Request rejected by OpenAPI validation", "method", r.Method, "path", r.URL.Path, "issues", f.Error())
+		writeJSON(w, status, APIResponse{Success: false, Error: "Request validation failed", Data: f.Issues})
+	}), nil
+}
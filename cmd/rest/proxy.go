@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"mock-server/cmd/rest/internal/config"
+	"mock-server/cmd/rest/internal/journal"
+	"mock-server/cmd/rest/internal/recorder"
+	"mock-server/cmd/rest/internal/stubs"
+)
+
+var upstreamProxy = recorder.New(config.Proxy{})
+
+// proxyRequest forwards an unmatched request to the upstream and, in record
+// mode, saves the exchange as a stub file.
+func proxyRequest(w http.ResponseWriter, r *http.Request, req *stubs.Request) {
+	resp, err := upstreamProxy.Forward(req)
+	if err != nil {
+		logger.Error("Upstream request failed", "method", req.Method, "url", req.URL, "error", err)
+		writeJSON(w, http.StatusBadGateway, APIResponse{Success: false, Error: "Upstream request failed"})
+		return
+	}
+	journal.MarkMatched(r.Context(), "proxy:"+upstreamProxy.Config().Upstream)
+	logger.Info("Proxied request", "method", req.Method, "url", req.URL, "status", resp.Status)
+
+	if upstreamProxy.Recording() {
+		stub, path, err := upstreamProxy.Record(req, resp)
+		switch {
+		case errors.Is(err, recorder.ErrRecorded):
+			logger.Info("Exchange already recorded", "id", stub.ID, "file", path)
+		case err != nil:
+			logger.Error("Could not record exchange", "method", req.Method, "url", req.URL, "error", err)
+		default:
+			logger.Info("Recorded exchange", "id", stub.ID, "file", path)
+		}
+	}
+
+	for k, values := range resp.Headers {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+type proxySettings struct {
+	Mode          string `json:"mode"`
+	Upstream      string `json:"upstream,omitempty"`
+	RecordingsDir string `json:"recordingsDir,omitempty"`
+}
+
+func getProxySettings(w http.ResponseWriter, r *http.Request) {
+	cfg := upstreamProxy.Config()
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: proxySettings{
+		Mode:          cfg.Mode,
+		Upstream:      cfg.Upstream,
+		RecordingsDir: cfg.RecordingsDir,
+	}})
+}
+
+// updateProxySettings switches modes at runtime. Entering or leaving playback
+// reloads the stubs so only the appropriate set is served.
+func updateProxySettings(w http.ResponseWriter, r *http.Request) {
+	var settings proxySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+
+	previous := upstreamProxy.Config().Mode
+	if err := upstreamProxy.SetMode(settings.Mode, settings.Upstream); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Proxy mode changed", "from", previous, "to", settings.Mode)
+
+	if previous == "playback" || settings.Mode == "playback" {
+		stubStore.Reset()
+		if err := loadStubs(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	getProxySettings(w, r)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/ratelimit"
+)
+
+var (
+	rateLimits  = ratelimit.NewRegistry(nil, nil)
+	rateLimiter = ratelimit.NewLimiter()
+)
+
+// allowRequest counts r against its policy and answers 429 when the client is
+// over quota. It reports whether the request may proceed.
+func allowRequest(w http.ResponseWriter, r *http.Request, routeKeys ...string) bool {
+	scope, policy := rateLimits.Resolve(routeKeys...)
+	if policy == nil || policy.Limit == 0 {
+		return true
+	}
+
+	client := policy.ClientKey(r)
+	decision := rateLimiter.Take(scope, client, policy)
+	decision.WriteHeaders(w.Header())
+	if decision.Allowed {
+		return true
+	}
+
+	logger.Warn("Rate limit exceeded", "scope", scope, "client", client, "path", r.URL.Path)
+	writeJSON(w, http.StatusTooManyRequests, APIResponse{Success: false, Error: "Too Many Requests"})
+	return false
+}
+
+// limitRequests applies the rate limits to built-in routes.
+func limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowRequest(w, r, routeKeys(r)...) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+type rateLimitOverview struct {
+	Global   *ratelimit.Policy            `json:"global"`
+	Routes   map[string]*ratelimit.Policy `json:"routes"`
+	Counters []ratelimit.Counter          `json:"counters"`
+}
+
+// getRateLimits shows the policies and every client's counter, optionally
+// only those of ?scope= ("global" or a route).
+func getRateLimits(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: rateLimitOverview{
+		Global:   rateLimits.Global(),
+		Routes:   rateLimits.Routes(),
+		Counters: rateLimiter.Counters(r.URL.Query().Get("scope")),
+	}})
+}
+
+// resetRateLimits restores quotas: all of them, or those selected with
+// ?scope= and ?client=.
+func resetRateLimits(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	rateLimiter.Reset(q.Get("scope"), q.Get("client"))
+	logger.Info("Rate limit counters reset", "scope", q.Get("scope"), "client", q.Get("client"))
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setGlobalRateLimit(w http.ResponseWriter, r *http.Request) {
+	var policy ratelimit.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	if err := rateLimits.SetGlobal(&policy); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Global rate limit updated", "policy", policy)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: policy})
+}
+
+func clearGlobalRateLimit(w http.ResponseWriter, r *http.Request) {
+	rateLimits.SetGlobal(nil)
+	rateLimiter.Reset(ratelimit.GlobalScope, "")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+// setRouteRateLimit overrides the policy of one route, e.g.
+// {"route": "GET /customers", "policy": {"limit": 5, "windowMs": 60000}}.
+// A limit of 0 exempts the route.
+func setRouteRateLimit(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route  string            `json:"route"`
+		Policy *ratelimit.Policy `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || body.Policy == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its policy"})
+		return
+	}
+	if err := rateLimits.SetRoute(body.Route, body.Policy); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteRateLimit(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	rateLimits.SetRoute(route, nil)
+	rateLimiter.Reset(route, "")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"mock-server/internal/common"
+	"mock-server/internal/rbac"
+
+	"github.com/gorilla/mux"
+)
+
+// accessPolicy holds the role requirements shared with the SOAP and SFTP
+// services.
+var accessPolicy = &rbac.Policy{}
+
+// authorizeRoutes enforces the access policy on built-in routes. A route
+// with a requirement is authenticated first if its schemes have not already
+// done so, and callers whose roles fall short get 403.
+func authorizeRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, req := accessPolicy.RESTRoute(routeKeys(r)...)
+		if req == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !authenticated(r) {
+			var ok bool
+			if r, ok = identify(w, r); !ok {
+				return
+			}
+		}
+
+		user, _ := common.UserFromContext(r.Context())
+		if err := accessPolicy.Check(user, req); err != nil {
+			logger.Warn("Access denied", "route", route, "username", username(user), "error", err)
+			writeJSON(w, http.StatusForbidden, APIResponse{Success: false, Error: "Forbidden"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func username(user *common.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Username
+}
+
+func getAccessPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: accessPolicy})
+}
+
+// getEffectiveAccess evaluates every requirement of the policy for one
+// user, across all three services.
+func getEffectiveAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := common.LookupUser(mux.Vars(r)["username"])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "User not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: accessPolicy.Effective(user)})
+}
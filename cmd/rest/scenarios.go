@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func listScenarios(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: stubStore.Scenarios()})
+}
+
+func getScenario(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	for _, sc := range stubStore.Scenarios() {
+		if sc.Name == name {
+			writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: sc})
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Scenario not found"})
+}
+
+func resetScenarios(w http.ResponseWriter, r *http.Request) {
+	stubStore.ResetScenarios()
+	logger.Info("Reset all scenarios")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func resetScenario(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !stubStore.ResetScenario(name) {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Scenario not found"})
+		return
+	}
+	logger.Info("Reset scenario", "scenario", name)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setScenarioState(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.State == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a state"})
+		return
+	}
+	if !stubStore.SetScenarioState(name, body.State) {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Scenario not found"})
+		return
+	}
+	logger.Info("Set scenario state", "scenario", name, "state", body.State)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/sequence"
+	"mock-server/cmd/rest/internal/stubs"
+)
+
+var (
+	sequenceTracker  = sequence.NewTracker()
+	sequenceRegistry = sequence.NewRegistry(nil)
+)
+
+// nextStubResponse picks the response a stub serves for r, advancing its
+// sequence when it has more than one.
+func nextStubResponse(r *http.Request, stub *stubs.Stub) stubs.ResponseDefinition {
+	defs := stub.Definitions()
+	return defs[sequenceTracker.Next("stub:"+stub.ID, stub.Sequence, r, len(defs))]
+}
+
+// serveSequences answers built-in routes that have a response sequence. A
+// passthrough step hands the request to the route's own handler.
+func serveSequences(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, seq := sequenceRegistry.Resolve(routeKeys(r)...)
+		if seq == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		resp := seq.Responses[sequenceTracker.Next("route:"+key, &seq.Settings, r, len(seq.Responses))]
+		if resp.Passthrough {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logger.Info("Serving sequence response", "route", key, "status", resp.Status, "path", r.URL.Path)
+		resp.Write(w)
+	})
+}
+
+type sequenceOverview struct {
+	Routes    map[string]*sequence.Route `json:"routes"`
+	Positions []sequence.Position        `json:"positions"`
+}
+
+func getSequences(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: sequenceOverview{
+		Routes:    sequenceRegistry.Routes(),
+		Positions: sequenceTracker.Positions(),
+	}})
+}
+
+// resetSequences restarts sequences: all of them, one ("stub:<id>" or
+// "route:<METHOD /template>"), or one client's position within one.
+func resetSequences(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Sequence string `json:"sequence"`
+		Client   string `json:"client"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+			return
+		}
+	}
+	if body.Client != "" && body.Sequence == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Resetting a client requires a sequence"})
+		return
+	}
+	sequenceTracker.Reset(body.Sequence, body.Client)
+	logger.Info("Reset response sequences", "sequence", body.Sequence, "client", body.Client)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setRouteSequence(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route    string          `json:"route"`
+		Sequence *sequence.Route `json:"sequence"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || body.Sequence == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its sequence"})
+		return
+	}
+	if err := sequenceRegistry.SetRoute(body.Route, body.Sequence); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	sequenceTracker.Reset("route:"+body.Route, "")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteSequence(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	sequenceRegistry.SetRoute(route, nil)
+	sequenceTracker.Reset("route:"+route, "")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/stream"
+	"mock-server/cmd/rest/internal/stubs"
+	"mock-server/cmd/rest/internal/tmpl"
+
+	"github.com/gorilla/websocket"
+)
+
+var streamHub = stream.NewHub(nil)
+
+// upgrader accepts WebSocket connections from any origin, as a mock should.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// serveStream answers a request for a streaming endpoint.
+func serveStream(w http.ResponseWriter, r *http.Request, req *stubs.Request, path string, e *stream.Endpoint) {
+	data := stream.Data{Request: templateRequest(r, req)}
+	switch e.Kind {
+	case stream.KindSSE:
+		serveSSE(w, r, path, e, data)
+	case stream.KindWebSocket:
+		serveWebSocket(w, r, path, e, data)
+	}
+}
+
+func serveSSE(w http.ResponseWriter, r *http.Request, path string, e *stream.Endpoint, data stream.Data) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, APIResponse{Success: false, Error: "Streaming is not supported"})
+		return
+	}
+
+	client := streamHub.Connect(path, stream.KindSSE, r.RemoteAddr)
+	defer streamHub.Disconnect(client)
+	data.Client = client.ID
+	logger.Info("SSE client connected", "path", path, "client", client.ID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if e.RetryMs > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", e.RetryMs)
+	}
+	flusher.Flush()
+
+	err := streamHub.Serve(r.Context(), client, e, data, func(f stream.Frame) error {
+		if f.ID != "" {
+			fmt.Fprintf(w, "id: %s\n", f.ID)
+		}
+		if f.Event != "" {
+			fmt.Fprintf(w, "event: %s\n", f.Event)
+		}
+		for _, line := range strings.Split(f.Data, "\n") {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		if _, err := fmt.Fprint(w, "\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		logger.Warn("SSE stream ended with an error", "path", path, "client", client.ID, "error", err)
+	}
+	logger.Info("SSE client disconnected", "path", path, "client", client.ID)
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request, path string, e *stream.Endpoint, data stream.Data) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the client
+		logger.Warn("WebSocket upgrade failed", "path", path, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	client := streamHub.Connect(path, stream.KindWebSocket, r.RemoteAddr)
+	defer streamHub.Disconnect(client)
+	data.Client = client.ID
+	logger.Info("WebSocket client connected", "path", path, "client", client.ID)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the reader answers inbound frames through the client's queue, leaving
+	// the connection's single writer to Serve
+	go func() {
+		defer cancel()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			streamHub.Received(client)
+			frame := string(msg)
+			if e.Echo {
+				if streamHub.Queue(ctx, client, stream.Frame{Data: frame}) != nil {
+					return
+				}
+			}
+			replies, matches := e.Reply(frame)
+			if replies == nil {
+				continue
+			}
+			in := data
+			in.Frame, in.JSON, in.Matches = frame, tmpl.ParseJSON(frame), matches
+			go func() {
+				queue := func(f stream.Frame) error { return streamHub.Queue(ctx, client, f) }
+				if err := stream.Play(ctx, replies, in, queue); err != nil && !errors.Is(err, context.Canceled) {
+					logger.Warn("Could not send WebSocket reply", "path", path, "client", client.ID, "error", err)
+				}
+			}()
+		}
+	}()
+
+	err = streamHub.Serve(ctx, client, e, data, func(f stream.Frame) error {
+		return conn.WriteMessage(websocket.TextMessage, []byte(f.Data))
+	})
+	if err != nil {
+		logger.Warn("WebSocket stream ended with an error", "path", path, "client", client.ID, "error", err)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	logger.Info("WebSocket client disconnected", "path", path, "client", client.ID)
+}
+
+type streamOverview struct {
+	Endpoints map[string]*stream.Endpoint `json:"endpoints"`
+	Clients   []stream.Client             `json:"clients"`
+}
+
+// listStreams shows the streaming endpoints and their connected clients,
+// optionally only those of ?path=.
+func listStreams(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: streamOverview{
+		Endpoints: streamHub.Endpoints(),
+		Clients:   streamHub.Clients(r.URL.Query().Get("path")),
+	}})
+}
+
+func setStream(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path     string           `json:"path"`
+		Endpoint *stream.Endpoint `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !strings.HasPrefix(body.Path, "/") || body.Endpoint == nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a path and its endpoint"})
+		return
+	}
+	if err := streamHub.SetEndpoint(body.Path, body.Endpoint); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Stream endpoint set", "path", body.Path, "kind", body.Endpoint.Kind)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearStream(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing path query parameter"})
+		return
+	}
+	streamHub.SetEndpoint(path, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+// pushStream sends an ad-hoc message to the clients of a path, or to one
+// client. The message's data is rendered once per push with only {{uuid}}
+// and {{now}} available.
+func pushStream(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Path    string         `json:"path"`
+		Client  string         `json:"client"`
+		Message stream.Message `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	if body.Path == "" && body.Client == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a path or a client"})
+		return
+	}
+
+	frame, err := body.Message.Render(stream.Data{})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	delivered, err := streamHub.Push(body.Path, body.Client, frame)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Pushed stream message", "path", body.Path, "client", body.Client, "delivered", delivered)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: map[string]int{"delivered": delivered}})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"mock-server/internal/certs"
+	"mock-server/internal/consts"
+)
+
+var (
+	tlsSettings certs.Settings
+	// localCA is set when the HTTPS listener uses the generated CA, either
+	// for its own certificate or to verify client certificates.
+	localCA *certs.Authority
+)
+
+// serveTLS starts the HTTPS listener alongside the plain HTTP one.
+func serveTLS(handler http.Handler) error {
+	if tlsSettings.Port == 0 {
+		tlsSettings.Port = consts.HTTPS_PORT
+	}
+
+	cfg, ca, err := certs.ServerConfig("rest", tlsSettings)
+	if err != nil {
+		return err
+	}
+	localCA = ca
+
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", tlsSettings.Port),
+		Handler:   handler,
+		TLSConfig: cfg,
+	}
+	logger.Info(fmt.Sprintf("Listening with TLS on :%d", tlsSettings.Port), "clientAuth", tlsSettings.ClientAuth, "generated", tlsSettings.Generated())
+	if ca != nil {
+		logger.Info("Clients can trust the local CA", "file", ca.Dir()+"/"+certs.CACertFile)
+	}
+	go func() {
+		logger.Fatal(server.ListenAndServeTLS("", ""))
+	}()
+	return nil
+}
+
+func getTLSSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: tlsSettings})
+}
+
+// getCACertificate exports the local CA so clients can trust the generated
+// server certificates.
+func getCACertificate(w http.ResponseWriter, r *http.Request) {
+	if localCA == nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "No local CA is in use"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="servr-ca.crt"`)
+	w.Write(localCA.CertPEM)
+}
+
+type clientCertificate struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+}
+
+// issueClientCertificate signs a client certificate for mutual TLS with the
+// local CA. The subject's common name names the user it authenticates, whose
+// roles come from the user store; organizational units are informational.
+func issueClientCertificate(w http.ResponseWriter, r *http.Request) {
+	if localCA == nil {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "No local CA is in use"})
+		return
+	}
+
+	var req certs.ClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Invalid JSON"})
+		return
+	}
+	cert, key, err := localCA.ClientCertificate(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	logger.Info("Issued client certificate", "commonName", req.CommonName, "organizationalUnits", req.OrganizationalUnits)
+	writeJSON(w, http.StatusCreated, APIResponse{Success: true, Data: clientCertificate{
+		Certificate: string(cert),
+		PrivateKey:  string(key),
+	}})
+}
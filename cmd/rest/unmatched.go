@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"mock-server/cmd/rest/internal/journal"
+	"mock-server/cmd/rest/internal/stubs"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	stubStore       = stubs.NewStore()
+	nearMissesLimit = 3
+
+	// builtinRoutes is filled once the router is set up
+	builtinRoutes []stubs.Candidate
+)
+
+type unmatchedReport struct {
+	Request    *stubs.Request   `json:"request"`
+	NearMisses []stubs.NearMiss `json:"nearMisses"`
+}
+
+// unmatchedHandler is installed as the router's NotFound and MethodNotAllowed
+// handler. Stub mappings get a chance to answer first, then the upstream when
+// proxying; otherwise the client receives the closest stubs and routes along
+// with what differed.
+func unmatchedHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, adminPrefix) && !allowRequest(w, r) {
+			return
+		}
+
+		req, err := stubs.NewRequest(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+			return
+		}
+
+		if e, ok := streamHub.Endpoint(r.URL.Path); ok {
+			journal.MarkMatched(r.Context(), "stream:"+r.URL.Path)
+			serveStream(w, r, req, r.URL.Path, e)
+			return
+		}
+
+		if stub, ok := stubStore.Match(req); ok {
+			journal.MarkMatched(r.Context(), "stub:"+stub.ID)
+			if len(stub.Auth) > 0 {
+				if r, ok = requireAuth(w, r, stub.Auth); !ok {
+					return
+				}
+			}
+			// a replayed response neither advances the stub's sequence or
+			// scenario nor sends its callbacks again
+			serve := func(w http.ResponseWriter, r *http.Request) {
+				stubStore.Transition(stub)
+				resp := nextStubResponse(r, stub)
+				withFaults(w, r, resp.Faults, func(w http.ResponseWriter, r *http.Request) {
+					if stub.Job != nil {
+						acceptJob(w, r, req, stub.Job, "stub:"+stub.ID)
+						return
+					}
+					serveStub(w, r, stub, resp)
+				})
+			}
+			withIdempotency(w, r, func(w http.ResponseWriter, r *http.Request) {
+				if len(stub.Callbacks) > 0 {
+					withCallbacks(w, r, req, stub.Callbacks, "stub:"+stub.ID, serve)
+					return
+				}
+				serve(w, r)
+			})
+			return
+		}
+
+		if upstreamProxy.Forwarding() {
+			withFaults(w, r, nil, func(w http.ResponseWriter, r *http.Request) {
+				proxyRequest(w, r, req)
+			})
+			return
+		}
+
+		candidates := append(stubStore.StubCandidates(), builtinRoutes...)
+		misses := stubs.FindNearMisses(req, candidates, nearMissesLimit)
+		logNearMisses(req, misses)
+
+		writeJSON(w, status, APIResponse{
+			Success: false,
+			Error:   "No route or stub matched the request",
+			Data:    unmatchedReport{Request: req, NearMisses: misses},
+		})
+	})
+}
+
+func logNearMisses(req *stubs.Request, misses []stubs.NearMiss) {
+	logger.Warn("Request was not matched", "method", req.Method, "url", req.URL, "nearMisses", len(misses))
+	for _, miss := range misses {
+		name := miss.Name
+		if name == "" {
+			name = miss.ID
+		}
+		for _, diff := range miss.Diffs {
+			if diff.Matched {
+				continue
+			}
+			logger.Warn("  near miss", "kind", miss.Kind, "name", name, "field", diff.Field, "expected", diff.Expected, "actual", diff.Actual)
+		}
+	}
+}
+
+func serveStub(w http.ResponseWriter, r *http.Request, stub *stubs.Stub, resp stubs.ResponseDefinition) {
+	logger.Info("Serving stub", "id", stub.ID, "name", stub.Name, "method", r.Method, "path", r.URL.Path)
+
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	body := []byte(resp.Body)
+	if len(resp.JSONBody) > 0 {
+		body = resp.JSONBody
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+
+	if serveStubConditionally(w, r, stub.CacheControl, status, body) {
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// routeCandidates describes the router's built-in routes as request patterns
+// so they can take part in near-miss reports.
+func routeCandidates(router *mux.Router) []stubs.Candidate {
+	var out []stubs.Candidate
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || strings.HasPrefix(tpl, adminPrefix) {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil || len(methods) == 0 {
+			methods = []string{""}
+		}
+		for _, method := range methods {
+			out = append(out, stubs.Candidate{
+				Kind: "route",
+				Name: strings.TrimSpace(method + " " + tpl),
+				Pattern: stubs.RequestPattern{
+					Method:         method,
+					URLPathPattern: templateToPattern(tpl),
+				},
+			})
+		}
+		return nil
+	})
+	return out
+}
+
+// templateToPattern turns a mux path template such as /customer/{id} or
+// /items/{id:[0-9]+} into a regular expression for the stub matcher.
+func templateToPattern(tpl string) string {
+	var b strings.Builder
+	for i := 0; i < len(tpl); {
+		if tpl[i] != '{' {
+			end := strings.IndexByte(tpl[i:], '{')
+			if end < 0 {
+				end = len(tpl) - i
+			}
+			b.WriteString(regexp.QuoteMeta(tpl[i : i+end]))
+			i += end
+			continue
+		}
+
+		// variables may contain nested braces in their pattern, e.g. {id:[0-9]{2}}
+		depth, j := 0, i
+		for ; j < len(tpl); j++ {
+			if tpl[j] == '{' {
+				depth++
+			} else if tpl[j] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		variable := tpl[i+1 : min(j, len(tpl))]
+		if _, pattern, ok := strings.Cut(variable, ":"); ok {
+			b.WriteString("(?:" + pattern + ")")
+		} else {
+			b.WriteString("[^/]+")
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
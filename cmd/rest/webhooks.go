@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"mock-server/cmd/rest/internal/stubs"
+	"mock-server/cmd/rest/internal/tmpl"
+	"mock-server/cmd/rest/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCapturedBody bounds how much of a response is kept for callback templates.
+const maxCapturedBody = 64 * 1024
+
+var (
+	webhookDispatcher = webhook.NewDispatcher(500, nil)
+	webhookRegistry   = webhook.NewRegistry(nil)
+)
+
+// bodyRecorder keeps the start of the response body alongside its status so
+// callbacks can refer to what the client received.
+type bodyRecorder struct {
+	*statusRecorder
+	body []byte
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	if room := maxCapturedBody - len(rec.body); room > 0 {
+		rec.body = append(rec.body, b[:min(room, len(b))]...)
+	}
+	return rec.statusRecorder.Write(b)
+}
+
+// templateRequest exposes a captured request to response and callback
+// templates.
+func templateRequest(r *http.Request, req *stubs.Request) tmpl.Request {
+	return tmpl.Request{
+		Method:     req.Method,
+		URL:        req.URL,
+		Path:       req.Path,
+		PathParams: mux.Vars(r),
+		Query:      req.Query,
+		Headers:    req.Headers,
+		Body:       req.Body,
+	}
+}
+
+// withCallbacks serves the request and then schedules callbacks with the
+// request and response as template data.
+func withCallbacks(w http.ResponseWriter, r *http.Request, req *stubs.Request, callbacks []webhook.Callback, source string, serve http.HandlerFunc) {
+	rec := &bodyRecorder{statusRecorder: &statusRecorder{ResponseWriter: w}}
+	serve(rec, r)
+
+	data := webhook.Data{
+		Request:  templateRequest(r, req),
+		Response: webhook.ResponseData{Status: rec.status, Body: string(rec.body)},
+	}
+	for _, cb := range callbacks {
+		delivery, err := webhookDispatcher.Schedule(cb, data, source)
+		if err != nil {
+			logger.Error("Could not schedule webhook", "source", source, "error", err)
+			continue
+		}
+		logger.Info("Scheduled webhook", "id", delivery.ID, "source", source, "method", delivery.Method, "url", delivery.URL, "delayMs", cb.DelayMs)
+	}
+}
+
+// triggerWebhooks sends the callbacks configured for built-in routes once
+// they have responded.
+func triggerWebhooks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, callbacks := webhookRegistry.Resolve(routeKeys(r)...)
+		if len(callbacks) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		req, err := stubs.NewRequest(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Could not read request body"})
+			return
+		}
+		withCallbacks(w, r, req, callbacks, "route:"+key, next.ServeHTTP)
+	})
+}
+
+type webhookOverview struct {
+	Routes     map[string][]webhook.Callback `json:"routes"`
+	Deliveries []webhook.Delivery            `json:"deliveries"`
+}
+
+// listWebhooks shows the route callbacks and recorded deliveries, optionally
+// filtered with ?source=stub:<id> and ?state=pending|succeeded|failed.
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: webhookOverview{
+		Routes:     webhookRegistry.Routes(),
+		Deliveries: webhookDispatcher.Deliveries(q.Get("source"), q.Get("state")),
+	}})
+}
+
+func getWebhook(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := webhookDispatcher.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{Success: false, Error: "Delivery not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: delivery})
+}
+
+func resetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhookDispatcher.Reset()
+	logger.Info("Cleared webhook deliveries")
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
+
+func setRouteWebhooks(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Route     string             `json:"route"`
+		Callbacks []webhook.Callback `json:"callbacks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Route == "" || len(body.Callbacks) == 0 {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Expected a route and its callbacks"})
+		return
+	}
+	if err := webhookRegistry.SetRoute(body.Route, body.Callbacks); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, APIResponse{Success: true, Data: body})
+}
+
+func clearRouteWebhooks(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, APIResponse{Success: false, Error: "Missing route query parameter"})
+		return
+	}
+	webhookRegistry.SetRoute(route, nil)
+	writeJSON(w, http.StatusOK, APIResponse{Success: true})
+}
@@ -12,41 +12,99 @@ import (
 	"mock-server/cmd/sftp/internal/consts"
 	internal "mock-server/cmd/sftp/internal/hostKey"
 	"mock-server/internal/common"
+	"mock-server/internal/oauth"
+	"mock-server/internal/rbac"
 
 	CharmLog "github.com/charmbracelet/log"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
-type fileHandler struct{}
-type listHandler struct{}
-type cmdHandler struct{}
+// Handlers act for the user who opened the session.
+type fileHandler struct{ user *common.User }
+type listHandler struct{ user *common.User }
+type cmdHandler struct{ user *common.User }
 
 type lister []os.FileInfo
 
-var logger = CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
+var logger = common.RedactSecrets(CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
 	ReportTimestamp: true,
 	TimeFormat:      time.Kitchen,
 	Prefix:          "SFTP Service 📁",
-})
+}))
 
+// accessPolicy holds the role requirements shared with the REST and SOAP
+// services.
+var accessPolicy = &rbac.Policy{}
+
+// sftpAuthHandler accepts a user's password or any of their API tokens.
 func sftpAuthHandler(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
-	user, err := common.ValidateAuth(string(password))
+	scheme := "password"
+	user, err := common.ValidatePassword(conn.User(), string(password))
 	if err != nil {
+		passwordErr := err
+		scheme = "token"
+		if user, err = common.ValidateAuth(string(password)); err != nil {
+			common.Audit(common.AuthEvent{Scheme: "password", Username: conn.User(), Reason: passwordErr.Error() + "; " + err.Error()}, conn.RemoteAddr().String())
+			return nil, err
+		}
+	}
+	common.Audit(common.AuthEvent{Scheme: scheme, Username: user.Username, Success: true}, conn.RemoteAddr().String())
+	return sessionPermissions(user), nil
+}
+
+func sftpKeyAuthHandler(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user, err := common.ValidateSSHKey(conn.User(), key.Marshal())
+	if err != nil {
+		common.Audit(common.AuthEvent{Scheme: "publickey", Username: conn.User(), Reason: err.Error()}, conn.RemoteAddr().String())
 		return nil, err
 	}
+	common.Audit(common.AuthEvent{Scheme: "publickey", Username: user.Username, Success: true}, conn.RemoteAddr().String())
+	return sessionPermissions(user), nil
+}
 
+func sessionPermissions(user *common.User) *ssh.Permissions {
 	return &ssh.Permissions{
 		Extensions: map[string]string{
 			"user":  user.Username,
 			"email": user.Email,
+			"roles": strings.Join(user.Roles, ","),
+			"token": user.TokenID,
 		},
-	}, nil
+	}
+}
+
+// sessionUser rebuilds the user that sessionPermissions recorded.
+func sessionUser(perms *ssh.Permissions) *common.User {
+	user := &common.User{Username: perms.Extensions["user"], Email: perms.Extensions["email"], TokenID: perms.Extensions["token"]}
+	if roles := perms.Extensions["roles"]; roles != "" {
+		user.Roles = strings.Split(roles, ",")
+	}
+	return user
+}
+
+// authorize checks user against the access policy's read or write
+// requirement for a path. Sessions opened with a token end up denied
+// everything once it is revoked.
+func authorize(user *common.User, path string, write bool) error {
+	if user.TokenID != "" && oauth.Current().Revoked(user.TokenID) {
+		logger.Warn("Access denied", "path", path, "username", user.Username, "error", oauth.ErrRevoked)
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	rule, req := accessPolicy.SFTPPath(path, write)
+	if err := accessPolicy.Check(user, req); err != nil {
+		logger.Warn("Access denied", "path", path, "rule", rule, "write", write, "username", user.Username, "error", err)
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return nil
 }
 
 // Mock File System Implementation
 func (fs *fileHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 	logger.Info("Fileread called", "path", r.Filepath, "method", r.Method)
+	if err := authorize(fs.user, r.Filepath, false); err != nil {
+		return nil, err
+	}
 
 	cleanPath := filepath.Clean(r.Filepath)
 	cleanPath = strings.TrimPrefix(cleanPath, string(filepath.Separator))
@@ -57,6 +115,10 @@ func (fs *fileHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 }
 
 func (fs *fileHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if err := authorize(fs.user, r.Filepath, true); err != nil {
+		return nil, err
+	}
+
 	cleanPath := filepath.Clean(r.Filepath)
 	cleanPath = strings.TrimPrefix(cleanPath, string(filepath.Separator))
 	fullPath := filepath.Join(consts.SFTPRoot, cleanPath)
@@ -71,6 +133,23 @@ func (fs *cmdHandler) Filecmd(r *sftp.Request) error {
 	fullPath := filepath.Join(consts.SFTPRoot, cleanPath)
 
 	logger.Info("Running command", "method", r.Method, "path", fullPath)
+	switch r.Method {
+	case "Realpath":
+	case "Stat", "Lstat", "Fstart":
+		if err := authorize(fs.user, r.Filepath, false); err != nil {
+			return err
+		}
+	case "Rename":
+		if err := authorize(fs.user, r.Target, true); err != nil {
+			return err
+		}
+		fallthrough
+	default:
+		if err := authorize(fs.user, r.Filepath, true); err != nil {
+			return err
+		}
+	}
+
 	switch r.Method {
 	case "Realpath":
 		return nil
@@ -98,6 +177,10 @@ func (fs *cmdHandler) Filecmd(r *sftp.Request) error {
 
 func (fs *listHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 	logger.Info("FileList recieved...", "method", r.Method)
+	if err := authorize(fs.user, r.Filepath, false); err != nil {
+		return nil, err
+	}
+
 	cleanPath := filepath.Clean(r.Filepath)
 	cleanPath = strings.TrimPrefix(cleanPath, string(filepath.Separator))
 	fullPath := filepath.Join(consts.SFTPRoot, cleanPath)
@@ -170,11 +253,11 @@ func handleSFTPConnection(netConn net.Conn, config *ssh.ServerConfig) {
 			continue
 		}
 
-		go handleSFTPChannel(channel, requests)
+		go handleSFTPChannel(channel, requests, sessionUser(sshConn.Permissions))
 	}
 }
 
-func handleSFTPChannel(channel ssh.Channel, requets <-chan *ssh.Request) {
+func handleSFTPChannel(channel ssh.Channel, requets <-chan *ssh.Request, user *common.User) {
 	defer channel.Close()
 
 	for req := range requets {
@@ -184,15 +267,15 @@ func handleSFTPChannel(channel ssh.Channel, requets <-chan *ssh.Request) {
 			}
 
 			handlers := sftp.Handlers{
-				FileGet:  &fileHandler{},
-				FilePut:  &fileHandler{},
-				FileCmd:  &cmdHandler{},
-				FileList: &listHandler{},
+				FileGet:  &fileHandler{user},
+				FilePut:  &fileHandler{user},
+				FileCmd:  &cmdHandler{user},
+				FileList: &listHandler{user},
 			}
 
 			server := sftp.NewRequestServer(channel, handlers)
 
-			logger.Info("Session started")
+			logger.Info("Session started", "username", user.Username)
 			server.Serve()
 			logger.Info("Session ended")
 			return
@@ -212,8 +295,23 @@ func main() {
 		logger.Fatal("Failed to generate host key", err)
 	}
 
+	if err := common.LoadUsers(); err != nil {
+		logger.Fatal("Failed to load users", "error", err)
+	}
+	if err := common.StartAudit("sftp"); err != nil {
+		logger.Fatal("Failed to start auth audit", "error", err)
+	}
+	if accessPolicy, err = rbac.Load(); err != nil {
+		logger.Fatal("Failed to load RBAC policy", "error", err)
+	}
+	// tokens issued by the REST service's OAuth server verify here too
+	if _, err := oauth.Load(); err != nil {
+		logger.Fatal("Failed to load OAuth settings", "error", err)
+	}
+
 	config := &ssh.ServerConfig{
-		PasswordCallback: sftpAuthHandler,
+		PasswordCallback:  sftpAuthHandler,
+		PublicKeyCallback: sftpKeyAuthHandler,
 	}
 	config.AddHostKey(hostkey)
 
@@ -224,7 +322,7 @@ func main() {
 	defer listener.Close()
 
 	logger.Info("SFTP server listening", "port", consts.SFTP_PORT)
-	logger.Info("Server Details", "addr", listener.Addr(), "user", "testuser", "password", "testpass")
+	logger.Info("Server Details", "addr", listener.Addr())
 
 	for {
 		conn, err := listener.Accept()
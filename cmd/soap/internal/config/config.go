@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mock-server/internal/certs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the SOAP service configuration, loaded from the YAML file named
+// by the SOAP_CONFIG environment variable.
+type Config struct {
+	TLS certs.Settings `yaml:"tls"`
+}
+
+// Load reads the file named by SOAP_CONFIG. An unset variable is not an error;
+// the service simply runs with the defaults.
+func Load() (*Config, error) {
+	cfg := &Config{}
+
+	path := os.Getenv("SOAP_CONFIG")
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	// relative paths in the config are resolved against the config file itself
+	cfg.TLS.Resolve(filepath.Dir(path))
+	if err := cfg.TLS.Validate(); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return cfg, nil
+}
@@ -3,26 +3,37 @@ package main
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"mock-server/cmd/soap/internal/config"
 	SOAP "mock-server/cmd/soap/internal/models"
 	builder "mock-server/cmd/soap/internal/util"
 	"mock-server/cmd/soap/internal/wsdl"
+	"mock-server/internal/certs"
+	"mock-server/internal/common"
 	GlobalModels "mock-server/internal/common/models"
 	"mock-server/internal/consts"
+	"mock-server/internal/oauth"
+	"mock-server/internal/rbac"
 
 	CharmLog "github.com/charmbracelet/log"
 )
 
-var logger = CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
+var logger = common.RedactSecrets(CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
 	ReportTimestamp: true,
 	TimeFormat:      time.Kitchen,
 	Prefix:          "SOAP Service 🧼",
-})
+}))
+
+// accessPolicy holds the role requirements shared with the REST and SFTP
+// services.
+var accessPolicy = &rbac.Policy{}
 
 var mockCustomers = []GlobalModels.Customer{
 	{ID: 1, Name: "Alice Smith", Cust_Type: "Regular", Email: "alicsmith@example.com"},
@@ -71,6 +82,9 @@ func parseSOAPRequest(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case bytes.Contains(envelope.Body.InnerXML, []byte("<Echo>")):
 		logger.Info("Recieved EchoRequest")
+		if !authorize(w, r, "Echo") {
+			return
+		}
 		var request SOAP.EchoRequest
 		if err := xml.Unmarshal(envelope.Body.InnerXML, &request); err != nil {
 			sendSOAPFault(w, "Client", "Bad EchoRequest", err)
@@ -93,6 +107,9 @@ func parseSOAPRequest(w http.ResponseWriter, r *http.Request) {
 
 	case bytes.Contains(envelope.Body.InnerXML, []byte("<GetCustomer>")):
 		logger.Info("Received GetCustomerRequest")
+		if !authorize(w, r, "GetCustomer") {
+			return
+		}
 		var request SOAP.GetCustomerRequest
 		if err := xml.Unmarshal(envelope.Body.InnerXML, &request); err != nil {
 			sendSOAPFault(w, "Client", "Bad GetCustomerRequest", err)
@@ -131,21 +148,153 @@ func parseSOAPRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func sendSOAPFault(w http.ResponseWriter, code, message string, err error) {
+	status := http.StatusInternalServerError
+	if code == "Client" {
+		status = http.StatusBadRequest
+	}
+	writeSOAPFault(w, status, code, message, err)
+}
+
+func writeSOAPFault(w http.ResponseWriter, status int, code, message string, err error) {
 	fault := builder.MakeFaultMessage(code, message)
 	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
 
-	if code == "Client" {
-		w.WriteHeader(http.StatusBadRequest)
+	logger.Error("Error parsing SOAP request", "message", message, "error", err)
+	w.Write([]byte(fault))
+}
+
+// authorize checks the caller against the access policy's requirement for
+// operation, answering with a Client fault when it is not met.
+func authorize(w http.ResponseWriter, r *http.Request, operation string) bool {
+	user, _ := common.UserFromContext(r.Context())
+	err := accessPolicy.Check(user, accessPolicy.SOAPOperation(operation))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, rbac.ErrUnauthenticated):
+		writeAuthFault(w, "Authentication required", err)
+	default:
+		writeSOAPFault(w, http.StatusForbidden, "Client", "Access denied", err)
+	}
+	return false
+}
+
+// writeAuthFault answers 401 with a Client fault and a challenge for each
+// scheme the service accepts.
+func writeAuthFault(w http.ResponseWriter, message string, err error) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="servr", charset="UTF-8"`)
+	w.Header().Add("WWW-Authenticate", `Bearer realm="servr"`)
+	writeSOAPFault(w, http.StatusUnauthorized, "Client", message, err)
+}
+
+// identifyClient attaches the user named by a verified client certificate,
+// or else by Basic or bearer credentials, to the request. Requests without
+// credentials carry on anonymously; those whose credentials fail, because
+// they are wrong, expired or revoked, get a 401 fault.
+func identifyClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := clientUser(r)
+		if err != nil {
+			writeAuthFault(w, "Authentication failed", err)
+			return
+		}
+		if user != nil {
+			r = r.WithContext(common.WithUser(r.Context(), user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientUser returns the user r's credentials authenticate, nil when it has
+// none, or why they failed.
+func clientUser(r *http.Request) (*common.User, error) {
+	var certErr error
+	if cert := certs.PeerCertificate(r.TLS); cert != nil {
+		user, err := common.UserFromCertificate(cert)
+		if err == nil {
+			common.Audit(common.AuthEvent{Scheme: "client-certificate", Username: user.Username, Success: true}, r.RemoteAddr)
+			return user, nil
+		}
+		logger.Warn("Client certificate rejected", "commonName", cert.Subject.CommonName, "error", err)
+		common.Audit(common.AuthEvent{Scheme: "client-certificate", Username: cert.Subject.CommonName, Reason: err.Error()}, r.RemoteAddr)
+		certErr = err
+	}
+
+	authz := r.Header.Get("Authorization")
+	if authz == "" {
+		return nil, certErr
+	}
+	var user *common.User
+	var err error
+	event := common.AuthEvent{Scheme: "bearer"}
+	if username, password, ok := r.BasicAuth(); ok {
+		event = common.AuthEvent{Scheme: "basic", Username: username}
+		user, err = common.ValidatePassword(username, password)
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+		user, err = common.ValidateAuth(strings.TrimPrefix(authz, "Bearer "))
+	}
+	if err != nil {
+		logger.Warn("Authentication failed", "error", err)
+		event.Reason = err.Error()
+		common.Audit(event, r.RemoteAddr)
+		return nil, err
 	}
+	event.Username, event.Success = user.Username, true
+	common.Audit(event, r.RemoteAddr)
+	return user, nil
+}
 
-	logger.Error("Error parsing SOAP request", "message", message, "error", err)
-	w.Write([]byte(fault))
+func serveTLS(settings certs.Settings, handler http.Handler) error {
+	if settings.Port == 0 {
+		settings.Port = consts.SOAP_HTTPS_PORT
+	}
+	tlsConfig, ca, err := certs.ServerConfig("soap", settings)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", settings.Port),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	logger.Info(fmt.Sprintf("Listening with TLS on port %d", settings.Port), "clientAuth", settings.ClientAuth, "generated", settings.Generated())
+	if ca != nil {
+		logger.Info("Clients can trust the local CA", "file", ca.Dir()+"/"+certs.CACertFile)
+	}
+	go func() {
+		logger.Fatal(server.ListenAndServeTLS("", ""))
+	}()
+	return nil
 }
 
 func main() {
-	handler := setupSOAPServer()
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("Failed to load config", "error", err)
+	}
+
+	if err := common.LoadUsers(); err != nil {
+		logger.Fatal("Failed to load users", "error", err)
+	}
+	if err := common.StartAudit("soap"); err != nil {
+		logger.Fatal("Failed to start auth audit", "error", err)
+	}
+	if accessPolicy, err = rbac.Load(); err != nil {
+		logger.Fatal("Failed to load RBAC policy", "error", err)
+	}
+	// tokens issued by the REST service's OAuth server verify here too
+	if _, err := oauth.Load(); err != nil {
+		logger.Fatal("Failed to load OAuth settings", "error", err)
+	}
+
+	handler := identifyClient(setupSOAPServer())
+	if cfg.TLS.Enabled {
+		if err := serveTLS(cfg.TLS, handler); err != nil {
+			logger.Fatal("Failed to set up TLS", "error", err)
+		}
+	}
 
 	logger.Info(fmt.Sprintf("Listening on port %d", consts.SOAP_PORT))
 	logger.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", consts.SOAP_PORT), handler))
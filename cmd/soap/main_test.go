@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mock-server/internal/common"
+	"mock-server/internal/rbac"
+)
+
+func clientCert(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestIdentifyClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		authz      string
+		basic      []string
+		tls        *tls.ConnectionState
+		wantStatus int
+		wantUser   string
+	}{
+		{name: "anonymous", wantStatus: http.StatusOK},
+		{name: "basic", basic: []string{"testuser", "testpass"}, wantStatus: http.StatusOK, wantUser: "testuser"},
+		{name: "wrong password", basic: []string{"testuser", "guess"}, wantStatus: http.StatusUnauthorized},
+		{name: "unknown user", basic: []string{"nobody", "testpass"}, wantStatus: http.StatusUnauthorized},
+		{name: "bearer", authz: "Bearer valid-token", wantStatus: http.StatusOK, wantUser: "testuser"},
+		{name: "bare token", authz: "valid-token", wantStatus: http.StatusOK, wantUser: "testuser"},
+		{name: "bogus bearer", authz: "Bearer bogus", wantStatus: http.StatusUnauthorized},
+		{name: "client certificate", tls: clientCert("testuser"), wantStatus: http.StatusOK, wantUser: "testuser"},
+		{name: "unknown client certificate", tls: clientCert("nobody"), wantStatus: http.StatusUnauthorized},
+		{name: "unknown certificate with a good password", tls: clientCert("nobody"), basic: []string{"testuser", "testpass"}, wantStatus: http.StatusOK, wantUser: "testuser"},
+		{name: "certificate wins over a bad password", tls: clientCert("testuser"), basic: []string{"testuser", "guess"}, wantStatus: http.StatusOK, wantUser: "testuser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser *common.User
+			handler := identifyClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUser, _ = common.UserFromContext(r.Context())
+			}))
+			r := httptest.NewRequest("POST", "/soap", nil)
+			r.TLS = tt.tls
+			if tt.authz != "" {
+				r.Header.Set("Authorization", tt.authz)
+			}
+			if tt.basic != nil {
+				r.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized {
+				if len(w.Header().Values("WWW-Authenticate")) != 2 || !strings.Contains(w.Body.String(), "Client") {
+					t.Errorf("401 without challenges or a Client fault: %v %s", w.Header(), w.Body)
+				}
+				return
+			}
+			if name := usernameOf(gotUser); name != tt.wantUser {
+				t.Errorf("user = %q, want %q", name, tt.wantUser)
+			}
+		})
+	}
+}
+
+func usernameOf(u *common.User) string {
+	if u == nil {
+		return ""
+	}
+	return u.Username
+}
+
+func TestAuthorize(t *testing.T) {
+	defer func(p *rbac.Policy) { accessPolicy = p }(accessPolicy)
+	accessPolicy = &rbac.Policy{
+		Roles: map[string][]string{"admin": {rbac.AllPermissions}},
+		SOAP: map[string]*rbac.Requirement{
+			"UpdateCustomer": {Roles: []string{"admin"}},
+			"DeleteCustomer": {Roles: []string{"auditor"}},
+		},
+	}
+	testuser := &common.User{Username: "testuser", Roles: []string{"admin", "user"}}
+
+	tests := []struct {
+		name       string
+		user       *common.User
+		operation  string
+		wantStatus int
+	}{
+		{"open operation", nil, "GetCustomer", http.StatusOK},
+		{"anonymous", nil, "UpdateCustomer", http.StatusUnauthorized},
+		{"role held", testuser, "UpdateCustomer", http.StatusOK},
+		{"role missing", testuser, "DeleteCustomer", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/soap", nil)
+			if tt.user != nil {
+				r = r.WithContext(common.WithUser(r.Context(), tt.user))
+			}
+			w := httptest.NewRecorder()
+			if ok := authorize(w, r, tt.operation); ok != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("authorize = %v, want status %d", ok, tt.wantStatus)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
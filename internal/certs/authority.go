@@ -0,0 +1,263 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CAFile holds the local CA's certificate and private key.
+	CAFile = "ca.pem"
+	// CACertFile holds only the CA certificate, for clients to trust.
+	CACertFile = "ca.crt"
+
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 365 * 24 * time.Hour
+)
+
+// Authority is a local certificate authority shared by the services through
+// a directory on disk.
+type Authority struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+
+	key crypto.Signer
+	dir string
+}
+
+// LoadOrCreateCA loads the CA kept in dir, generating one the first time.
+// Services starting together race to create it; the loser loads the winner's.
+func LoadOrCreateCA(dir string) (*Authority, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, CAFile)
+
+	ca, err := loadCA(path)
+	if err == nil {
+		ca.dir = dir
+		certPath := filepath.Join(dir, CACertFile)
+		if _, err := os.Stat(certPath); os.IsNotExist(err) {
+			if err := os.WriteFile(certPath, ca.CertPEM, 0o644); err != nil {
+				return nil, err
+			}
+		}
+		return ca, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial(),
+		Subject:               pkix.Name{CommonName: "Servr Local CA", Organization: []string{"Servr"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// link a complete temporary file into place so a concurrent reader never
+	// sees a half-written CA, and an existing CA is never overwritten
+	tmp, err := os.CreateTemp(dir, ".ca-*.pem")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(certPEM, keyPEM...)); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return LoadOrCreateCA(dir)
+		}
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, CACertFile), certPEM, 0o644); err != nil {
+		return nil, err
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &Authority{Cert: cert, CertPEM: certPEM, key: key, dir: dir}, nil
+}
+
+func loadCA(path string) (*Authority, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ca := &Authority{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if ca.Cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			ca.CertPEM = pem.EncodeToMemory(block)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("%s: unsupported key type", path)
+			}
+			ca.key = signer
+		}
+	}
+	if ca.Cert == nil || ca.key == nil {
+		return nil, fmt.Errorf("%s: expected a certificate and a private key", path)
+	}
+	return ca, nil
+}
+
+// Dir is the directory the CA is kept in.
+func (ca *Authority) Dir() string {
+	return ca.dir
+}
+
+// Pool is a certificate pool trusting only this CA.
+func (ca *Authority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// ServerCertificate issues a leaf certificate for hosts (DNS names or IPs)
+// and writes it to <dir>/<name>.crt and <name>.key so it can be inspected or
+// reused by other tools.
+func (ca *Authority) ServerCertificate(name string, hosts []string) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: serial(),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Servr"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	certPEM, keyPEM, err := ca.issue(template)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(filepath.Join(ca.dir, name+".crt"), certPEM, 0o644); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(filepath.Join(ca.dir, name+".key"), keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(append(certPEM, ca.CertPEM...), keyPEM)
+}
+
+// ClientRequest describes a client certificate. CommonName is the username
+// mTLS authenticates; OrganizationalUnits are only informational, since the
+// services take roles from the user store.
+type ClientRequest struct {
+	CommonName          string   `json:"commonName"`
+	Email               string   `json:"email,omitempty"`
+	OrganizationalUnits []string `json:"roles,omitempty"`
+	ValidDays           int      `json:"validDays,omitempty"`
+}
+
+// ClientCertificate issues a client certificate and returns it and its key
+// as PEM.
+func (ca *Authority) ClientCertificate(req ClientRequest) ([]byte, []byte, error) {
+	if req.CommonName == "" {
+		return nil, nil, fmt.Errorf("a client certificate needs a commonName")
+	}
+	days := req.ValidDays
+	if days <= 0 {
+		days = 365
+	}
+	if maxDays := int(caValidity / (24 * time.Hour)); days > maxDays {
+		return nil, nil, fmt.Errorf("validDays must be at most %d, the CA's own lifetime", maxDays)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial(),
+		Subject: pkix.Name{
+			CommonName:         req.CommonName,
+			Organization:       []string{"Servr"},
+			OrganizationalUnit: req.OrganizationalUnits,
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Duration(days) * 24 * time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if req.Email != "" {
+		template.EmailAddresses = []string{req.Email}
+	}
+	return ca.issue(template)
+}
+
+func (ca *Authority) issue(template *x509.Certificate) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func serial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
@@ -0,0 +1,133 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Settings configures a service's HTTPS listener. Without CertFile and
+// KeyFile the service's certificate is issued by the local CA in CADir.
+type Settings struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Port     int    `yaml:"port" json:"port"`
+	CertFile string `yaml:"cert_file" json:"certFile,omitempty"`
+	KeyFile  string `yaml:"key_file" json:"keyFile,omitempty"`
+	// CADir holds the generated local CA, shared by every service.
+	CADir string `yaml:"ca_dir" json:"caDir"`
+	// Hosts are extra names and IPs for a generated certificate, on top of
+	// localhost, 127.0.0.1 and ::1.
+	Hosts []string `yaml:"hosts" json:"hosts,omitempty"`
+
+	// ClientAuth is none, optional (verify a certificate if one is sent) or
+	// require (mutual TLS).
+	ClientAuth string `yaml:"client_auth" json:"clientAuth"`
+	// ClientCAFile adds trusted client CAs to the local one.
+	ClientCAFile string `yaml:"client_ca_file" json:"clientCaFile,omitempty"`
+}
+
+// Validate checks the settings and fills in defaults.
+func (s *Settings) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if s.CADir == "" {
+		s.CADir = "certs"
+	}
+	switch s.ClientAuth {
+	case "":
+		s.ClientAuth = ClientAuthNone
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+	default:
+		return fmt.Errorf("unknown client_auth %q (want none, optional or require)", s.ClientAuth)
+	}
+	return nil
+}
+
+// Resolve makes the settings' relative paths, including the default CA
+// directory, relative to base.
+func (s *Settings) Resolve(base string) {
+	if s.CADir == "" {
+		s.CADir = "certs"
+	}
+	for _, p := range []*string{&s.CertFile, &s.KeyFile, &s.CADir, &s.ClientCAFile} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(base, *p)
+		}
+	}
+}
+
+// Generated reports whether the server certificate comes from the local CA.
+func (s *Settings) Generated() bool {
+	return s.CertFile == ""
+}
+
+// ServerConfig builds the TLS configuration for the service called name. The
+// local CA is returned too; it is nil when every certificate is provided and
+// client certificates are not checked.
+func ServerConfig(name string, s Settings) (*tls.Config, *Authority, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	var ca *Authority
+	if s.Generated() || s.ClientAuth != ClientAuthNone {
+		var err error
+		if ca, err = LoadOrCreateCA(s.CADir); err != nil {
+			return nil, nil, fmt.Errorf("local CA: %w", err)
+		}
+	}
+
+	if s.Generated() {
+		hosts := append([]string{"localhost", "127.0.0.1", "::1"}, s.Hosts...)
+		cert, err := ca.ServerCertificate(name, hosts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("issue certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.ClientAuth == ClientAuthNone {
+		return cfg, ca, nil
+	}
+
+	cfg.ClientCAs = ca.Pool()
+	if s.ClientCAFile != "" {
+		data, err := os.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("client CA: %w", err)
+		}
+		if !cfg.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("client CA: no certificates in %s", s.ClientCAFile)
+		}
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if s.ClientAuth == ClientAuthRequire {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, ca, nil
+}
+
+// PeerCertificate returns the verified client certificate of a connection,
+// or nil when the client did not present one.
+func PeerCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
@@ -0,0 +1,168 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuthEvent records one authentication attempt.
+type AuthEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Service is rest, soap or sftp.
+	Service string `json:"service"`
+	// Scheme is how the caller authenticated: a REST scheme such as basic or
+	// bearer, client-certificate, oauth:<grant type> or oauth:login at the
+	// OAuth endpoints, or password, token or publickey over SFTP.
+	Scheme   string `json:"scheme"`
+	Username string `json:"username,omitempty"`
+	SourceIP string `json:"sourceIp,omitempty"`
+	Success  bool   `json:"success"`
+	// Reason is why a failed attempt was rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditFilter selects audit events; empty fields match everything.
+type AuditFilter struct {
+	Service  string
+	Scheme   string
+	Username string
+	// Success, when set, keeps only successes or only failures.
+	Success *bool
+	Since   time.Time
+	// Limit keeps only the most recent events.
+	Limit int
+}
+
+func (f *AuditFilter) match(e *AuthEvent) bool {
+	return (f.Service == "" || e.Service == f.Service) &&
+		(f.Scheme == "" || e.Scheme == f.Scheme) &&
+		(f.Username == "" || e.Username == f.Username) &&
+		(f.Success == nil || e.Success == *f.Success) &&
+		!e.Timestamp.Before(f.Since)
+}
+
+// auditLimit bounds the events kept in memory when there is no audit file.
+const auditLimit = 1000
+
+// auditTrail keeps this service's events in memory and, when AUTH_AUDIT_LOG
+// names a file, appends every service's events to it as JSON lines.
+type auditTrail struct {
+	mu      sync.Mutex
+	service string
+	file    string
+	events  []AuthEvent
+}
+
+var audit = &auditTrail{}
+
+// StartAudit names the service recording authentication attempts and opens
+// the audit file named by AUTH_AUDIT_LOG, which the services share so that
+// the trail can be queried in one place. Without it, events are kept in
+// memory by each service.
+func StartAudit(service string) error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	audit.service = service
+	audit.file = os.Getenv("AUTH_AUDIT_LOG")
+	if audit.file == "" {
+		return nil
+	}
+	f, err := os.OpenFile(audit.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open auth audit log: %w", err)
+	}
+	logger.Info("Recording auth audit trail", "file", audit.file)
+	return f.Close()
+}
+
+// Audit records an authentication attempt from remoteAddr, a host:port or
+// bare IP. It fills in the time and service.
+func Audit(e AuthEvent, remoteAddr string) {
+	e.Timestamp = time.Now().UTC()
+	e.SourceIP = remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		e.SourceIP = host
+	}
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if e.Service == "" {
+		e.Service = audit.service
+	}
+	if audit.file == "" {
+		audit.events = append(audit.events, e)
+		if len(audit.events) > auditLimit {
+			audit.events = audit.events[len(audit.events)-auditLimit:]
+		}
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(audit.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.Error("Could not write auth audit log", "file", audit.file, "error", err)
+		return
+	}
+	defer f.Close()
+	// One write per line, so services appending at once do not interleave.
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logger.Error("Could not write auth audit log", "file", audit.file, "error", err)
+	}
+}
+
+// AuditEvents returns the recorded events that match filter, oldest first:
+// every service's when they share an audit file, otherwise this service's.
+func AuditEvents(filter AuditFilter) ([]AuthEvent, error) {
+	audit.mu.Lock()
+	events, file := append([]AuthEvent(nil), audit.events...), audit.file
+	audit.mu.Unlock()
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read auth audit log: %w", err)
+		}
+		events = nil
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var e AuthEvent
+			if json.Unmarshal(scanner.Bytes(), &e) == nil {
+				events = append(events, e)
+			}
+		}
+	}
+
+	out := []AuthEvent{}
+	for i := range events {
+		if filter.match(&events[i]) {
+			out = append(out, events[i])
+		}
+	}
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[len(out)-filter.Limit:]
+	}
+	return out, nil
+}
+
+// ClearAudit forgets every recorded event, including other services' when
+// they share the audit file.
+func ClearAudit() error {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	audit.events = nil
+	if audit.file == "" {
+		return nil
+	}
+	if err := os.Truncate(audit.file, 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("clear auth audit log: %w", err)
+	}
+	return nil
+}
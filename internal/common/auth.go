@@ -1,10 +1,17 @@
 package common
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
 	"fmt"
 	"os"
+	"slices"
 	"time"
 
+	"mock-server/internal/oauth"
+
 	CharmLog "github.com/charmbracelet/log"
 )
 
@@ -12,24 +19,231 @@ type User struct {
 	Username string   `json:"username"`
 	Email    string   `json:"email"`
 	Roles    []string `json:"roles"`
+	// Scopes are those granted to the OAuth token the user authenticated with.
+	Scopes []string `json:"scopes,omitempty" yaml:"-"`
+	// TokenID identifies the token the user authenticated with, if any, on
+	// the revocation list, so long-lived sessions can check it is still good.
+	TokenID string `json:"-" yaml:"-"`
 }
 
-var logger = CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
+var logger = RedactSecrets(CharmLog.NewWithOptions(os.Stderr, CharmLog.Options{
 	ReportTimestamp: true,
 	TimeFormat:      time.Kitchen,
 	Prefix:          "Auth Service 🔐",
-})
+}))
 
+// ValidateAuth returns the user an API token, or a JWT issued by the OAuth
+// server, belongs to. Revoked tokens are refused only when OAuth is
+// configured, since the revocation list lives in its keys directory.
 func ValidateAuth(token string) (*User, error) {
-	logger.Info("Validating auth token", "token", token)
+	id := oauth.TokenID(token)
+	logger.Info("Validating auth token", "tokenId", id)
+
+	if p := oauth.Current(); p != nil && oauth.IsJWT(token) {
+		claims, err := p.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+		user, err := userFromClaims(claims)
+		if err != nil {
+			return nil, err
+		}
+		user.TokenID = id
+		return user, nil
+	}
+	if oauth.Current().Revoked(id) {
+		return nil, oauth.ErrRevoked
+	}
+
+	var expired bool
+	c := users.find(func(c *Credentials) bool {
+		for _, t := range c.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+				expired = t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+				return true
+			}
+		}
+		return false
+	})
+	if c == nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if expired {
+		return nil, ErrTokenExpired
+	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	user := c.user()
+	user.TokenID = id
+	return user, nil
+}
+
+// userFromClaims is the user a verified token was issued to. Tokens of
+// users in the store stop working when the user is locked or expires.
+func userFromClaims(claims oauth.Claims) (*User, error) {
+	user := &User{
+		Username: claims.String("preferred_username"),
+		Email:    claims.String("email"),
+		Roles:    claims.Strings("roles"),
+		Scopes:   claims.Scopes(),
+	}
+	if user.Username == "" {
+		user.Username = claims.String("sub")
+	}
+	if c := users.find(func(c *Credentials) bool { return c.Username == user.Username }); c != nil {
+		if err := c.status(); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// ValidatePassword checks a username and password, as sent with HTTP Basic.
+func ValidatePassword(username, password string) (*User, error) {
+	logger.Info("Validating password", "username", username)
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil || !c.checkPassword(password) {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	return c.user(), nil
+}
+
+// LookupPassword returns a user's password for schemes such as HTTP Digest
+// that prove knowledge of it without sending it. Users with only a password
+// hash, and those who may not authenticate, are not found.
+func LookupPassword(username string) (string, *User, bool) {
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil || c.Password == "" || c.PasswordHash != "" || c.status() != nil {
+		return "", nil, false
+	}
+	return c.Password, c.user(), true
+}
+
+// LookupUser returns the known user called username.
+func LookupUser(username string) (*User, bool) {
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil {
+		return nil, false
+	}
+	return c.user(), true
+}
+
+// UserAccount is a known user and, when they may not authenticate, why not.
+type UserAccount struct {
+	User   *User
+	Status error
+}
+
+// ListUsers returns every known user.
+func ListUsers() []UserAccount {
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	out := make([]UserAccount, 0, len(users.creds))
+	for i := range users.creds {
+		c := &users.creds[i]
+		out = append(out, UserAccount{User: c.user(), Status: c.status()})
+	}
+	return out
+}
 
-	if token == "valid-token" || token == "testpass" {
-		return &User{
-			Username: "testuser",
-			Email:    "test@example.com",
-			Roles:    []string{"admin", "user"},
-		}, nil
+// SelectUser returns a known user who may authenticate, without checking
+// any credentials. Mock login pages use it to sign in whoever is picked.
+func SelectUser(username string) (*User, error) {
+	logger.Info("Selecting user", "username", username)
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil {
+		return nil, fmt.Errorf("unknown user %q", username)
 	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	return c.user(), nil
+}
+
+// ValidateAPIKey returns the user an API key belongs to.
+func ValidateAPIKey(key string) (*User, error) {
+	logger.Info("Validating API key")
+	c := users.find(func(c *Credentials) bool {
+		for _, k := range c.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return true
+			}
+		}
+		return false
+	})
+	if c == nil {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	return c.user(), nil
+}
+
+// LookupAccessKey returns the secret of a request-signing key ID and the
+// user it belongs to.
+func LookupAccessKey(id string) (string, *User, bool) {
+	var secret string
+	c := users.find(func(c *Credentials) bool {
+		var ok bool
+		secret, ok = c.AccessKeys[id]
+		return ok
+	})
+	if c == nil || c.status() != nil {
+		return "", nil, false
+	}
+	return secret, c.user(), true
+}
+
+// ValidateSSHKey checks that key, in SSH wire format, is one of username's
+// public keys.
+func ValidateSSHKey(username string, key []byte) (*User, error) {
+	logger.Info("Validating SSH key", "username", username)
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil || !slices.ContainsFunc(c.sshKeys, func(k []byte) bool { return bytes.Equal(k, key) }) {
+		return nil, fmt.Errorf("unknown public key")
+	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	return c.user(), nil
+}
+
+// UserFromCertificate maps a verified client certificate to a user: the
+// subject's common name must be a known user who may authenticate, and the
+// user's roles come from the user store rather than from the certificate,
+// whose organizational units anyone can ask the local CA for. The first
+// email SAN stands in for a missing email.
+func UserFromCertificate(cert *x509.Certificate) (*User, error) {
+	username := cert.Subject.CommonName
+	c := users.find(func(c *Credentials) bool { return c.Username == username })
+	if c == nil {
+		return nil, fmt.Errorf("unknown user %q", username)
+	}
+	if err := c.status(); err != nil {
+		return nil, err
+	}
+	user := c.user()
+	if user.Email == "" && len(cert.EmailAddresses) > 0 {
+		user.Email = cert.EmailAddresses[0]
+	}
+	logger.Info("Authenticated client certificate", "username", user.Username, "roles", user.Roles, "issuer", cert.Issuer.CommonName)
+	return user, nil
+}
+
+type userKey struct{}
+
+// WithUser attaches the authenticated user to a request context.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
 
-	return nil, fmt.Errorf("invalid token")
+// UserFromContext returns the user attached by WithUser.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey{}).(*User)
+	return user, ok && user != nil
 }
@@ -1,10 +1,12 @@
 package models
 
+// Customer is shared by the REST and SOAP services. It has no xml tags so
+// both services' XML uses the same element names.
 type Customer struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name,omitempty"`
-	Cust_Type string `json:"type"`
-	Email     string `json:"email,omitempty"`
+	ID        int    `json:"id" yaml:"id"`
+	Name      string `json:"name,omitempty" yaml:"name,omitempty"`
+	Cust_Type string `json:"type" yaml:"type"`
+	Email     string `json:"email,omitempty" yaml:"email,omitempty"`
 }
 
 var mockCustomers = []Customer{
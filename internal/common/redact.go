@@ -0,0 +1,99 @@
+package common
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	CharmLog "github.com/charmbracelet/log"
+)
+
+// Redacted replaces secrets in logs.
+const Redacted = "[REDACTED]"
+
+// secretKeys are log keys whose values are always masked.
+var secretKeys = []string{
+	"token", "access_token", "refresh_token", "id_token", "accessToken", "refreshToken",
+	"password", "secret", "client_secret", "clientSecret", "secretKey",
+	"authorization", "Authorization", "apiKey", "api_key", "cookie", "Cookie",
+}
+
+// secretHeaders are request and response headers that carry credentials.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// secretPatterns find credentials anywhere in a log line: Authorization
+// header values, JWTs and secrets in query strings or form bodies.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(Bearer|Basic) +[\w.~+/-]+=*`),
+	regexp.MustCompile(`\beyJ[\w-]*\.[\w-]+\.[\w-]*`),
+	regexp.MustCompile(`(?i)\b((?:access_|refresh_|id_)?token|password|client_secret|api_key|code_verifier)=[^\s&"]+`),
+}
+
+// Redact masks the credentials secretPatterns find in s.
+func Redact(s string) string {
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			if i := strings.IndexAny(m, " \t="); i >= 0 {
+				return m[:i+1] + Redacted
+			}
+			return Redacted
+		})
+	}
+	return s
+}
+
+// LogSecrets reports whether LOG_SECRETS=true asks for secrets to be kept
+// in logs and captured requests.
+func LogSecrets() bool {
+	return os.Getenv("LOG_SECRETS") == "true"
+}
+
+// RedactHeaders returns a copy of h with the values of secretHeaders masked.
+func RedactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for name, values := range out {
+		if slices.Contains(secretHeaders, http.CanonicalHeaderKey(name)) {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return out
+}
+
+// RedactQuery returns a copy of q with the values of secretKeys masked.
+func RedactQuery(q url.Values) url.Values {
+	out := make(url.Values, len(q))
+	for name, values := range q {
+		values = slices.Clone(values)
+		if slices.Contains(secretKeys, name) {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+		out[name] = values
+	}
+	return out
+}
+
+// RedactSecrets makes logger mask secrets, unless LOG_SECRETS is true: the
+// values of secretKeys entirely, and credentials found in messages and any
+// other value. It returns logger.
+func RedactSecrets(logger *CharmLog.Logger) *CharmLog.Logger {
+	if LogSecrets() {
+		return logger
+	}
+	styles := CharmLog.DefaultStyles()
+	styles.Message = styles.Message.Transform(Redact)
+	styles.Value = styles.Value.Transform(Redact)
+	mask := lipgloss.NewStyle().Transform(func(string) string { return Redacted })
+	for _, key := range secretKeys {
+		styles.Values[key] = mask
+	}
+	logger.SetStyles(styles)
+	return logger
+}
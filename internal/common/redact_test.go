@@ -0,0 +1,89 @@
+package common
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	CharmLog "github.com/charmbracelet/log"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Authorization: Bearer abc.def-123", "Authorization: Bearer [REDACTED]"},
+		{"Basic dGVzdHVzZXI6dGVzdHBhc3M= sent", "Basic [REDACTED] sent"},
+		{"token eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln here", "token [REDACTED] here"},
+		{"GET /customers?token=valid-token&page=2", "GET /customers?token=[REDACTED]&page=2"},
+		{"grant_type=password&username=u&password=p4ss&client_secret=s3", "grant_type=password&username=u&password=[REDACTED]&client_secret=[REDACTED]"},
+		{`{"url":"/x?ACCESS_TOKEN=abc"}`, `{"url":"/x?ACCESS_TOKEN=[REDACTED]"}`},
+		{"code_verifier=xyz api_key=k1", "code_verifier=[REDACTED] api_key=[REDACTED]"},
+		{"nothing secret, page=2", "nothing secret, page=2"},
+		{"my_token=abc", "my_token=abc"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{
+		"Authorization": {"Bearer abc"},
+		"X-Api-Key":     {"k1", "k2"},
+		"Set-Cookie":    {"session=1"},
+		"Content-Type":  {"application/json"},
+	}
+	got := RedactHeaders(h)
+	for _, name := range []string{"Authorization", "X-Api-Key", "Set-Cookie"} {
+		for _, v := range got.Values(name) {
+			if v != Redacted {
+				t.Errorf("%s = %q, want it redacted", name, v)
+			}
+		}
+	}
+	if got.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want it kept", got.Get("Content-Type"))
+	}
+	if h.Get("Authorization") != "Bearer abc" {
+		t.Error("RedactHeaders changed the original headers")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	q := url.Values{"token": {"t1"}, "api_key": {"k1"}, "page": {"2"}}
+	got := RedactQuery(q)
+	if got.Get("token") != Redacted || got.Get("api_key") != Redacted || got.Get("page") != "2" {
+		t.Errorf("RedactQuery = %v", got)
+	}
+	if q.Get("token") != "t1" {
+		t.Error("RedactQuery changed the original query")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		logSecrets string
+		wantSecret bool
+	}{
+		{"", false},
+		{"true", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOG_SECRETS", tt.logSecrets)
+		var buf bytes.Buffer
+		logger := RedactSecrets(CharmLog.New(&buf))
+		logger.Info("Request with Bearer s3cret-bearer", "password", "s3cret-password", "url", "/x?token=s3cret-token")
+
+		out := buf.String()
+		for _, secret := range []string{"s3cret-bearer", "s3cret-password", "s3cret-token"} {
+			if strings.Contains(out, secret) != tt.wantSecret {
+				t.Errorf("LOG_SECRETS=%q: %s logged in %q: %v, want %v", tt.logSecrets, secret, out, !tt.wantSecret, tt.wantSecret)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package common
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// UsersReloadInterval is how often the users file is checked for changes.
+const UsersReloadInterval = 2 * time.Second
+
+var (
+	// ErrAccountLocked means the user exists but may not sign in.
+	ErrAccountLocked = errors.New("account locked")
+	// ErrAccountExpired means the user's account has passed its expiry.
+	ErrAccountExpired = errors.New("account expired")
+	// ErrTokenExpired means a known API token has passed its expiry.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Credentials are a user and everything they can authenticate with.
+type Credentials struct {
+	User `yaml:",inline"`
+	// Password is kept in plain text, which HTTP Digest needs.
+	// PasswordHash is a bcrypt ($2a$, $2b$, $2y$) or argon2 ($argon2id$,
+	// $argon2i$) hash and is checked instead when set.
+	Password     string `yaml:"password"`
+	PasswordHash string `yaml:"password_hash"`
+	// Locked and ExpiresAt stop the user authenticating at all.
+	Locked    bool       `yaml:"locked"`
+	ExpiresAt *time.Time `yaml:"expires_at"`
+	// Tokens are accepted as bearer tokens and as SFTP passwords.
+	Tokens  []APIToken `yaml:"tokens"`
+	APIKeys []string   `yaml:"api_keys"`
+	// AccessKeys maps request-signing key IDs to their secret keys.
+	AccessKeys map[string]string `yaml:"access_keys"`
+	// SSHKeys are public keys in authorized_keys format.
+	SSHKeys []string `yaml:"ssh_keys"`
+
+	sshKeys [][]byte
+}
+
+// APIToken is a bearer token, valid until ExpiresAt when that is set.
+type APIToken struct {
+	Token     string     `yaml:"token"`
+	ExpiresAt *time.Time `yaml:"expires_at"`
+}
+
+func (c *Credentials) user() *User {
+	u := c.User
+	u.Roles = append([]string(nil), c.User.Roles...)
+	return &u
+}
+
+// status reports whether the user may authenticate at all.
+func (c *Credentials) status() error {
+	if c.Locked {
+		return ErrAccountLocked
+	}
+	if c.ExpiresAt != nil && time.Now().After(*c.ExpiresAt) {
+		return ErrAccountExpired
+	}
+	return nil
+}
+
+func (c *Credentials) validate() error {
+	if c.Username == "" {
+		return fmt.Errorf("missing username")
+	}
+	if c.PasswordHash != "" {
+		if _, err := checkPasswordHash(c.PasswordHash, ""); err != nil {
+			return fmt.Errorf("%s: password_hash: %w", c.Username, err)
+		}
+	}
+	for i, t := range c.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("%s: tokens[%d]: missing token", c.Username, i)
+		}
+	}
+	c.sshKeys = nil
+	for i, line := range c.SSHKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return fmt.Errorf("%s: ssh_keys[%d]: %w", c.Username, i, err)
+		}
+		c.sshKeys = append(c.sshKeys, key.Marshal())
+	}
+	return nil
+}
+
+// checkPassword compares password against the hash when there is one and
+// the plain-text password otherwise.
+func (c *Credentials) checkPassword(password string) bool {
+	if c.PasswordHash != "" {
+		ok, _ := checkPasswordHash(c.PasswordHash, password)
+		return ok
+	}
+	return c.Password != "" && subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1
+}
+
+// The argon2 parameters a hash may ask for are bounded, so a users file
+// cannot make every check allocate gigabytes or run for seconds: memory in
+// KiB, iterations and threads.
+const (
+	maxArgon2Memory     = 1 << 20
+	maxArgon2Iterations = 16
+	maxArgon2Threads    = 16
+)
+
+// checkPasswordHash verifies password against a bcrypt or PHC-formatted
+// argon2 hash, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>. It fails
+// with an error only when the hash itself is malformed.
+func checkPasswordHash(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$") {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return false, err
+		}
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return false, fmt.Errorf("unsupported hash (want bcrypt or argon2)")
+	}
+	var version int
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("malformed argon2 parameters %q", parts[3])
+	}
+	// argon2 panics on zero iterations, threads or key length
+	if memory < 1 || memory > maxArgon2Memory || iterations < 1 || iterations > maxArgon2Iterations || threads < 1 || threads > maxArgon2Threads {
+		return false, fmt.Errorf("argon2 parameters %q out of range (want m from 1 to %d KiB, t from 1 to %d and p from 1 to %d)",
+			parts[3], maxArgon2Memory, maxArgon2Iterations, maxArgon2Threads)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return false, fmt.Errorf("malformed or empty argon2 salt")
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, fmt.Errorf("malformed or empty argon2 hash")
+	}
+
+	derive := argon2.IDKey
+	if parts[1] == "argon2i" {
+		derive = argon2.Key
+	}
+	got := derive([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// defaultCredentials are used when no users file is configured.
+func defaultCredentials() []Credentials {
+	return []Credentials{{
+		User: User{
+			Username: "testuser",
+			Email:    "test@example.com",
+			Roles:    []string{"admin", "user"},
+		},
+		Password:   "testpass",
+		Tokens:     []APIToken{{Token: "valid-token"}, {Token: "testpass"}},
+		APIKeys:    []string{"test-api-key"},
+		AccessKeys: map[string]string{"AKIDTESTUSER": "test-secret-key"},
+	}}
+}
+
+type userStore struct {
+	mu    sync.RWMutex
+	creds []Credentials
+}
+
+var users = &userStore{creds: defaultCredentials()}
+
+// find returns the first credentials matching, or nil.
+func (s *userStore) find(match func(*Credentials) bool) *Credentials {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.creds {
+		if c := &s.creds[i]; match(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *userStore) replace(creds []Credentials) {
+	s.mu.Lock()
+	s.creds = creds
+	s.mu.Unlock()
+}
+
+// LoadUsers reads users from the YAML file named by USERS_FILE and reloads
+// it whenever it changes. Without USERS_FILE the built-in test user is used.
+func LoadUsers() error {
+	file := os.Getenv("USERS_FILE")
+	if file == "" {
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("read users: %w", err)
+	}
+	creds, err := readUsers(file)
+	if err != nil {
+		return err
+	}
+	users.replace(creds)
+	logger.Info("Loaded users", "file", file, "count", len(creds))
+
+	go watchUsers(file, info.ModTime())
+	return nil
+}
+
+func readUsers(file string) ([]Credentials, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read users: %w", err)
+	}
+	var doc struct {
+		Users []Credentials `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse users %s: %w", file, err)
+	}
+
+	seen := map[string]bool{}
+	for i := range doc.Users {
+		c := &doc.Users[i]
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("users %s: [%d]: %w", file, i, err)
+		}
+		if seen[c.Username] {
+			return nil, fmt.Errorf("users %s: duplicate username %q", file, c.Username)
+		}
+		seen[c.Username] = true
+	}
+	return doc.Users, nil
+}
+
+// watchUsers reloads the users file when its modification time changes. A
+// file that fails to load leaves the previous users in place.
+func watchUsers(file string, modTime time.Time) {
+	for range time.Tick(UsersReloadInterval) {
+		info, err := os.Stat(file)
+		if err != nil || info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		creds, err := readUsers(file)
+		if err != nil {
+			logger.Error("Failed to reload users, keeping the previous ones", "error", err)
+			continue
+		}
+		users.replace(creds)
+		logger.Info("Reloaded users", "file", file, "count", len(creds))
+	}
+}
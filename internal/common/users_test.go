@@ -0,0 +1,62 @@
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func argon2Hash(variant string, m, t uint32, p uint8, password string) string {
+	salt := []byte("0123456789abcdef")
+	derive := argon2.IDKey
+	if variant == "argon2i" {
+		derive = argon2.Key
+	}
+	key := derive([]byte(password), salt, t, m, p, 32)
+	b64 := base64.RawStdEncoding.EncodeToString
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", variant, argon2.Version, m, t, p, b64(salt), b64(key))
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := base64.RawStdEncoding.EncodeToString([]byte("salt"))
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"bcrypt", string(bcryptHash), "s3cret", true, false},
+		{"bcrypt wrong password", string(bcryptHash), "guess", false, false},
+		{"argon2id", argon2Hash("argon2id", 64, 1, 1, "s3cret"), "s3cret", true, false},
+		{"argon2i", argon2Hash("argon2i", 64, 2, 2, "s3cret"), "s3cret", true, false},
+		{"argon2id wrong password", argon2Hash("argon2id", 64, 1, 1, "s3cret"), "guess", false, false},
+		{"plain text", "s3cret", "s3cret", false, true},
+		{"malformed bcrypt", "$2b$10$short", "s3cret", false, true},
+		{"other argon2 version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + salt, "", false, true},
+		{"malformed parameters", "$argon2id$v=19$m=64,t=1$" + salt + "$" + salt, "", false, true},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + salt, "", false, true},
+		{"zero threads", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + salt, "", false, true},
+		{"too much memory", "$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + salt, "", false, true},
+		{"too many iterations", "$argon2id$v=19$m=64,t=4294967295,p=1$" + salt + "$" + salt, "", false, true},
+		{"too many threads", "$argon2id$v=19$m=64,t=1,p=255$" + salt + "$" + salt, "", false, true},
+		{"empty salt", "$argon2id$v=19$m=64,t=1,p=1$$" + salt, "", false, true},
+		{"empty hash", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkPasswordHash(tt.hash, tt.password)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("checkPasswordHash = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,4 +3,8 @@ package consts
 const (
 	HTTP_PORT = 8080
 	SOAP_PORT = 8081
+
+	// HTTPS listeners, used when TLS is enabled
+	HTTPS_PORT      = 8443
+	SOAP_HTTPS_PORT = 8444
 )
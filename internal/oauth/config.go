@@ -0,0 +1,228 @@
+// Package oauth holds what the services share about OAuth 2.0: the
+// authorization server's settings, its signing keys and the JWTs it issues.
+// The REST service issues tokens; every service verifies them.
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Grant types.
+const (
+	ClientCredentials = "client_credentials"
+	Password          = "password"
+	RefreshToken      = "refresh_token"
+	AuthorizationCode = "authorization_code"
+)
+
+// OIDCScopes are the OpenID Connect scopes every client may request.
+var OIDCScopes = []string{"openid", "profile", "email"}
+
+// Signing algorithms.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Client is an application allowed to request tokens.
+type Client struct {
+	ID string `yaml:"client_id" json:"clientId"`
+	// Secret authenticates confidential clients. Public clients have none and
+	// must use PKCE.
+	Secret       string   `yaml:"client_secret" json:"-"`
+	Public       bool     `yaml:"public" json:"public,omitempty"`
+	RedirectURIs []string `yaml:"redirect_uris" json:"redirectUris,omitempty"`
+	// PostLogoutRedirectURIs are where RP-initiated logout may return to.
+	PostLogoutRedirectURIs []string `yaml:"post_logout_redirect_uris" json:"postLogoutRedirectUris,omitempty"`
+	GrantTypes             []string `yaml:"grant_types" json:"grantTypes"`
+	// Scopes are what the client may request; it gets all of them when it
+	// asks for none.
+	Scopes []string `yaml:"scopes" json:"scopes,omitempty"`
+	// Roles are given to client_credentials tokens, whose subject is the
+	// client itself.
+	Roles []string `yaml:"roles" json:"roles,omitempty"`
+	// Audience, Claims and the lifetimes override the server's for this
+	// client's tokens.
+	Audience        string         `yaml:"audience" json:"audience,omitempty"`
+	Claims          map[string]any `yaml:"claims" json:"claims,omitempty"`
+	AccessTokenTTL  time.Duration  `yaml:"access_token_ttl" json:"accessTokenTtl,omitempty"`
+	RefreshTokenTTL time.Duration  `yaml:"refresh_token_ttl" json:"refreshTokenTtl,omitempty"`
+}
+
+// MarshalJSON writes lifetimes as durations such as "5m0s".
+func (c Client) MarshalJSON() ([]byte, error) {
+	type plain Client
+	return json.Marshal(struct {
+		plain
+		AccessTokenTTL  string `json:"accessTokenTtl,omitempty"`
+		RefreshTokenTTL string `json:"refreshTokenTtl,omitempty"`
+	}{plain(c), durationString(c.AccessTokenTTL), durationString(c.RefreshTokenTTL)})
+}
+
+// Allows reports whether the client may use a grant type.
+func (c *Client) Allows(grant string) bool {
+	return slices.Contains(c.GrantTypes, grant)
+}
+
+// Config is the authorization server's settings.
+type Config struct {
+	// Issuer is the iss of every token and must match on verification.
+	Issuer string `yaml:"issuer" json:"issuer"`
+	// KeysDir keeps the RSA and EC signing keys, generated on first use, and
+	// the revocation list, both shared by the services. Relative paths are
+	// resolved against the config file.
+	KeysDir string `yaml:"keys_dir" json:"keysDir"`
+	// Algorithm signs new tokens: RS256 or ES256. Tokens signed with either
+	// key verify.
+	Algorithm string `yaml:"algorithm" json:"algorithm"`
+	// Audience is the aud of tokens and must be among a token's audiences
+	// for it to verify.
+	Audience string `yaml:"audience" json:"audience"`
+	// RequiredScopes must all be granted to a token for it to verify.
+	RequiredScopes  []string      `yaml:"required_scopes" json:"requiredScopes"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" json:"accessTokenTtl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" json:"refreshTokenTtl"`
+	CodeTTL         time.Duration `yaml:"code_ttl" json:"codeTtl"`
+	// SessionTTL is how long a sign-in at the authorization endpoint lasts
+	// before the user must pick again.
+	SessionTTL time.Duration  `yaml:"session_ttl" json:"sessionTtl"`
+	Claims     map[string]any `yaml:"claims" json:"claims"`
+	Clients    []Client       `yaml:"clients" json:"clients"`
+}
+
+// MarshalJSON writes lifetimes as durations such as "1h0m0s".
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(struct {
+		plain
+		AccessTokenTTL  string `json:"accessTokenTtl"`
+		RefreshTokenTTL string `json:"refreshTokenTtl"`
+		CodeTTL         string `json:"codeTtl"`
+		SessionTTL      string `json:"sessionTtl"`
+	}{plain(c), durationString(c.AccessTokenTTL), durationString(c.RefreshTokenTTL), durationString(c.CodeTTL), durationString(c.SessionTTL)})
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func defaults() Config {
+	return Config{
+		Issuer:          "http://localhost:8080",
+		KeysDir:         "certs/oauth",
+		Algorithm:       RS256,
+		Audience:        "servr",
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 24 * time.Hour,
+		CodeTTL:         time.Minute,
+		SessionTTL:      8 * time.Hour,
+	}
+}
+
+// Client returns the client with the given ID.
+func (c *Config) Client(id string) (*Client, bool) {
+	for i := range c.Clients {
+		if c.Clients[i].ID == id {
+			return &c.Clients[i], true
+		}
+	}
+	return nil, false
+}
+
+// Validate checks the settings and fills in client defaults.
+func (c *Config) Validate() error {
+	if c.Issuer == "" {
+		return fmt.Errorf("issuer must be set")
+	}
+	if c.Algorithm != RS256 && c.Algorithm != ES256 {
+		return fmt.Errorf("algorithm must be %s or %s", RS256, ES256)
+	}
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 || c.CodeTTL <= 0 || c.SessionTTL <= 0 {
+		return fmt.Errorf("token, code and session lifetimes must be positive")
+	}
+
+	seen := map[string]bool{}
+	for i := range c.Clients {
+		client := &c.Clients[i]
+		if client.ID == "" {
+			return fmt.Errorf("clients[%d]: missing client_id", i)
+		}
+		if seen[client.ID] {
+			return fmt.Errorf("clients[%d]: duplicate client_id %q", i, client.ID)
+		}
+		seen[client.ID] = true
+		if !client.Public && client.Secret == "" {
+			return fmt.Errorf("client %s: confidential clients need a client_secret", client.ID)
+		}
+		for _, grant := range client.GrantTypes {
+			switch grant {
+			case ClientCredentials:
+				if client.Public {
+					return fmt.Errorf("client %s: public clients cannot use %s", client.ID, grant)
+				}
+			case Password, RefreshToken:
+			case AuthorizationCode:
+				if len(client.RedirectURIs) == 0 {
+					return fmt.Errorf("client %s: %s needs redirect_uris", client.ID, grant)
+				}
+			default:
+				return fmt.Errorf("client %s: unknown grant type %q", client.ID, grant)
+			}
+		}
+		if client.AccessTokenTTL < 0 || client.RefreshTokenTTL < 0 {
+			return fmt.Errorf("client %s: token lifetimes must not be negative", client.ID)
+		}
+		if client.Audience == "" {
+			client.Audience = c.Audience
+		}
+		if client.AccessTokenTTL == 0 {
+			client.AccessTokenTTL = c.AccessTokenTTL
+		}
+		if client.RefreshTokenTTL == 0 {
+			client.RefreshTokenTTL = c.RefreshTokenTTL
+		}
+	}
+	return nil
+}
+
+// Load reads the settings from the file named by OAUTH_CONFIG, loads or
+// creates the signing keys and makes the provider current, so that Current
+// can verify tokens. Without OAUTH_CONFIG, OAuth is off and Load returns nil.
+func Load() (*Provider, error) {
+	file := os.Getenv("OAUTH_CONFIG")
+	if file == "" {
+		return nil, nil
+	}
+
+	cfg := defaults()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read oauth config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse oauth config %s: %w", file, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("oauth config %s: %w", file, err)
+	}
+	if !filepath.IsAbs(cfg.KeysDir) {
+		cfg.KeysDir = filepath.Join(filepath.Dir(file), cfg.KeysDir)
+	}
+
+	keys, err := LoadOrCreateKeys(cfg.KeysDir)
+	if err != nil {
+		return nil, fmt.Errorf("oauth signing keys: %w", err)
+	}
+	current = &Provider{Config: cfg, Keys: keys, revoked: newRevocationList(cfg.KeysDir)}
+	return current, nil
+}
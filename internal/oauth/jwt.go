@@ -0,0 +1,243 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken means a token is malformed or its signature, issuer or
+	// audience is wrong.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpired means a token's exp has passed.
+	ErrExpired = errors.New("token expired")
+	// ErrInsufficientScope means a token lacks a required scope.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// Claims are a JWT's payload.
+type Claims map[string]any
+
+// String returns a string claim.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that is a string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim.
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// Scopes returns the space-separated scope claim.
+func (c Claims) Scopes() []string {
+	return strings.Fields(c.String("scope"))
+}
+
+// Provider signs and verifies tokens with the configured keys.
+type Provider struct {
+	Config Config
+	Keys   *Keys
+
+	revoked *revocationList
+}
+
+var current *Provider
+
+// Current returns the provider made current by Load, or nil when OAuth is
+// off.
+func Current() *Provider {
+	return current
+}
+
+// IsJWT reports whether token looks like a compact JWS rather than an
+// opaque token.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// JOSE header types of the tokens the provider signs. Access tokens have
+// their own (RFC 9068) so an ID token, signed with the same keys, is never
+// accepted as one.
+const (
+	AccessTokenType = "at+jwt"
+	IDTokenType     = "JWT"
+)
+
+// Sign encodes claims as a JWT of the given type signed with the configured
+// algorithm.
+func (p *Provider) Sign(typ string, claims Claims) (string, error) {
+	var signer crypto.Signer = p.Keys.RSA
+	if p.Config.Algorithm == ES256 {
+		signer = p.Keys.EC
+	}
+	header, err := json.Marshal(map[string]string{"alg": p.Config.Algorithm, "typ": typ, "kid": KeyID(signer.Public())})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	signingInput := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	if p.Config.Algorithm == ES256 {
+		r, s, err := ecdsa.Sign(rand.Reader, p.Keys.EC, digest[:])
+		if err != nil {
+			return "", err
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else if sig, err = rsa.SignPKCS1v15(rand.Reader, p.Keys.RSA, crypto.SHA256, digest[:]); err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64(sig), nil
+}
+
+// Parse checks a token's signature and returns its claims without looking
+// at its type, issuer, audience, lifetime or scopes.
+func (p *Provider) Parse(token string) (Claims, error) {
+	_, claims, err := p.parse(token)
+	return claims, err
+}
+
+// parse is Parse that also returns the JOSE header's typ.
+func (p *Provider) parse(token string) (string, Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch header.Alg {
+	case RS256:
+		if header.Kid != "" && header.Kid != KeyID(&p.Keys.RSA.PublicKey) {
+			return "", nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, header.Kid)
+		}
+		if rsa.VerifyPKCS1v15(&p.Keys.RSA.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+			return "", nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case ES256:
+		if header.Kid != "" && header.Kid != KeyID(&p.Keys.EC.PublicKey) {
+			return "", nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, header.Kid)
+		}
+		if len(sig) != 64 || !ecdsa.Verify(&p.Keys.EC.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return "", nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", nil, ErrInvalidToken
+	}
+	return header.Typ, claims, nil
+}
+
+// Active checks that a token is an access token, its signature, issuer and
+// lifetime and that it has not been revoked, and returns its claims. Unlike
+// Verify it accepts tokens for any audience and scopes.
+func (p *Provider) Active(token string) (Claims, error) {
+	typ, claims, err := p.parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if typ != AccessTokenType {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	if claims.String("iss") != p.Config.Issuer {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	}
+	now := time.Now()
+	if exp, ok := claims.Time("exp"); !ok || !now.Before(exp) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Before(nbf) {
+		return nil, fmt.Errorf("%w: not yet valid", ErrInvalidToken)
+	}
+	if p.Revoked(TokenID(token)) {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+// Verify checks what Active does plus the audience and the required
+// scopes, and returns the token's claims.
+func (p *Provider) Verify(token string) (Claims, error) {
+	claims, err := p.Active(token)
+	if err != nil {
+		return nil, err
+	}
+	if p.Config.Audience != "" && !slices.Contains(claims.Strings("aud"), p.Config.Audience) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+	scopes := claims.Scopes()
+	for _, scope := range p.Config.RequiredScopes {
+		if !slices.Contains(scopes, scope) {
+			return nil, fmt.Errorf("%w: missing %s", ErrInsufficientScope, scope)
+		}
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
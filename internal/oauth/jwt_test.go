@@ -0,0 +1,161 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKeysOnce sync.Once
+	testKeys     *Keys
+	testKeysErr  error
+)
+
+// newTestProvider returns a provider with the default settings whose keys,
+// slow to generate, are shared by every test.
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "oauth-keys-")
+		if err != nil {
+			testKeysErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+		testKeys, testKeysErr = LoadOrCreateKeys(dir)
+	})
+	if testKeysErr != nil {
+		t.Fatal(testKeysErr)
+	}
+	return &Provider{Config: defaults(), Keys: testKeys, revoked: newRevocationList(t.TempDir())}
+}
+
+func accessClaims(p *Provider) Claims {
+	now := time.Now()
+	return Claims{
+		"iss":   p.Config.Issuer,
+		"sub":   "testuser",
+		"aud":   []string{p.Config.Audience},
+		"scope": "read write",
+		"jti":   "token-1",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		algorithm string
+		edit      func(Claims)
+		config    func(*Config)
+		want      error
+	}{
+		{name: "valid", want: nil},
+		{name: "ES256", algorithm: ES256, want: nil},
+		{name: "ID token", typ: IDTokenType, want: ErrInvalidToken},
+		{name: "ID token without an audience to check", typ: IDTokenType, config: func(c *Config) { c.Audience = "" }, want: ErrInvalidToken},
+		{name: "another type", typ: "logout+jwt", want: ErrInvalidToken},
+		{name: "wrong issuer", edit: func(c Claims) { c["iss"] = "https://elsewhere" }, want: ErrInvalidToken},
+		{name: "expired", edit: func(c Claims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, want: ErrExpired},
+		{name: "no expiry", edit: func(c Claims) { delete(c, "exp") }, want: ErrExpired},
+		{name: "not yet valid", edit: func(c Claims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, want: ErrInvalidToken},
+		{name: "wrong audience", edit: func(c Claims) { c["aud"] = "other" }, want: ErrInvalidToken},
+		{name: "audience as a string", edit: func(c Claims) { c["aud"] = "servr" }, want: nil},
+		{name: "any audience when none is configured", edit: func(c Claims) { c["aud"] = "other" }, config: func(c *Config) { c.Audience = "" }, want: nil},
+		{name: "required scopes", config: func(c *Config) { c.RequiredScopes = []string{"read", "write"} }, want: nil},
+		{name: "missing scope", config: func(c *Config) { c.RequiredScopes = []string{"admin"} }, want: ErrInsufficientScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			if tt.algorithm != "" {
+				p.Config.Algorithm = tt.algorithm
+			}
+			claims := accessClaims(p)
+			if tt.edit != nil {
+				tt.edit(claims)
+			}
+			typ := AccessTokenType
+			if tt.typ != "" {
+				typ = tt.typ
+			}
+			token, err := p.Sign(typ, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.config != nil {
+				tt.config(&p.Config)
+			}
+			got, err := p.Verify(token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+			if err == nil && got.String("sub") != "testuser" {
+				t.Errorf("Verify returned claims %v", got)
+			}
+		})
+	}
+}
+
+func TestParseRejectsForgeries(t *testing.T) {
+	p := newTestProvider(t)
+	token, err := p.Sign(AccessTokenType, accessClaims(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not a JWT", "opaque-token"},
+		{"changed claims", parts[0] + "." + b64([]byte(`{"iss":"http://localhost:8080","sub":"admin"}`)) + "." + parts[2]},
+		{"no signature", parts[0] + "." + parts[1] + "."},
+		{"alg none", b64([]byte(`{"alg":"none","typ":"at+jwt"}`)) + "." + parts[1] + "."},
+		{"HS256", b64([]byte(`{"alg":"HS256","typ":"at+jwt"}`)) + "." + parts[1] + "." + parts[2]},
+		{"unknown key", b64([]byte(`{"alg":"RS256","typ":"at+jwt","kid":"other"}`)) + "." + parts[1] + "." + parts[2]},
+		{"bad header", "e30" + parts[0] + "." + parts[1] + "." + parts[2]},
+	}
+	for _, tt := range tests {
+		if _, err := p.Parse(tt.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Parse(%s) = %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+}
+
+func TestClaims(t *testing.T) {
+	c := Claims{
+		"name":  "x",
+		"aud":   []any{"a", 1, "b"},
+		"roles": []string{"admin"},
+		"exp":   float64(1700000000),
+		"scope": " read  write ",
+	}
+	if got := c.Strings("aud"); strings.Join(got, ",") != "a,b" {
+		t.Errorf("Strings(aud) = %v", got)
+	}
+	if got := c.Strings("name"); len(got) != 1 || got[0] != "x" {
+		t.Errorf("Strings(name) = %v", got)
+	}
+	if got := c.Strings("roles"); len(got) != 1 || got[0] != "admin" {
+		t.Errorf("Strings(roles) = %v", got)
+	}
+	if got, ok := c.Time("exp"); !ok || got.Unix() != 1700000000 {
+		t.Errorf("Time(exp) = %v, %v", got, ok)
+	}
+	if _, ok := c.Time("name"); ok {
+		t.Error("Time(name) read a string as a date")
+	}
+	if got := c.Scopes(); strings.Join(got, ",") != "read,write" {
+		t.Errorf("Scopes() = %v", got)
+	}
+}
@@ -0,0 +1,163 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// RSAKeyFile and ECKeyFile hold the signing keys in KeysDir.
+	RSAKeyFile = "signing-rsa.pem"
+	ECKeyFile  = "signing-ec.pem"
+)
+
+// Keys are the RS256 and ES256 signing keys.
+type Keys struct {
+	RSA *rsa.PrivateKey
+	EC  *ecdsa.PrivateKey
+}
+
+// LoadOrCreateKeys loads the signing keys kept in dir, generating them the
+// first time. Services starting together race to create them; the loser
+// loads the winner's.
+func LoadOrCreateKeys(dir string) (*Keys, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	rsaKey, err := loadOrCreateKey(filepath.Join(dir, RSAKeyFile), func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ecKey, err := loadOrCreateKey(filepath.Join(dir, ECKeyFile), func() (crypto.Signer, error) {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{}
+	var ok bool
+	if keys.RSA, ok = rsaKey.(*rsa.PrivateKey); !ok {
+		return nil, fmt.Errorf("%s: expected an RSA key", RSAKeyFile)
+	}
+	if keys.EC, ok = ecKey.(*ecdsa.PrivateKey); !ok || keys.EC.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: expected a P-256 EC key", ECKeyFile)
+	}
+	return keys, nil
+}
+
+func loadOrCreateKey(path string, generate func() (crypto.Signer, error)) (crypto.Signer, error) {
+	key, err := loadKey(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+
+	if key, err = generate(); err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// link a complete temporary file into place so a concurrent reader never
+	// sees a half-written key, and an existing key is never overwritten
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".key-*.pem")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return loadKey(path)
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: expected a private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type", path)
+	}
+	return signer, nil
+}
+
+// KeyID identifies a public key in token headers and the JWKS: a prefix of
+// the SHA-256 of its DER encoding.
+func KeyID(pub crypto.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the public half of the keys, as served to clients.
+func (k *Keys) JWKS() map[string][]JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaPub, ecPub := &k.RSA.PublicKey, &k.EC.PublicKey
+	// an uncompressed point: 0x04, then X and Y
+	point, _ := ecPub.ECDH()
+	xy := point.Bytes()[1:]
+	return map[string][]JWK{"keys": {
+		{
+			Kty: "RSA", Use: "sig", Alg: RS256, Kid: KeyID(rsaPub),
+			N: b64(rsaPub.N.Bytes()), E: b64(big.NewInt(int64(rsaPub.E)).Bytes()),
+		},
+		{
+			Kty: "EC", Use: "sig", Alg: ES256, Kid: KeyID(ecPub),
+			Crv: "P-256", X: b64(xy[:32]), Y: b64(xy[32:]),
+		},
+	}}
+}
@@ -0,0 +1,182 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRevoked means a token has been revoked.
+var ErrRevoked = errors.New("token revoked")
+
+// Revocation is a revoked token on the list the services share.
+type Revocation struct {
+	// ID is a JWT's jti or a hash of an opaque token; tokens themselves are
+	// never stored.
+	ID        string    `json:"id"`
+	RevokedAt time.Time `json:"revokedAt"`
+	// ExpiresAt is when the token would have expired anyway and the entry
+	// can be dropped. Tokens that never expire have none.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// TokenID identifies a token on the revocation list: its jti for a JWT,
+// otherwise a SHA-256 hash of the token. It does not verify the token.
+func TokenID(token string) string {
+	if IsJWT(token) {
+		var claims Claims
+		if decodeSegment(strings.Split(token, ".")[1], &claims) == nil && claims.String("jti") != "" {
+			return claims.String("jti")
+		}
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// revocationList is kept in a file in the keys directory, so the service
+// that revokes a token and those verifying it share it. Each lookup rereads
+// the file when it has changed, so a revocation takes effect on every
+// service's next request.
+type revocationList struct {
+	mu      sync.Mutex
+	file    string
+	modTime time.Time
+	size    int64
+	entries map[string]Revocation
+}
+
+func newRevocationList(dir string) *revocationList {
+	return &revocationList{file: filepath.Join(dir, "revoked.json"), entries: map[string]Revocation{}}
+}
+
+// refresh rereads the file if it changed. The caller holds mu.
+func (l *revocationList) refresh() error {
+	info, err := os.Stat(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		l.entries, l.modTime, l.size = map[string]Revocation{}, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(l.modTime) && info.Size() == l.size {
+		return nil
+	}
+	data, err := os.ReadFile(l.file)
+	if err != nil {
+		return err
+	}
+	var list []Revocation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse %s: %w", l.file, err)
+	}
+	l.entries = make(map[string]Revocation, len(list))
+	for _, r := range list {
+		l.entries[r.ID] = r
+	}
+	l.modTime, l.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// save writes the entries that have not expired, replacing the file so
+// readers never see it half written. The caller holds mu.
+func (l *revocationList) save() error {
+	now := time.Now()
+	list := make([]Revocation, 0, len(l.entries))
+	for id, r := range l.entries {
+		if r.ExpiresAt != nil && now.After(*r.ExpiresAt) {
+			delete(l.entries, id)
+			continue
+		}
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RevokedAt.Before(list[j].RevokedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.file), ".revoked-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.file); err != nil {
+		return err
+	}
+	// Pick up our own write so the next lookup need not reread it.
+	l.modTime, l.size = time.Time{}, 0
+	return l.refresh()
+}
+
+// Revoke adds the token with the given ID to the revocation list.
+// expiresAt may be zero for tokens that never expire.
+func (p *Provider) Revoke(id string, expiresAt time.Time) error {
+	l := p.revoked
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.refresh(); err != nil {
+		return err
+	}
+	r := Revocation{ID: id, RevokedAt: time.Now()}
+	if !expiresAt.IsZero() {
+		r.ExpiresAt = &expiresAt
+	}
+	l.entries[id] = r
+	return l.save()
+}
+
+// Revoked reports whether the token with the given ID has been revoked. It
+// is false when OAuth is off. An unreadable list keeps the last one read.
+func (p *Provider) Revoked(id string) bool {
+	if p == nil {
+		return false
+	}
+	l := p.revoked
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh()
+	_, ok := l.entries[id]
+	return ok
+}
+
+// Revocations returns the revocation list, oldest first.
+func (p *Provider) Revocations() ([]Revocation, error) {
+	l := p.revoked
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.refresh(); err != nil {
+		return nil, err
+	}
+	list := make([]Revocation, 0, len(l.entries))
+	for _, r := range l.entries {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RevokedAt.Before(list[j].RevokedAt) })
+	return list, nil
+}
+
+// ClearRevocations empties the revocation list, reinstating every revoked
+// token that has not expired.
+func (p *Provider) ClearRevocations() error {
+	l := p.revoked
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = map[string]Revocation{}
+	return l.save()
+}
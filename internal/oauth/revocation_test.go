@@ -0,0 +1,130 @@
+package oauth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenID(t *testing.T) {
+	p := newTestProvider(t)
+	signed, err := p.Sign(AccessTokenType, accessClaims(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := p.Sign(AccessTokenType, Claims{"sub": "testuser"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := TokenID(signed); got != "token-1" {
+		t.Errorf("TokenID of a JWT = %q, want its jti", got)
+	}
+	if got := TokenID(unsigned); !strings.HasPrefix(got, "sha256:") {
+		t.Errorf("TokenID of a JWT without jti = %q, want a hash", got)
+	}
+	if a, b := TokenID("valid-token"), TokenID("other-token"); a == b || !strings.HasPrefix(a, "sha256:") || strings.Contains(a, "valid-token") {
+		t.Errorf("TokenID of opaque tokens = %q, %q", a, b)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	p := newTestProvider(t)
+	token, err := p.Sign(AccessTokenType, accessClaims(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(token); err != nil {
+		t.Fatalf("Verify before revocation: %v", err)
+	}
+
+	if err := p.Revoke(TokenID(token), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Revoke(TokenID("valid-token"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(token); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify after revocation = %v, want ErrRevoked", err)
+	}
+	if _, err := p.Active(token); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Active after revocation = %v, want ErrRevoked", err)
+	}
+	if !p.Revoked(TokenID("valid-token")) {
+		t.Error("an opaque token's revocation was not recorded")
+	}
+	list, err := p.Revocations()
+	if err != nil || len(list) != 2 || list[0].ID != "token-1" || list[0].ExpiresAt == nil || list[1].ExpiresAt != nil {
+		t.Errorf("Revocations() = %+v, %v", list, err)
+	}
+
+	if err := p.ClearRevocations(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(token); err != nil {
+		t.Errorf("Verify after clearing revocations: %v", err)
+	}
+}
+
+func TestRevocationsAreShared(t *testing.T) {
+	dir := t.TempDir()
+	issuer := newTestProvider(t)
+	issuer.revoked = newRevocationList(dir)
+	verifier := newTestProvider(t)
+	verifier.revoked = newRevocationList(dir)
+
+	if verifier.Revoked("token-1") {
+		t.Fatal("revoked before any revocation")
+	}
+	if err := issuer.Revoke("token-1", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if !verifier.Revoked("token-1") {
+		t.Error("another provider sharing the keys directory missed the revocation")
+	}
+	if err := verifier.ClearRevocations(); err != nil {
+		t.Fatal(err)
+	}
+	if issuer.Revoked("token-1") {
+		t.Error("another provider sharing the keys directory missed the list being cleared")
+	}
+}
+
+func TestExpiredRevocationsAreDropped(t *testing.T) {
+	p := newTestProvider(t)
+	if err := p.Revoke("old", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Revoke("new", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	list, err := p.Revocations()
+	if err != nil || len(list) != 1 || list[0].ID != "new" {
+		t.Errorf("Revocations() = %+v, %v; want only the unexpired entry", list, err)
+	}
+}
+
+func TestUnreadableRevocationsKeepTheLastList(t *testing.T) {
+	p := newTestProvider(t)
+	if err := p.Revoke("token-1", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p.revoked.file, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Revoked("token-1") {
+		t.Error("a corrupt list reinstated a revoked token")
+	}
+	if _, err := p.Revocations(); err == nil {
+		t.Error("Revocations() read a corrupt list without error")
+	}
+}
+
+func TestRevokedWithOAuthOff(t *testing.T) {
+	var off *Provider
+	if off.Revoked("token-1") {
+		t.Error("Revoked is true with OAuth off")
+	}
+}
@@ -0,0 +1,258 @@
+// Package rbac decides what a user's roles allow. One policy file, named by
+// the RBAC_POLICY environment variable, declares the requirements of REST
+// routes, SOAP operations and SFTP paths so every service enforces the same
+// rules.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"mock-server/internal/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AllPermissions, granted to a role, grants every permission.
+const AllPermissions = "*"
+
+var (
+	// ErrUnauthenticated means a requirement applies but there is no user.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrDenied means the user's roles do not meet a requirement.
+	ErrDenied = errors.New("access denied")
+)
+
+// Requirement is met by a user holding one of Roles, when any are listed,
+// and every one of Permissions.
+type Requirement struct {
+	Roles       []string `yaml:"roles" json:"roles,omitempty"`
+	Permissions []string `yaml:"permissions" json:"permissions,omitempty"`
+}
+
+// PathRule guards an SFTP directory tree. Read covers downloads, listings
+// and stats; Write covers uploads, renames, removals and new directories.
+type PathRule struct {
+	Path  string       `yaml:"path" json:"path"`
+	Read  *Requirement `yaml:"read" json:"read,omitempty"`
+	Write *Requirement `yaml:"write" json:"write,omitempty"`
+}
+
+// Policy is the whole authorization policy. Anything it does not mention is
+// open to every user, so an empty policy changes nothing.
+type Policy struct {
+	// Roles grant permissions.
+	Roles map[string][]string `yaml:"roles" json:"roles"`
+	// REST is keyed by "METHOD /template" or "/template", like the REST
+	// service's fault routes.
+	REST map[string]*Requirement `yaml:"rest" json:"rest"`
+	// SOAP is keyed by operation name, e.g. GetCustomer.
+	SOAP map[string]*Requirement `yaml:"soap" json:"soap"`
+	// SFTP rules apply to their path and everything below it; the longest
+	// matching path wins.
+	SFTP []PathRule `yaml:"sftp" json:"sftp"`
+}
+
+// Load reads the policy file named by RBAC_POLICY. An unset variable is not
+// an error; every user may then do everything.
+func Load() (*Policy, error) {
+	p := &Policy{}
+
+	file := os.Getenv("RBAC_POLICY")
+	if file == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read rbac policy: %w", err)
+	}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parse rbac policy %s: %w", file, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("rbac policy %s: %w", file, err)
+	}
+	return p, nil
+}
+
+// Validate checks that requirements only name known roles and permissions
+// and normalizes SFTP paths.
+func (p *Policy) Validate() error {
+	known := map[string]bool{AllPermissions: true}
+	for _, perms := range p.Roles {
+		for _, perm := range perms {
+			known[perm] = true
+		}
+	}
+	check := func(where string, req *Requirement) error {
+		if req == nil {
+			return nil
+		}
+		for _, perm := range req.Permissions {
+			if !known[perm] {
+				return fmt.Errorf("%s: permission %q is not granted by any role", where, perm)
+			}
+		}
+		return nil
+	}
+
+	for route, req := range p.REST {
+		if err := check("rest["+route+"]", req); err != nil {
+			return err
+		}
+	}
+	for op, req := range p.SOAP {
+		if err := check("soap["+op+"]", req); err != nil {
+			return err
+		}
+	}
+	for i := range p.SFTP {
+		rule := &p.SFTP[i]
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("sftp[%d]: path must be absolute", i)
+		}
+		rule.Path = path.Clean(rule.Path)
+		if err := check("sftp["+rule.Path+"].read", rule.Read); err != nil {
+			return err
+		}
+		if err := check("sftp["+rule.Path+"].write", rule.Write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Permissions returns what a user's roles grant.
+func (p *Policy) Permissions(user *common.User) []string {
+	set := map[string]bool{}
+	for _, role := range user.Roles {
+		for _, perm := range p.Roles[role] {
+			set[perm] = true
+		}
+	}
+	out := make([]string, 0, len(set))
+	for perm := range set {
+		out = append(out, perm)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Check reports whether user meets req. A nil requirement is always met; a
+// nil user meets nothing else.
+func (p *Policy) Check(user *common.User, req *Requirement) error {
+	if req == nil {
+		return nil
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	if len(req.Roles) > 0 && !slices.ContainsFunc(req.Roles, func(role string) bool { return slices.Contains(user.Roles, role) }) {
+		return fmt.Errorf("%w: requires one of the roles %s", ErrDenied, strings.Join(req.Roles, ", "))
+	}
+	perms := p.Permissions(user)
+	if slices.Contains(perms, AllPermissions) {
+		return nil
+	}
+	for _, perm := range req.Permissions {
+		if !slices.Contains(perms, perm) {
+			return fmt.Errorf("%w: requires the permission %s", ErrDenied, perm)
+		}
+	}
+	return nil
+}
+
+// RESTRoute returns the requirement of the first of routeKeys that has one.
+func (p *Policy) RESTRoute(routeKeys ...string) (string, *Requirement) {
+	for _, key := range routeKeys {
+		if req, ok := p.REST[key]; ok {
+			return key, req
+		}
+	}
+	return "", nil
+}
+
+// SOAPOperation returns the requirement of a SOAP operation.
+func (p *Policy) SOAPOperation(op string) *Requirement {
+	return p.SOAP[op]
+}
+
+// SFTPPath returns the rule covering an SFTP path and its requirement for
+// reading or writing.
+func (p *Policy) SFTPPath(file string, write bool) (string, *Requirement) {
+	file = path.Clean("/" + file)
+	best := -1
+	for i, rule := range p.SFTP {
+		if file == rule.Path || strings.HasPrefix(file, strings.TrimSuffix(rule.Path, "/")+"/") {
+			if best < 0 || len(rule.Path) > len(p.SFTP[best].Path) {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return "", nil
+	}
+	if write {
+		return p.SFTP[best].Path, p.SFTP[best].Write
+	}
+	return p.SFTP[best].Path, p.SFTP[best].Read
+}
+
+// Decision is whether a user may use one guarded resource.
+type Decision struct {
+	Service     string       `json:"service"`
+	Resource    string       `json:"resource"`
+	Requirement *Requirement `json:"requirement"`
+	Allowed     bool         `json:"allowed"`
+	Reason      string       `json:"reason,omitempty"`
+}
+
+// Effective is what the policy means for one user.
+type Effective struct {
+	User        *common.User `json:"user"`
+	Permissions []string     `json:"permissions"`
+	Decisions   []Decision   `json:"decisions"`
+}
+
+// Effective evaluates every requirement in the policy for user.
+func (p *Policy) Effective(user *common.User) Effective {
+	out := Effective{User: user, Permissions: p.Permissions(user), Decisions: []Decision{}}
+	decide := func(service, resource string, req *Requirement) {
+		d := Decision{Service: service, Resource: resource, Requirement: req, Allowed: true}
+		if err := p.Check(user, req); err != nil {
+			d.Allowed, d.Reason = false, err.Error()
+		}
+		out.Decisions = append(out.Decisions, d)
+	}
+
+	for _, route := range sortedKeys(p.REST) {
+		decide("rest", route, p.REST[route])
+	}
+	for _, op := range sortedKeys(p.SOAP) {
+		decide("soap", op, p.SOAP[op])
+	}
+	for _, rule := range p.SFTP {
+		if rule.Read != nil {
+			decide("sftp", "read "+rule.Path, rule.Read)
+		}
+		if rule.Write != nil {
+			decide("sftp", "write "+rule.Path, rule.Write)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]*Requirement) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
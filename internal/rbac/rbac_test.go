@@ -0,0 +1,183 @@
+package rbac
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"mock-server/internal/common"
+)
+
+func testPolicy() *Policy {
+	return &Policy{
+		Roles: map[string][]string{
+			"admin":   {AllPermissions},
+			"editor":  {"customers:read", "customers:write"},
+			"auditor": {"customers:read", "audit:read"},
+		},
+		REST: map[string]*Requirement{
+			"DELETE /customers/{id}": {Roles: []string{"admin"}},
+			"/customers/{id}":        {Permissions: []string{"customers:read"}},
+		},
+		SOAP: map[string]*Requirement{
+			"UpdateCustomer": {Permissions: []string{"customers:write"}},
+		},
+		SFTP: []PathRule{
+			{Path: "/uploads", Write: &Requirement{Roles: []string{"editor", "admin"}}},
+			{Path: "/uploads/audit/", Read: &Requirement{Permissions: []string{"audit:read"}}},
+		},
+	}
+}
+
+func user(roles ...string) *common.User {
+	return &common.User{Username: "u", Roles: roles}
+}
+
+func TestCheck(t *testing.T) {
+	p := testPolicy()
+	tests := []struct {
+		name string
+		user *common.User
+		req  *Requirement
+		want error
+	}{
+		{"no requirement", nil, nil, nil},
+		{"no user", nil, &Requirement{}, ErrUnauthenticated},
+		{"empty requirement", user(), &Requirement{}, nil},
+		{"one of the roles", user("editor"), &Requirement{Roles: []string{"admin", "editor"}}, nil},
+		{"none of the roles", user("auditor"), &Requirement{Roles: []string{"admin", "editor"}}, ErrDenied},
+		{"granted permission", user("auditor"), &Requirement{Permissions: []string{"audit:read"}}, nil},
+		{"missing permission", user("auditor"), &Requirement{Permissions: []string{"customers:read", "customers:write"}}, ErrDenied},
+		{"permissions from several roles", user("auditor", "editor"), &Requirement{Permissions: []string{"audit:read", "customers:write"}}, nil},
+		{"all permissions", user("admin"), &Requirement{Permissions: []string{"anything"}}, nil},
+		{"all permissions still need the role", user("admin"), &Requirement{Roles: []string{"editor"}}, ErrDenied},
+		{"unknown role", user("guest"), &Requirement{Permissions: []string{"customers:read"}}, ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Check(tt.user, tt.req); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("Check = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(*Policy)
+		wantErr bool
+	}{
+		{"valid", func(*Policy) {}, false},
+		{"unknown REST permission", func(p *Policy) { p.REST["/x"] = &Requirement{Permissions: []string{"nope"}} }, true},
+		{"unknown SOAP permission", func(p *Policy) { p.SOAP["X"] = &Requirement{Permissions: []string{"nope"}} }, true},
+		{"unknown SFTP permission", func(p *Policy) { p.SFTP[0].Read = &Requirement{Permissions: []string{"nope"}} }, true},
+		{"relative SFTP path", func(p *Policy) { p.SFTP[0].Path = "uploads" }, true},
+		{"all permissions may be required", func(p *Policy) { p.SOAP["X"] = &Requirement{Permissions: []string{AllPermissions}} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPolicy()
+			tt.edit(p)
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	p := testPolicy()
+	if err := p.Validate(); err != nil || p.SFTP[1].Path != "/uploads/audit" {
+		t.Errorf("Validate() = %v and left the path %q uncleaned", err, p.SFTP[1].Path)
+	}
+}
+
+func TestSFTPPath(t *testing.T) {
+	p := testPolicy()
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file     string
+		write    bool
+		wantRule string
+		wantReq  *Requirement
+	}{
+		{"/uploads", true, "/uploads", p.SFTP[0].Write},
+		{"/uploads/a.csv", true, "/uploads", p.SFTP[0].Write},
+		{"uploads/a.csv", false, "/uploads", nil},
+		{"/uploads/audit/log.txt", false, "/uploads/audit", p.SFTP[1].Read},
+		{"/uploads/audit/log.txt", true, "/uploads/audit", nil},
+		{"/uploads/../etc/passwd", false, "", nil},
+		{"/uploadsX/a.csv", true, "", nil},
+		{"/", false, "", nil},
+	}
+	for _, tt := range tests {
+		rule, req := p.SFTPPath(tt.file, tt.write)
+		if rule != tt.wantRule || req != tt.wantReq {
+			t.Errorf("SFTPPath(%q, %v) = %q, %v; want %q, %v", tt.file, tt.write, rule, req, tt.wantRule, tt.wantReq)
+		}
+	}
+}
+
+func TestRESTRoute(t *testing.T) {
+	p := testPolicy()
+	if key, req := p.RESTRoute("DELETE /customers/{id}", "/customers/{id}"); key != "DELETE /customers/{id}" || req != p.REST[key] {
+		t.Errorf("RESTRoute(DELETE) = %q, %v", key, req)
+	}
+	if key, _ := p.RESTRoute("GET /customers/{id}", "/customers/{id}"); key != "/customers/{id}" {
+		t.Errorf("RESTRoute(GET) = %q, want the method-less route", key)
+	}
+	if key, req := p.RESTRoute("GET /health", "/health"); key != "" || req != nil {
+		t.Errorf("RESTRoute(/health) = %q, %v; want no requirement", key, req)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	p := testPolicy()
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	got := p.Effective(user("auditor"))
+	if !reflect.DeepEqual(got.Permissions, []string{"audit:read", "customers:read"}) {
+		t.Errorf("Permissions = %v", got.Permissions)
+	}
+	allowed := map[string]bool{}
+	for _, d := range got.Decisions {
+		allowed[d.Service+" "+d.Resource] = d.Allowed
+	}
+	want := map[string]bool{
+		"rest DELETE /customers/{id}": false,
+		"rest /customers/{id}":        true,
+		"soap UpdateCustomer":         false,
+		"sftp write /uploads":         false,
+		"sftp read /uploads/audit":    true,
+	}
+	if !reflect.DeepEqual(allowed, want) {
+		t.Errorf("Decisions = %v, want %v", allowed, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("RBAC_POLICY", "")
+	if p, err := Load(); err != nil || p.Check(nil, p.SOAPOperation("UpdateCustomer")) != nil {
+		t.Errorf("Load() without a policy = %+v, %v; want an open policy", p, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "rbac.yaml")
+	os.WriteFile(file, []byte("roles:\n  editor: [customers:write]\nsoap:\n  UpdateCustomer: { permissions: [customers:write] }\n"), 0o644)
+	t.Setenv("RBAC_POLICY", file)
+	p, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check(user("auditor"), p.SOAPOperation("UpdateCustomer")); !errors.Is(err, ErrDenied) {
+		t.Errorf("Check(auditor, UpdateCustomer) = %v, want ErrDenied", err)
+	}
+
+	os.WriteFile(file, []byte("soap:\n  UpdateCustomer: { permissions: [customers:write] }\n"), 0o644)
+	if _, err := Load(); err == nil {
+		t.Error("Load() accepted a permission no role grants")
+	}
+}